@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"home-podcast/internal/auth"
+)
+
+// runGenToken implements "home-podcast gentoken": it creates a random token
+// and prints the hashed line to add to the token file on stdout, so the
+// output can be appended to the file directly. The token itself goes to
+// stderr because it is shown only once and never stored.
+func runGenToken(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gentoken", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: home-podcast gentoken [-scopes read,upload,delete] [-name label] >> tokens.txt")
+		flags.PrintDefaults()
+	}
+	scopes := flags.String("scopes", "", "comma-separated scopes to grant; tokens without scopes get PODCAST_TOKEN_DEFAULT_SCOPES")
+	name := flags.String("name", "", "label identifying the token holder in logs")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	line, token, err := generateTokenLine(*scopes, *name)
+	if err != nil {
+		fmt.Fprintf(stderr, "gentoken: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "token: %s\n", token)
+	fmt.Fprintln(stdout, line)
+	return 0
+}
+
+// generateTokenLine returns a token file line holding the hash of a new
+// token, along with the token.
+func generateTokenLine(scopes, name string) (string, string, error) {
+	identity := auth.Identity{Name: name}
+	if scopes != "" {
+		parsed, err := auth.ParseScopes(scopes)
+		if err != nil {
+			return "", "", err
+		}
+		identity.Scopes = parsed
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	hashed, err := auth.HashToken(token)
+	if err != nil {
+		return "", "", err
+	}
+	line, err := auth.FormatTokenLine(hashed, identity)
+	if err != nil {
+		return "", "", err
+	}
+	return line, token, nil
+}
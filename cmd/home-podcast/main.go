@@ -1,101 +1,69 @@
 package main
 
 import (
-	"context"
-	"errors"
-	"log"
-	"net/http"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"home-podcast/internal/auth"
-	"home-podcast/internal/config"
-	"home-podcast/internal/library"
-	"home-podcast/internal/server"
 )
 
-func main() {
-	logger := log.New(os.Stdout, "home-podcast ", log.LstdFlags|log.Lmsgprefix)
-
-	audioRoot, err := config.ResolveAudioRoot()
-	if err != nil {
-		logger.Fatalf("resolve audio root: %v", err)
-	}
+// command is a home-podcast subcommand. run receives the arguments after the
+// command name and returns the exit status.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
 
-	listenAddr := config.ListenAddr()
-	if err := config.ValidateListenAddr(listenAddr); err != nil {
-		logger.Fatalf("invalid listen address %q: %v", listenAddr, err)
-	}
+var commands = []command{
+	{"serve", "run the podcast server (the default)", runServe},
+	{"token", "add, list and revoke feed tokens and print feed URLs", runToken},
+	{"gentoken", "print a hashed line for a new random token", runGenToken},
+}
 
-	debounce := config.RefreshDebounce()
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	allowedExtensions := config.AllowedExtensions()
-	lib, err := library.NewLibrary(audioRoot, allowedExtensions, debounce, logger)
-	if err != nil {
-		logger.Fatalf("initialise library: %v", err)
+// run dispatches to the subcommand named by args[0], serving when there is
+// none.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runServe(nil, stdout, stderr)
 	}
-	defer func() {
-		if err := lib.Close(); err != nil {
-			logger.Printf("error closing library: %v", err)
-		}
-	}()
-
-	tokenFile, tokensEnabled, err := config.ResolveTokenFile()
-	if err != nil {
-		logger.Fatalf("resolve token file: %v", err)
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(stdout)
+		return 0
 	}
-
-	var tokenStore *auth.TokenStore
-	if tokensEnabled {
-		tokenStore, err = auth.NewTokenStore(tokenFile, debounce, logger)
-		if err != nil {
-			logger.Fatalf("initialise token store: %v", err)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
 		}
-		defer func() {
-			if err := tokenStore.Close(); err != nil {
-				logger.Printf("error closing token store: %v", err)
-			}
-		}()
-	}
-
-	feedConfig, err := config.ResolveFeedMetadata()
-	if err != nil {
-		logger.Fatalf("resolve feed metadata: %v", err)
-	}
-
-	feedMeta := server.FeedMetadata{
-		Title:       feedConfig.Title,
-		Description: feedConfig.Description,
-		Language:    feedConfig.Language,
-		Author:      feedConfig.Author,
 	}
+	fmt.Fprintf(stderr, "home-podcast: unknown command %q\n", args[0])
+	printUsage(stderr)
+	return 2
+}
 
-	handler := server.New(lib, tokenStore, audioRoot, allowedExtensions, feedMeta, logger)
-	httpServer := &http.Server{
-		Addr:              listenAddr,
-		Handler:           handler,
-		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: home-podcast [command] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run \"home-podcast <command> -h\" for the arguments of a command.")
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
-	go func() {
-		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-		defer cancel()
-		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Printf("graceful shutdown error: %v", err)
-		}
-	}()
-
-	logger.Printf("listening on %s (audio directory: %s)", listenAddr, audioRoot)
-	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logger.Fatalf("http server error: %v", err)
+// runServe implements "home-podcast serve". The server is configured
+// entirely through the environment, so it takes no arguments.
+func runServe(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, "usage: home-podcast serve")
+		fmt.Fprintln(stderr, "The server is configured through PODCAST_* environment variables.")
+		return 2
 	}
-	logger.Println("shutdown complete")
+	serve()
+	return 0
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/config"
+	"home-podcast/internal/library"
+	"home-podcast/internal/metadata"
+	"home-podcast/internal/server"
+)
+
+// serve runs the podcast server until it receives SIGINT or SIGTERM.
+func serve() {
+	logger := log.New(os.Stdout, "home-podcast ", log.LstdFlags|log.Lmsgprefix)
+
+	audioRoot, err := config.ResolveAudioRoot()
+	if err != nil {
+		logger.Fatalf("resolve audio root: %v", err)
+	}
+
+	listenAddr := config.ListenAddr()
+	if err := config.ValidateListenAddr(listenAddr); err != nil {
+		logger.Fatalf("invalid listen address %q: %v", listenAddr, err)
+	}
+
+	debounce := config.RefreshDebounce()
+
+	stateDir, stateEnabled, err := config.ResolveStateDir()
+	if err != nil {
+		logger.Fatalf("resolve state directory: %v", err)
+	}
+
+	libraryOptions := library.Options{
+		Workers: config.ScanWorkers(),
+		Metadata: metadata.Options{
+			AccurateMP3: config.MP3DurationMode() == "accurate",
+		},
+	}
+	if config.Debug() {
+		libraryOptions.Metadata.Debug = log.New(os.Stdout, "home-podcast debug ", log.LstdFlags|log.Lmsgprefix)
+	}
+	if stateEnabled {
+		libraryOptions.IndexFile = filepath.Join(stateDir, "library-index.json")
+		libraryOptions.GUIDFile = filepath.Join(stateDir, "episode-guids.json")
+		libraryOptions.ArtworkDir = filepath.Join(stateDir, "artwork")
+	}
+
+	allowedExtensions := config.AllowedExtensions()
+	lib, err := library.NewLibrary(audioRoot, allowedExtensions, debounce, logger, libraryOptions)
+	if err != nil {
+		logger.Fatalf("initialise library: %v", err)
+	}
+	defer func() {
+		if err := lib.Close(); err != nil {
+			logger.Printf("error closing library: %v", err)
+		}
+	}()
+
+	tokenFile, tokensEnabled, err := config.ResolveTokenFile()
+	if err != nil {
+		logger.Fatalf("resolve token file: %v", err)
+	}
+
+	// validator stays a nil interface when tokens are disabled; a nil
+	// *auth.TokenStore inside it would not compare equal to nil.
+	var validator server.TokenValidator
+	if tokensEnabled {
+		var tokenOptions auth.Options
+		if value := config.TokenDefaultScopes(); value != "" {
+			if tokenOptions.DefaultScopes, err = auth.ParseScopes(value); err != nil {
+				logger.Fatalf("invalid PODCAST_TOKEN_DEFAULT_SCOPES: %v", err)
+			}
+		}
+		tokenStore, err := auth.NewTokenStore(tokenFile, debounce, logger, tokenOptions)
+		if err != nil {
+			logger.Fatalf("initialise token store: %v", err)
+		}
+		defer func() {
+			if err := tokenStore.Close(); err != nil {
+				logger.Printf("error closing token store: %v", err)
+			}
+		}()
+		validator = tokenStore
+	}
+
+	feedConfig, err := config.ResolveFeedMetadata()
+	if err != nil {
+		logger.Fatalf("resolve feed metadata: %v", err)
+	}
+
+	feedMeta := server.FeedMetadata{
+		Title:       feedConfig.Title,
+		Description: feedConfig.Description,
+		Language:    feedConfig.Language,
+		Author:      feedConfig.Author,
+		Image:       feedConfig.Image,
+		Explicit:    feedConfig.Explicit,
+		OwnerName:   feedConfig.OwnerName,
+		OwnerEmail:  feedConfig.OwnerEmail,
+		Type:        feedConfig.Type,
+		Copyright:   feedConfig.Copyright,
+		Link:        feedConfig.Link,
+		Locked:      feedConfig.Locked,
+		Medium:      feedConfig.Medium,
+		MaxItems:    config.FeedMaxItems(),
+	}
+	if feedMeta.PublicURL, err = config.PublicURL(); err != nil {
+		logger.Fatalf("resolve public URL: %v", err)
+	}
+	if stateEnabled {
+		feedMeta.GUIDFile = filepath.Join(stateDir, "feed-guid")
+	}
+
+	signingKey, err := config.URLSigningKey()
+	if err != nil {
+		logger.Fatalf("resolve URL signing key: %v", err)
+	}
+	if signingKey != "" {
+		feedMeta.SigningKey = []byte(signingKey)
+		feedMeta.SignedURLLifetime = config.SignedURLTTL()
+	}
+	feedMeta.RejectMediaQueryTokens = !config.MediaQueryTokens()
+
+	for _, category := range feedConfig.Categories {
+		feedMeta.Categories = append(feedMeta.Categories, server.FeedCategory{Name: category.Name, Subcategory: category.Subcategory})
+	}
+	for _, person := range feedConfig.Persons {
+		feedMeta.Persons = append(feedMeta.Persons, server.FeedPerson(person))
+	}
+
+	handler := server.New(lib, validator, audioRoot, allowedExtensions, feedMeta, logger)
+	httpServer := &http.Server{
+		Addr:              listenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	httpServer.RegisterOnShutdown(handler.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Printf("graceful shutdown error: %v", err)
+		}
+	}()
+
+	logger.Printf("listening on %s (audio directory: %s)", listenAddr, audioRoot)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatalf("http server error: %v", err)
+	}
+	logger.Println("shutdown complete")
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/config"
+	"home-podcast/internal/server"
+)
+
+// tokenCommands are the subcommands of "home-podcast token".
+var tokenCommands = []command{
+	{"add", "generate a token for a subscriber and add it to the token file", runTokenAdd},
+	{"list", "show the tokens in the token file without revealing them", runTokenList},
+	{"revoke", "remove a subscriber's token from the token file", runTokenRevoke},
+	{"show-url", "print a subscriber's personal feed URL", runTokenShowURL},
+}
+
+// runToken implements "home-podcast token". Every subcommand edits or reads
+// PODCAST_TOKEN_FILE unless -file names another file. Edits replace the file
+// atomically, so a running server picks them up like any other change.
+func runToken(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		w := stderr
+		if len(args) > 0 {
+			w = stdout
+		}
+		fmt.Fprintln(w, "usage: home-podcast token <command> [arguments]")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "commands:")
+		for _, cmd := range tokenCommands {
+			fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+		}
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, cmd := range tokenCommands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "home-podcast token: unknown command %q\n", args[0])
+	return 2
+}
+
+func runTokenAdd(args []string, stdout, stderr io.Writer) int {
+	flags := newTokenFlagSet("add", "-name label [-scopes read,upload,delete] [-not-before time] [-expires time] [-plain]", stderr)
+	file := flags.String("file", "", "token file to edit (default PODCAST_TOKEN_FILE)")
+	name := flags.String("name", "", "label identifying the subscriber; required and unique")
+	scopes := flags.String("scopes", "", "comma-separated scopes to grant; tokens without scopes get PODCAST_TOKEN_DEFAULT_SCOPES")
+	notBefore := flags.String("not-before", "", "RFC 3339 time or date from which the token is accepted")
+	expires := flags.String("expires", "", "RFC 3339 time or date from which the token is rejected")
+	plain := flags.Bool("plain", false, "store the token itself instead of its hash, so show-url can print its URL later without PODCAST_URL_SIGNING_KEY")
+	baseURL := flags.String("base-url", "", "public base URL for the feed address (default PODCAST_PUBLIC_URL)")
+	if code, ok := parseTokenFlags(flags, args, 0); !ok {
+		return code
+	}
+
+	if *name == "" {
+		fmt.Fprintln(stderr, "token add: -name is required")
+		return 2
+	}
+	identity := auth.Identity{Name: *name}
+	var err error
+	if *scopes != "" {
+		if identity.Scopes, err = auth.ParseScopes(*scopes); err != nil {
+			return tokenError(stderr, "add", err)
+		}
+	}
+	if *notBefore != "" {
+		if identity.NotBefore, err = auth.ParseTokenTime(*notBefore); err != nil {
+			return tokenError(stderr, "add", fmt.Errorf("-not-before: %w", err))
+		}
+	}
+	if *expires != "" {
+		if identity.Expires, err = auth.ParseTokenTime(*expires); err != nil {
+			return tokenError(stderr, "add", fmt.Errorf("-expires: %w", err))
+		}
+	}
+
+	tokens, err := openTokenFile(*file)
+	if err != nil {
+		return tokenError(stderr, "add", err)
+	}
+	for _, entry := range tokens.Entries(nil) {
+		if entry.Err == nil && entry.Identity.Name == *name {
+			return tokenError(stderr, "add", fmt.Errorf("a token named %q already exists on line %d", *name, entry.Line))
+		}
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return tokenError(stderr, "add", err)
+	}
+	stored := token
+	if !*plain {
+		if stored, err = auth.HashToken(token); err != nil {
+			return tokenError(stderr, "add", err)
+		}
+	}
+	if err := tokens.Append(stored, identity); err != nil {
+		return tokenError(stderr, "add", err)
+	}
+	if err := tokens.Save(); err != nil {
+		return tokenError(stderr, "add", err)
+	}
+
+	entries := tokens.Entries(nil)
+	fmt.Fprintf(stdout, "added token %q\n", *name)
+	fmt.Fprintf(stdout, "token: %s\n", token)
+	if feedURL, err := personalFeedURL(*baseURL, token, entries[len(entries)-1].Identity.ID); err == nil {
+		fmt.Fprintf(stdout, "feed:  %s\n", feedURL)
+	} else {
+		fmt.Fprintf(stderr, "token add: no feed URL: %v\n", err)
+	}
+	if !*plain {
+		fmt.Fprintln(stderr, "Only a hash of the token was stored; it cannot be shown again.")
+	}
+	return 0
+}
+
+func runTokenList(args []string, stdout, stderr io.Writer) int {
+	flags := newTokenFlagSet("list", "", stderr)
+	file := flags.String("file", "", "token file to read (default PODCAST_TOKEN_FILE)")
+	if code, ok := parseTokenFlags(flags, args, 0); !ok {
+		return code
+	}
+
+	var defaults []auth.Scope
+	if value := config.TokenDefaultScopes(); value != "" {
+		var err error
+		if defaults, err = auth.ParseScopes(value); err != nil {
+			return tokenError(stderr, "list", fmt.Errorf("invalid PODCAST_TOKEN_DEFAULT_SCOPES: %w", err))
+		}
+	}
+	tokens, err := openTokenFile(*file)
+	if err != nil {
+		return tokenError(stderr, "list", err)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tNAME\tID\tSCOPES\tNOT BEFORE\tEXPIRES\tSTORED\tSTATUS")
+	for _, entry := range tokens.Entries(defaults) {
+		if entry.Err != nil {
+			fmt.Fprintf(w, "%d\t-\t-\t-\t-\t-\t-\tignored: %v\n", entry.Line, entry.Err)
+			continue
+		}
+		identity := entry.Identity
+		scopes := make([]string, 0, len(identity.Scopes))
+		for _, scope := range identity.Scopes {
+			scopes = append(scopes, string(scope))
+		}
+		stored := "plain"
+		if entry.Hashed {
+			stored = "hash"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Line, orDash(identity.Name), identity.ID, orDash(strings.Join(scopes, ",")),
+			formatListTime(identity.NotBefore), formatListTime(identity.Expires),
+			stored, tokenStatus(identity, now))
+	}
+	if err := w.Flush(); err != nil {
+		return tokenError(stderr, "list", err)
+	}
+	return 0
+}
+
+func runTokenRevoke(args []string, stdout, stderr io.Writer) int {
+	flags := newTokenFlagSet("revoke", "[-line n | name]", stderr)
+	file := flags.String("file", "", "token file to edit (default PODCAST_TOKEN_FILE)")
+	line := flags.Int("line", 0, "revoke the token on this line, as shown by list, instead of by name")
+	if code, ok := parseTokenFlags(flags, args, 1); !ok {
+		return code
+	}
+	if (flags.NArg() == 1) == (*line > 0) {
+		flags.Usage()
+		return 2
+	}
+
+	tokens, err := openTokenFile(*file)
+	if err != nil {
+		return tokenError(stderr, "revoke", err)
+	}
+	target := *line
+	if target == 0 {
+		entry, err := findToken(tokens, flags.Arg(0))
+		if err != nil {
+			return tokenError(stderr, "revoke", err)
+		}
+		target = entry.Line
+	}
+	if err := tokens.Remove(target); err != nil {
+		return tokenError(stderr, "revoke", err)
+	}
+	if err := tokens.Save(); err != nil {
+		return tokenError(stderr, "revoke", err)
+	}
+
+	fmt.Fprintf(stdout, "revoked the token on line %d\n", target)
+	return 0
+}
+
+func runTokenShowURL(args []string, stdout, stderr io.Writer) int {
+	flags := newTokenFlagSet("show-url", "<name>", stderr)
+	file := flags.String("file", "", "token file to read (default PODCAST_TOKEN_FILE)")
+	baseURL := flags.String("base-url", "", "public base URL for the feed address (default PODCAST_PUBLIC_URL)")
+	if code, ok := parseTokenFlags(flags, args, 1); !ok {
+		return code
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	tokens, err := openTokenFile(*file)
+	if err != nil {
+		return tokenError(stderr, "show-url", err)
+	}
+	entry, err := findToken(tokens, flags.Arg(0))
+	if err != nil {
+		return tokenError(stderr, "show-url", err)
+	}
+	token := entry.Token
+	if entry.Hashed {
+		token = ""
+	}
+	feedURL, err := personalFeedURL(*baseURL, token, entry.Identity.ID)
+	if err != nil {
+		return tokenError(stderr, "show-url", err)
+	}
+	fmt.Fprintln(stdout, feedURL)
+	return 0
+}
+
+func newTokenFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("token "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: home-podcast token %s [-file path] %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseTokenFlags parses args and checks that at most maxArgs positional
+// arguments remain. When ok is false the command should exit with code.
+func parseTokenFlags(flags *flag.FlagSet, args []string, maxArgs int) (code int, ok bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	if flags.NArg() > maxArgs {
+		flags.Usage()
+		return 2, false
+	}
+	return 0, true
+}
+
+func tokenError(stderr io.Writer, name string, err error) int {
+	fmt.Fprintf(stderr, "token %s: %v\n", name, err)
+	return 1
+}
+
+// openTokenFile reads path, or the configured token file when path is empty.
+func openTokenFile(path string) (*auth.TokenFile, error) {
+	if path == "" {
+		resolved, enabled, err := config.ResolveTokenFile()
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			return nil, errors.New("PODCAST_TOKEN_FILE is not set; pass -file")
+		}
+		path = resolved
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return auth.ReadTokenFile(abs)
+}
+
+// findToken returns the single well-formed entry called name.
+func findToken(tokens *auth.TokenFile, name string) (auth.TokenFileEntry, error) {
+	var matches []auth.TokenFileEntry
+	for _, entry := range tokens.Entries(nil) {
+		if entry.Err == nil && entry.Identity.Name == name {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return auth.TokenFileEntry{}, fmt.Errorf("no token named %q", name)
+	case 1:
+		return matches[0], nil
+	}
+	lines := make([]string, 0, len(matches))
+	for _, entry := range matches {
+		lines = append(lines, strconv.Itoa(entry.Line))
+	}
+	return auth.TokenFileEntry{}, fmt.Errorf("%d tokens are named %q, on lines %s; pick one with -line", len(matches), name, strings.Join(lines, ", "))
+}
+
+// personalFeedURL returns a subscriber's feed address under base, or under
+// PODCAST_PUBLIC_URL when base is empty. With PODCAST_URL_SIGNING_KEY set it
+// is a signed address naming the token by tokenID, as feeds use themselves;
+// otherwise it carries token, which is empty for tokens stored as hashes.
+func personalFeedURL(base, token, tokenID string) (string, error) {
+	key, err := config.URLSigningKey()
+	if err != nil {
+		return "", err
+	}
+	if key == "" && token == "" {
+		return "", errors.New("the token is stored as a hash; its feed URL was printed when it was added, or set PODCAST_URL_SIGNING_KEY for a signed one")
+	}
+
+	if base == "" {
+		if base, err = config.PublicURL(); err != nil {
+			return "", err
+		}
+		if base == "" {
+			return "", errors.New("PODCAST_PUBLIC_URL is not set; pass -base-url")
+		}
+	}
+	parsed, err := url.Parse(base)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("base URL %q must be an absolute http(s) URL", base)
+	}
+	if key != "" {
+		return server.SignedFeedURL(parsed, []byte(key), tokenID), nil
+	}
+	parsed.Path = strings.TrimRight(parsed.Path, "/") + "/feed"
+	parsed.RawQuery = url.Values{"token": {token}}.Encode()
+	return parsed.String(), nil
+}
+
+// tokenStatus describes whether the token is accepted at now.
+func tokenStatus(identity auth.Identity, now time.Time) string {
+	switch {
+	case !identity.NotBefore.IsZero() && now.Before(identity.NotBefore):
+		return "pending"
+	case !identity.ValidAt(now):
+		return "expired"
+	case identity.ReplacedBy != "":
+		return "active, replaced"
+	}
+	return "active"
+}
+
+func formatListTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
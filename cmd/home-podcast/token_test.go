@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"home-podcast/internal/auth"
+)
+
+const testSigningKey = "0123456789abcdef0123456789abcdef"
+
+func TestTokenSubcommands(t *testing.T) {
+	bobHash, err := auth.HashToken("bob-token")
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	existing := "# subscribers\n" +
+		"alice-token name=alice\n" +
+		bobHash + " name=bob\n"
+
+	tests := []struct {
+		name       string
+		args       []string
+		signingKey string
+		wantCode   int
+		// check inspects stdout and the token file afterwards.
+		check func(t *testing.T, stdout, file string)
+		// wantStderr is a substring expected on stderr.
+		wantStderr string
+	}{
+		{
+			name:     "add stores a hash",
+			args:     []string{"add", "-name", "carol", "-scopes", "read"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout, file string) {
+				line := lastLine(file)
+				if !strings.HasPrefix(line, "sha256:") || !strings.HasSuffix(line, " scopes=read name=carol") {
+					t.Fatalf("expected a hashed line for carol, got %q", line)
+				}
+				token := outputField(stdout, "token:")
+				if token == "" || strings.Contains(file, token) {
+					t.Fatalf("expected the token on stdout and only its hash in the file, got %q", stdout)
+				}
+				if !strings.Contains(outputField(stdout, "feed:"), url.Values{"token": {token}}.Encode()) {
+					t.Fatalf("expected a feed URL carrying the token, got %q", stdout)
+				}
+			},
+			wantStderr: "Only a hash of the token was stored",
+		},
+		{
+			name:     "add rejects a duplicate name",
+			args:     []string{"add", "-name", "alice"},
+			wantCode: 1,
+			check: func(t *testing.T, stdout, file string) {
+				if file != existing {
+					t.Fatalf("expected the file to be unchanged, got %q", file)
+				}
+			},
+			wantStderr: `a token named "alice" already exists on line 2`,
+		},
+		{
+			name:     "revoke removes the named token",
+			args:     []string{"revoke", "alice"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout, file string) {
+				if strings.Contains(file, "name=alice") || !strings.Contains(file, "# subscribers\n") || !strings.Contains(file, "name=bob") {
+					t.Fatalf("expected only alice's line to be removed, got %q", file)
+				}
+				if stdout != "revoked the token on line 2\n" {
+					t.Fatalf("unexpected output %q", stdout)
+				}
+			},
+		},
+		{
+			name:     "revoke reports an unknown name",
+			args:     []string{"revoke", "mallory"},
+			wantCode: 1,
+			check: func(t *testing.T, stdout, file string) {
+				if file != existing {
+					t.Fatalf("expected the file to be unchanged, got %q", file)
+				}
+			},
+			wantStderr: `no token named "mallory"`,
+		},
+		{
+			name:     "show-url prints the token URL of a plain token",
+			args:     []string{"show-url", "alice"},
+			wantCode: 0,
+			check: func(t *testing.T, stdout, file string) {
+				if stdout != "https://podcast.example/base/feed?token=alice-token\n" {
+					t.Fatalf("unexpected output %q", stdout)
+				}
+			},
+		},
+		{
+			name:       "show-url refuses a hashed token without signing",
+			args:       []string{"show-url", "bob"},
+			wantCode:   1,
+			wantStderr: "PODCAST_URL_SIGNING_KEY",
+		},
+		{
+			name:       "show-url signs a hashed token",
+			args:       []string{"show-url", "bob"},
+			signingKey: testSigningKey,
+			wantCode:   0,
+			check: func(t *testing.T, stdout, file string) {
+				assertSignedFeedURL(t, strings.TrimSpace(stdout))
+			},
+		},
+		{
+			name:       "show-url signs a plain token",
+			args:       []string{"show-url", "alice"},
+			signingKey: testSigningKey,
+			wantCode:   0,
+			check: func(t *testing.T, stdout, file string) {
+				assertSignedFeedURL(t, strings.TrimSpace(stdout))
+			},
+		},
+		{
+			name:       "add prints a signed feed URL",
+			args:       []string{"add", "-name", "carol"},
+			signingKey: testSigningKey,
+			wantCode:   0,
+			check: func(t *testing.T, stdout, file string) {
+				assertSignedFeedURL(t, outputField(stdout, "feed:"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PODCAST_URL_SIGNING_KEY", tt.signingKey)
+			t.Setenv("PODCAST_TOKEN_DEFAULT_SCOPES", "")
+			path := filepath.Join(t.TempDir(), "tokens")
+			if err := os.WriteFile(path, []byte(existing), 0o600); err != nil {
+				t.Fatalf("write token file: %v", err)
+			}
+
+			// Flags precede the arguments; revoke takes no -base-url.
+			args := []string{"token", tt.args[0], "-file", path}
+			if tt.args[0] != "revoke" {
+				args = append(args, "-base-url", "https://podcast.example/base/")
+			}
+			args = append(args, tt.args[1:]...)
+			var stdout, stderr bytes.Buffer
+			if code := run(args, &stdout, &stderr); code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d: %s", tt.wantCode, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("expected %q on stderr, got %q", tt.wantStderr, stderr.String())
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read token file: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, stdout.String(), string(data))
+			}
+		})
+	}
+}
+
+// assertSignedFeedURL checks that raw is a permanently signed feed address
+// under the test base URL that carries no token.
+func assertSignedFeedURL(t *testing.T, raw string) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	query := u.Query()
+	if u.Host != "podcast.example" || u.Path != "/base/feed" {
+		t.Fatalf("expected the feed under the base URL, got %q", raw)
+	}
+	if query.Get("sig") == "" || query.Get("kid") == "" || query.Has("token") || query.Has("exp") {
+		t.Fatalf("expected a permanent signed URL without a token, got %q", raw)
+	}
+}
+
+func lastLine(file string) string {
+	lines := strings.Split(strings.TrimSuffix(file, "\n"), "\n")
+	return lines[len(lines)-1]
+}
+
+// outputField returns the value printed after label on its own line.
+func outputField(stdout, label string) string {
+	for _, line := range strings.Split(stdout, "\n") {
+		if value, ok := strings.CutPrefix(line, label); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashPrefix marks a token file entry holding a salted SHA-256 hash instead
+// of the token itself: sha256:<hex salt>:<hex digest of salt+token>.
+const hashPrefix = "sha256:"
+
+// saltSize and tokenSize are in bytes. Generated tokens carry 256 bits of
+// randomness, which is why a fast hash is enough to protect them.
+const (
+	saltSize  = 16
+	tokenSize = 32
+)
+
+// GenerateToken returns a new random token, URL-safe so it can sit in feed
+// URLs unescaped.
+func GenerateToken() (string, error) {
+	buf := make([]byte, tokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the token file entry that accepts token without
+// revealing it.
+func HashToken(token string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	digest := saltedDigest(salt, token)
+	return hashPrefix + hex.EncodeToString(salt) + ":" + hex.EncodeToString(digest[:]), nil
+}
+
+func saltedDigest(salt []byte, token string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(token))
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	return digest
+}
+
+// tokenIDPrefix separates the digests behind token IDs from any other use
+// of SHA-256 over the same bytes.
+const tokenIDPrefix = "home-podcast token id\x00"
+
+// tokenEntry is one accepted token. Plaintext entries are stored as their
+// unsalted digest so every entry is checked the same way.
+type tokenEntry struct {
+	salt     []byte
+	digest   [sha256.Size]byte
+	identity Identity
+	// token is kept for plaintext entries only, so a successor listed in
+	// plain text can be handed out to the subscribers it replaces.
+	token string
+	// line is the entry's line number in the token file.
+	line int
+}
+
+// label names the entry in logs without revealing the token.
+func (e tokenEntry) label() string {
+	if e.identity.Name != "" {
+		return fmt.Sprintf("%q", e.identity.Name)
+	}
+	return fmt.Sprintf("on line %d", e.line)
+}
+
+func newTokenEntry(token string, identity Identity) (tokenEntry, error) {
+	encoded, ok := strings.CutPrefix(token, hashPrefix)
+	if !ok {
+		entry := tokenEntry{digest: sha256.Sum256([]byte(token)), identity: identity, token: token}
+		entry.identity.ID = entry.id()
+		return entry, nil
+	}
+
+	saltHex, digestHex, ok := strings.Cut(encoded, ":")
+	if !ok {
+		return tokenEntry{}, errors.New("hash entry is not sha256:<salt>:<digest>")
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil || len(salt) == 0 {
+		return tokenEntry{}, errors.New("hash entry has an invalid salt")
+	}
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil || len(digest) != sha256.Size {
+		return tokenEntry{}, errors.New("hash entry has an invalid digest")
+	}
+
+	entry := tokenEntry{salt: salt, identity: identity}
+	copy(entry.digest[:], digest)
+	entry.identity.ID = entry.id()
+	return entry, nil
+}
+
+// id derives the entry's public identifier from its stored digest, so it
+// can be handed out without helping anyone recover the token.
+func (e tokenEntry) id() string {
+	h := sha256.New()
+	h.Write([]byte(tokenIDPrefix))
+	h.Write(e.salt)
+	h.Write(e.digest[:])
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:12])
+}
+
+// tokenSet holds the entries loaded from one version of the token file.
+// Tokens that verified once are remembered by their digest, so repeated
+// requests such as audio range requests cost one hash and a map lookup.
+type tokenSet struct {
+	entries []tokenEntry
+
+	byID map[string]int
+	// successors maps replaced entries to the entry their replaced_by
+	// names.
+	successors map[int]int
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]Identity
+	// reported records the expiry notices already logged per entry.
+	reported map[int]expiryNotice
+}
+
+// expiryNotice is the stage of its lifetime an entry was last reported in.
+type expiryNotice int
+
+const (
+	noticeNone expiryNotice = iota
+	noticeExpiring
+	noticeExpired
+)
+
+func newTokenSet(entries []tokenEntry) *tokenSet {
+	byID := make(map[string]int, len(entries))
+	byName := make(map[string]int)
+	for i, entry := range entries {
+		byID[entry.identity.ID] = i
+		if entry.identity.Name != "" {
+			byName[entry.identity.Name] = i
+		}
+	}
+
+	successors := make(map[int]int)
+	for i, entry := range entries {
+		ref := entry.identity.ReplacedBy
+		if ref == "" {
+			continue
+		}
+		j, ok := byName[ref]
+		if !ok {
+			j, ok = byID[ref]
+		}
+		if ok && j != i {
+			successors[i] = j
+		}
+	}
+
+	return &tokenSet{
+		entries:    entries,
+		byID:       byID,
+		successors: successors,
+		verified:   make(map[[sha256.Size]byte]Identity),
+		reported:   make(map[int]expiryNotice),
+	}
+}
+
+// identify checks token against every entry with constant-time comparisons
+// and returns its identity if the token is valid at now. When several entries
+// match, the last one in the file wins.
+func (s *tokenSet) identify(token string, now time.Time) (Identity, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	s.mu.Lock()
+	identity, ok := s.verified[key]
+	s.mu.Unlock()
+	if ok {
+		return identity, identity.ValidAt(now)
+	}
+
+	match := -1
+	for i, entry := range s.entries {
+		digest := key
+		if entry.salt != nil {
+			digest = saltedDigest(entry.salt, token)
+		}
+		if subtle.ConstantTimeCompare(digest[:], entry.digest[:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return Identity{}, false
+	}
+
+	identity = s.entries[match].identity
+	s.mu.Lock()
+	s.verified[key] = identity
+	s.mu.Unlock()
+	return identity, identity.ValidAt(now)
+}
+
+// identifyID returns the identity of the entry with the given ID if it is
+// valid at now. Entries sharing a token share an ID; the last one wins, as
+// in identify.
+func (s *tokenSet) identifyID(id string, now time.Time) (Identity, bool) {
+	i, ok := s.byID[id]
+	if !ok {
+		return Identity{}, false
+	}
+	identity := s.entries[i].identity
+	return identity, identity.ValidAt(now)
+}
+
+// successor returns the token and identity of the entry replacing the one
+// with the given ID, if the successor is valid at now. The token is empty
+// when the successor is stored as a hash.
+func (s *tokenSet) successor(id string, now time.Time) (string, Identity, bool) {
+	i, ok := s.byID[id]
+	if !ok {
+		return "", Identity{}, false
+	}
+	j, ok := s.successors[i]
+	if !ok {
+		return "", Identity{}, false
+	}
+	entry := s.entries[j]
+	if !entry.identity.ValidAt(now) {
+		return "", Identity{}, false
+	}
+	return entry.token, entry.identity, true
+}
+
+// reportExpiry logs, once per stage, tokens that expire within warning of
+// now and tokens that have expired.
+func (s *tokenSet) reportExpiry(now time.Time, warning time.Duration, logf func(format string, args ...any)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, entry := range s.entries {
+		expires := entry.identity.Expires
+		if expires.IsZero() {
+			continue
+		}
+		switch {
+		case !now.Before(expires):
+			if s.reported[i] < noticeExpired {
+				logf("token %s expired at %s", entry.label(), expires.Format(time.RFC3339))
+				s.reported[i] = noticeExpired
+			}
+		case expires.Sub(now) <= warning:
+			if s.reported[i] < noticeExpiring {
+				logf("warning: token %s expires in %s, at %s", entry.label(), expires.Sub(now).Round(time.Minute), expires.Format(time.RFC3339))
+				s.reported[i] = noticeExpiring
+			}
+		}
+	}
+}
+
+func (s *tokenSet) len() int {
+	return len(s.entries)
+}
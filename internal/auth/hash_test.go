@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateAndHashToken(t *testing.T) {
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if len(token) != 43 || strings.ContainsAny(token, "+/=") {
+		t.Fatalf("expected 43 URL-safe characters, got %q", token)
+	}
+	if other, _ := GenerateToken(); other == token {
+		t.Fatalf("expected distinct tokens")
+	}
+
+	first, err := HashToken(token)
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	second, _ := HashToken(token)
+	if !strings.HasPrefix(first, "sha256:") || first == second {
+		t.Fatalf("expected distinct salted hashes, got %q and %q", first, second)
+	}
+	if strings.Contains(first, token) {
+		t.Fatalf("hash line reveals the token")
+	}
+}
+
+func TestTokenStoreAcceptsHashes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+
+	hashed, err := HashToken("hashed-secret")
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	writeTokenFile(t, file, strings.Join([]string{
+		"legacy-secret",
+		hashed + " scopes=read name=grandma",
+		"sha256:zz:00",
+		"sha256:00ff",
+		"sha256:00ff:abcd",
+	}, "\n"))
+
+	var logs strings.Builder
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(&logs, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if !store.IsValidToken("legacy-secret") {
+		t.Fatalf("expected plaintext entries to keep working")
+	}
+	for range 2 {
+		identity, ok := store.Identify("hashed-secret")
+		if !ok || identity.Name != "grandma" || !slices.Equal(identity.Scopes, []Scope{ScopeRead}) {
+			t.Fatalf("expected hashed token to verify, got %+v %v", identity, ok)
+		}
+	}
+	for _, token := range []string{hashed, "hashed-secre", "hashed-secret2", "sha256:00ff:abcd"} {
+		if store.IsValidToken(token) {
+			t.Fatalf("expected %q to be rejected", token)
+		}
+	}
+	for _, line := range []string{"line 3 ignored", "line 4 ignored", "line 5 ignored"} {
+		if !strings.Contains(logs.String(), line) {
+			t.Fatalf("expected malformed hash to be reported as %q, got %q", line, logs.String())
+		}
+	}
+
+	writeTokenFile(t, file, "legacy-secret\n")
+	waitForToken(t, store, "hashed-secret", false)
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Scope is a permission a token grants.
+type Scope string
+
+const (
+	// ScopeRead allows fetching feeds, episodes, audio and related files.
+	ScopeRead Scope = "read"
+	// ScopeUpload allows adding audio files through the upload form.
+	ScopeUpload Scope = "upload"
+	// ScopeDelete allows removing audio files.
+	ScopeDelete Scope = "delete"
+)
+
+// AllScopes lists every scope a token can hold.
+var AllScopes = []Scope{ScopeRead, ScopeUpload, ScopeDelete}
+
+// Identity describes the holder of a valid token.
+type Identity struct {
+	// Name labels the token in logs; it is empty unless the token file sets
+	// one.
+	Name   string
+	Scopes []Scope
+	// NotBefore and Expires bound when the token is accepted. Zero values
+	// leave that side open.
+	NotBefore time.Time
+	Expires   time.Time
+	// ReplacedBy names the token file entry that succeeds this one, by its
+	// name or ID. Feeds requested with this token hand out the successor so
+	// subscribers migrate to it.
+	ReplacedBy string
+	// ID identifies the token file entry without revealing the token, for
+	// use in URLs that must not carry the token itself. It stays the same
+	// for as long as the entry's token does.
+	ID string
+}
+
+// Has reports whether the identity was granted scope.
+func (i Identity) Has(scope Scope) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// ValidAt reports whether the token is accepted at t.
+func (i Identity) ValidAt(t time.Time) bool {
+	if !i.NotBefore.IsZero() && t.Before(i.NotBefore) {
+		return false
+	}
+	return i.Expires.IsZero() || t.Before(i.Expires)
+}
+
+// ParseScopes reads a comma-separated scope list such as "read,upload".
+// Unknown scopes are an error so that a typo cannot silently widen or narrow
+// access.
+func ParseScopes(value string) ([]Scope, error) {
+	var scopes []Scope
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		scope := Scope(part)
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", part)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// tokenFields lists the fields a token file line may carry after the token.
+var tokenFields = []string{"scopes", "name", "not_before", "expires", "replaced_by"}
+
+// parseTokenLine reads one line of the token file: the token, optionally
+// followed by scopes=, name=, not_before=, expires= and replaced_by= fields.
+// A line holding only a token is granted defaultScopes. A line without any
+// of those fields is read whole as one token, as every line was before the
+// file had fields, so tokens containing spaces keep working.
+func parseTokenLine(line string, defaultScopes []Scope) (string, Identity, error) {
+	fields := strings.Fields(line)
+	token := fields[0]
+	identity := Identity{Scopes: defaultScopes}
+	if !slices.ContainsFunc(fields[1:], isTokenField) {
+		return line, identity, nil
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", Identity{}, fmt.Errorf("field %q is not key=value", field)
+		}
+		key = strings.ToLower(key)
+		switch key {
+		case "scopes":
+			scopes, err := ParseScopes(value)
+			if err != nil {
+				return "", Identity{}, err
+			}
+			identity.Scopes = scopes
+		case "name":
+			identity.Name = value
+		case "not_before", "expires":
+			t, err := ParseTokenTime(value)
+			if err != nil {
+				return "", Identity{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "expires" {
+				identity.Expires = t
+			} else {
+				identity.NotBefore = t
+			}
+		case "replaced_by":
+			if value == "" || strings.HasPrefix(value, hashPrefix) {
+				return "", Identity{}, errors.New("replaced_by must name the successor by its name or ID")
+			}
+			identity.ReplacedBy = value
+		default:
+			return "", Identity{}, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return token, identity, nil
+}
+
+// isTokenField reports whether field sets one of tokenFields.
+func isTokenField(field string) bool {
+	key, _, ok := strings.Cut(field, "=")
+	return ok && slices.Contains(tokenFields, strings.ToLower(key))
+}
+
+// isComment reports whether a trimmed token file line is a comment. A single
+// word starting with # is not: it is read as a token, as it was before the
+// file had comments; see isHashToken.
+func isComment(line string) bool {
+	return strings.HasPrefix(line, "#") && !isHashToken(line)
+}
+
+// isHashToken reports whether a trimmed token file line is a single word
+// starting with #, which is read as a token. Such tokens are deprecated
+// because they look like comments.
+func isHashToken(line string) bool {
+	return len(line) > 1 && line[0] == '#' && !strings.ContainsFunc(line, unicode.IsSpace)
+}
+
+// ParseTokenTime reads a not_before or expires value: an RFC 3339 time or a
+// plain date, which means midnight UTC.
+func ParseTokenTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an RFC 3339 time", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"home-podcast/internal/fsutil"
+)
+
+// TokenFile is an editable copy of a token file. Edits keep comments, blank
+// lines and the order of the remaining entries, and Save replaces the file
+// atomically so a running TokenStore never reads it half-written.
+type TokenFile struct {
+	path  string
+	lines []string
+	perm  os.FileMode
+}
+
+// TokenFileEntry is one token line of a TokenFile.
+type TokenFileEntry struct {
+	// Line is the 1-based line number in the file.
+	Line int
+	// Token is the token itself, or its sha256: hash when Hashed is set.
+	Token    string
+	Hashed   bool
+	Identity Identity
+	// Err is set when the line is malformed; TokenStore ignores such lines.
+	Err error
+}
+
+// ReadTokenFile loads the token file at path. A missing file reads as an
+// empty one, created with owner-only permissions on Save.
+func ReadTokenFile(path string) (*TokenFile, error) {
+	f := &TokenFile{path: path, perm: 0o600}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return f, nil
+		}
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		f.perm = info.Mode().Perm()
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	if content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f, nil
+}
+
+// Entries returns the token lines in file order. Lines without a scopes
+// field are reported with defaultScopes, or every scope when it is nil.
+func (f *TokenFile) Entries(defaultScopes []Scope) []TokenFileEntry {
+	if defaultScopes == nil {
+		defaultScopes = AllScopes
+	}
+
+	var entries []TokenFileEntry
+	for i, line := range f.lines {
+		line = strings.TrimSpace(line)
+		if line == "" || isComment(line) {
+			continue
+		}
+		entry := TokenFileEntry{Line: i + 1}
+		entry.Token, entry.Identity, entry.Err = parseTokenLine(line, defaultScopes)
+		if entry.Err == nil {
+			var parsed tokenEntry
+			parsed, entry.Err = newTokenEntry(entry.Token, entry.Identity)
+			entry.Identity.ID = parsed.identity.ID
+		}
+		entry.Hashed = strings.HasPrefix(entry.Token, hashPrefix)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Append adds a line for token at the end of the file. token may be a hash
+// produced by HashToken.
+func (f *TokenFile) Append(token string, identity Identity) error {
+	line, err := FormatTokenLine(token, identity)
+	if err != nil {
+		return err
+	}
+	f.lines = append(f.lines, line)
+	return nil
+}
+
+// Remove deletes the token on the given 1-based line. Comments and blank
+// lines cannot be removed this way.
+func (f *TokenFile) Remove(line int) error {
+	if line < 1 || line > len(f.lines) {
+		return fmt.Errorf("line %d is outside the token file", line)
+	}
+	text := strings.TrimSpace(f.lines[line-1])
+	if text == "" || isComment(text) {
+		return fmt.Errorf("line %d holds no token", line)
+	}
+	f.lines = append(f.lines[:line-1], f.lines[line:]...)
+	return nil
+}
+
+// SetExpires sets the expires field of the token on the given 1-based line,
+// keeping its other fields.
+func (f *TokenFile) SetExpires(line int, expires time.Time) error {
+	if line < 1 || line > len(f.lines) {
+		return fmt.Errorf("line %d is outside the token file", line)
+	}
+	text := strings.TrimSpace(f.lines[line-1])
+	if text == "" || isComment(text) {
+		return fmt.Errorf("line %d holds no token", line)
+	}
+	// Without default scopes a line lacking scopes= is written back without.
+	token, identity, err := parseTokenLine(text, nil)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	identity.Expires = expires
+	formatted, err := FormatTokenLine(token, identity)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	f.lines[line-1] = formatted
+	return nil
+}
+
+// Save writes the file back through a temporary file in the same directory
+// that is renamed over the original.
+func (f *TokenFile) Save() error {
+	var b strings.Builder
+	for _, line := range f.lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return fsutil.WriteFileAtomic(f.path, []byte(b.String()), f.perm)
+}
+
+// FormatTokenLine returns the token file line granting identity to token.
+// Scopes are written only when set, so a nil Scopes field leaves the line
+// to PODCAST_TOKEN_DEFAULT_SCOPES.
+func FormatTokenLine(token string, identity Identity) (string, error) {
+	if token == "" || strings.ContainsFunc(token, unicode.IsSpace) {
+		return "", errors.New("token must be non-empty and free of whitespace")
+	}
+	fields := []string{token}
+	if identity.Scopes != nil {
+		names := make([]string, 0, len(identity.Scopes))
+		for _, scope := range identity.Scopes {
+			names = append(names, string(scope))
+		}
+		fields = append(fields, "scopes="+strings.Join(names, ","))
+	}
+	if identity.Name != "" {
+		if strings.ContainsFunc(identity.Name, unicode.IsSpace) {
+			return "", fmt.Errorf("name %q must not contain whitespace", identity.Name)
+		}
+		fields = append(fields, "name="+identity.Name)
+	}
+	if !identity.NotBefore.IsZero() {
+		fields = append(fields, "not_before="+formatTokenTime(identity.NotBefore))
+	}
+	if !identity.Expires.IsZero() {
+		fields = append(fields, "expires="+formatTokenTime(identity.Expires))
+	}
+	if identity.ReplacedBy != "" {
+		fields = append(fields, "replaced_by="+identity.ReplacedBy)
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// formatTokenTime writes midnight UTC as a plain date and anything else as
+// an RFC 3339 time.
+func formatTokenTime(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
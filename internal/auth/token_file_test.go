@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenFileEditsPreserveLayout(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	original := strings.Join([]string{
+		"# household",
+		"legacy",
+		"",
+		"# admin",
+		"adm scopes=read,upload,delete name=alice",
+		"broken scopes=write",
+		"",
+	}, "\n")
+	if err := os.WriteFile(file, []byte(original), 0o640); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+
+	tokens, err := ReadTokenFile(file)
+	if err != nil {
+		t.Fatalf("ReadTokenFile: %v", err)
+	}
+	entries := tokens.Entries([]Scope{ScopeRead})
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if entries[0].Line != 2 || entries[0].Token != "legacy" || len(entries[0].Identity.Scopes) != 1 {
+		t.Fatalf("unexpected first entry %+v", entries[0])
+	}
+	if entries[1].Line != 5 || entries[1].Identity.Name != "alice" {
+		t.Fatalf("unexpected second entry %+v", entries[1])
+	}
+	if want, _ := newTokenEntry("adm", Identity{}); entries[1].Identity.ID != want.identity.ID {
+		t.Fatalf("expected the entry to carry the ID the store uses, got %+v", entries[1])
+	}
+	if entries[2].Line != 6 || entries[2].Err == nil {
+		t.Fatalf("expected malformed line to carry an error, got %+v", entries[2])
+	}
+
+	hashed, err := HashToken("grandma-secret")
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	identity := Identity{
+		Name:    "grandma",
+		Scopes:  []Scope{ScopeRead},
+		Expires: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := tokens.Append(hashed, identity); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := tokens.Remove(5); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := tokens.Remove(4); err == nil {
+		t.Fatalf("expected removing a comment to fail")
+	}
+	if err := tokens.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read token file: %v", err)
+	}
+	want := strings.Join([]string{
+		"# household",
+		"legacy",
+		"",
+		"# admin",
+		"broken scopes=write",
+		hashed + " scopes=read name=grandma expires=2027-01-01",
+		"",
+	}, "\n")
+	if string(data) != want {
+		t.Fatalf("unexpected token file:\n%s\nwant:\n%s", data, want)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("expected permissions to be kept, got %v %v", info.Mode(), err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(leftovers) > 0 {
+		t.Fatalf("expected no temporary files, found %v", leftovers)
+	}
+
+	reread, err := ReadTokenFile(file)
+	if err != nil {
+		t.Fatalf("ReadTokenFile: %v", err)
+	}
+	last := reread.Entries(nil)[2]
+	if last.Err != nil || !last.Hashed || last.Identity.Name != "grandma" || !last.Identity.Expires.Equal(identity.Expires) {
+		t.Fatalf("expected appended entry to round-trip, got %+v", last)
+	}
+}
+
+func TestTokenFileCreatesMissingFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.txt")
+	tokens, err := ReadTokenFile(file)
+	if err != nil {
+		t.Fatalf("ReadTokenFile: %v", err)
+	}
+	if len(tokens.Entries(nil)) != 0 {
+		t.Fatalf("expected no entries in a missing file")
+	}
+	if err := tokens.Append("alpha", Identity{Name: "a b"}); err == nil {
+		t.Fatalf("expected names with spaces to be rejected")
+	}
+	notBefore := time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := tokens.Append("alpha", Identity{NotBefore: notBefore, ReplacedBy: "beta"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := tokens.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read token file: %v", err)
+	}
+	if string(data) != "alpha not_before=2026-05-01T12:30:00Z replaced_by=beta\n" {
+		t.Fatalf("unexpected token file %q", data)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a new token file to be private, got %v", info.Mode())
+	}
+
+	if err := tokens.SetExpires(1, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("SetExpires: %v", err)
+	}
+	if entries := tokens.Entries(nil); entries[0].Identity.Expires.IsZero() || entries[0].Identity.ReplacedBy != "beta" {
+		t.Fatalf("expected SetExpires to keep the other fields, got %+v", entries[0])
+	}
+	if err := tokens.SetExpires(2, time.Now()); err == nil {
+		t.Fatalf("expected SetExpires outside the file to fail")
+	}
+}
+
+func TestTokenStoreSeesAtomicSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens.txt")
+	writeTokenFile(t, file, "alpha\n")
+
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	tokens, err := ReadTokenFile(file)
+	if err != nil {
+		t.Fatalf("ReadTokenFile: %v", err)
+	}
+	if err := tokens.Append("beta", Identity{Name: "beta"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := tokens.Remove(1); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := tokens.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	waitForToken(t, store, "beta", true)
+	waitForToken(t, store, "alpha", false)
+}
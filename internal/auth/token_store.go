@@ -3,24 +3,60 @@ package auth
 import (
 	"errors"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// Options tunes how a TokenStore interprets the token file.
+type Options struct {
+	// DefaultScopes are granted to tokens listed without a scopes field.
+	// Nil grants every scope, as plain token files always have.
+	DefaultScopes []Scope
+	// ExpiryWarning is how long before its expiry a token is reported in the
+	// log. Zero selects defaultExpiryWarning.
+	ExpiryWarning time.Duration
+	// CheckInterval is how often expiry dates are re-evaluated for logging.
+	// Expiry itself is enforced on every check. Zero selects
+	// defaultExpiryCheckInterval.
+	CheckInterval time.Duration
+	// ReplacementGrace is how long a token keeps working once the store
+	// has seen its replaced_by successor, or once the successor's
+	// not_before has passed if that is later. The end is written to the
+	// token's expires field, so restarts do not extend it; an earlier
+	// expires still applies. Zero selects defaultReplacementGrace.
+	ReplacementGrace time.Duration
+}
+
+const (
+	defaultExpiryWarning       = 7 * 24 * time.Hour
+	defaultExpiryCheckInterval = time.Hour
+	defaultReplacementGrace    = 30 * 24 * time.Hour
+)
+
 // TokenStore manages a set of authorized feed tokens backed by a single file on disk.
 type TokenStore struct {
 	file         string
 	logger       *log.Logger
 	watcher      *fsnotify.Watcher
 	refreshDelay time.Duration
+	defaults     []Scope
+	warning      time.Duration
+	interval     time.Duration
+	grace        time.Duration
 
 	mu     sync.RWMutex
-	tokens map[string]struct{}
+	tokens *tokenSet
+	// replacedSince records when each replacement, keyed by the IDs of the
+	// old and the new entry, was first loaded.
+	replacedSince map[string]time.Time
 
 	refreshMu    sync.Mutex
 	refreshTimer *time.Timer
@@ -31,8 +67,14 @@ type TokenStore struct {
 }
 
 // NewTokenStore creates a TokenStore backed by the provided token file path.
-// Each non-empty trimmed line inside the file is treated as a valid token.
-func NewTokenStore(filePath string, debounce time.Duration, logger *log.Logger) (*TokenStore, error) {
+// Each non-empty line holds a token, or a sha256:<salt>:<digest> hash of one
+// as produced by HashToken, optionally followed by whitespace separated
+// scopes=read,upload,delete, name=<label>, not_before=<time>,
+// expires=<time> and replaced_by=<name or ID> fields. Times are RFC 3339 or plain
+// dates. Lines without any of those fields are read whole as one token.
+// Lines starting with # are comments, except for single words, which are
+// read as tokens and logged as deprecated.
+func NewTokenStore(filePath string, debounce time.Duration, logger *log.Logger, opts Options) (*TokenStore, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -41,13 +83,29 @@ func NewTokenStore(filePath string, debounce time.Duration, logger *log.Logger)
 	if logger == nil {
 		logger = log.Default()
 	}
+	if opts.DefaultScopes == nil {
+		opts.DefaultScopes = AllScopes
+	}
+	if opts.ExpiryWarning <= 0 {
+		opts.ExpiryWarning = defaultExpiryWarning
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultExpiryCheckInterval
+	}
+	if opts.ReplacementGrace <= 0 {
+		opts.ReplacementGrace = defaultReplacementGrace
+	}
 
 	s := &TokenStore{
 		file:         filepath.Clean(filePath),
 		logger:       logger,
 		watcher:      watcher,
 		refreshDelay: debounce,
-		tokens:       make(map[string]struct{}),
+		defaults:     opts.DefaultScopes,
+		warning:      opts.ExpiryWarning,
+		interval:     opts.CheckInterval,
+		grace:        opts.ReplacementGrace,
+		tokens:       newTokenSet(nil),
 		done:         make(chan struct{}),
 	}
 
@@ -92,22 +150,33 @@ func (s *TokenStore) Close() error {
 
 // IsValidToken reports whether the provided token is authorized.
 func (s *TokenStore) IsValidToken(token string) bool {
+	_, ok := s.Identify(token)
+	return ok
+}
+
+// Identify returns the identity the token file grants the provided token.
+func (s *TokenStore) Identify(token string) (Identity, bool) {
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return false
+		return Identity{}, false
 	}
 
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, ok := s.tokens[token]
-	return ok
+	tokens := s.tokens
+	s.mu.RUnlock()
+	return tokens.identify(token, time.Now())
 }
 
 func (s *TokenStore) run() {
 	defer s.wg.Done()
 
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ticker.C:
+			s.checkExpiry()
 		case event, ok := <-s.watcher.Events:
 			if !ok {
 				return
@@ -163,11 +232,16 @@ func (s *TokenStore) scheduleRefresh() {
 }
 
 func (s *TokenStore) refresh() error {
+	return s.refreshAt(time.Now())
+}
+
+// refreshAt loads the token file as of now.
+func (s *TokenStore) refreshAt(now time.Time) error {
 	data, err := os.ReadFile(s.file)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			s.mu.Lock()
-			s.tokens = make(map[string]struct{})
+			s.tokens = newTokenSet(nil)
 			s.mu.Unlock()
 			s.logger.Printf("token file %s missing; no tokens loaded", s.file)
 			return nil
@@ -176,18 +250,159 @@ func (s *TokenStore) refresh() error {
 	}
 
 	lines := strings.Split(string(data), "\n")
-	tokens := make(map[string]struct{}, len(lines))
-	for _, line := range lines {
-		token := strings.TrimSpace(line)
-		if token != "" {
-			tokens[token] = struct{}{}
+	entries := make([]tokenEntry, 0, len(lines))
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if isComment(line) {
+			continue
+		}
+		// The line holds a secret, so only its position is logged.
+		if isHashToken(line) {
+			s.logger.Printf("token file %s line %d: tokens starting with # are deprecated since they look like comments; replace it", s.file, i+1)
+		}
+		token, identity, err := parseTokenLine(line, s.defaults)
+		if err != nil {
+			s.logger.Printf("token file %s line %d ignored: %v", s.file, i+1, err)
+			continue
+		}
+		if strings.ContainsFunc(token, unicode.IsSpace) {
+			s.logger.Printf("token file %s line %d has no scopes=, name=, not_before=, expires= or replaced_by= field and is read whole as one token", s.file, i+1)
+		}
+		entry, err := newTokenEntry(token, identity)
+		if err != nil {
+			s.logger.Printf("token file %s line %d ignored: %v", s.file, i+1, err)
+			continue
+		}
+		entry.line = i + 1
+		entries = append(entries, entry)
+	}
+	tokens := newTokenSet(entries)
+	for i, entry := range tokens.entries {
+		if _, ok := tokens.successors[i]; entry.identity.ReplacedBy != "" && !ok {
+			s.logger.Printf("token %s: replaced_by matches no other token's name or ID; ignored", entry.label())
 		}
 	}
 
 	s.mu.Lock()
+	ends := s.limitReplacements(tokens, now)
 	s.tokens = tokens
 	s.mu.Unlock()
 
-	s.logger.Printf("loaded %d feed tokens", len(tokens))
+	s.logger.Printf("loaded %d feed tokens", tokens.len())
+	s.recordReplacementEnds(tokens, ends)
+	s.checkExpiry()
 	return nil
 }
+
+// IdentifyID returns the identity of the token whose Identity.ID is id,
+// provided the token is still listed and currently valid. It is a map lookup,
+// cheap enough to run for every request that carries an ID instead of a
+// token.
+func (s *TokenStore) IdentifyID(id string) (Identity, bool) {
+	s.mu.RLock()
+	tokens := s.tokens
+	s.mu.RUnlock()
+	return tokens.identifyID(id, time.Now())
+}
+
+// Successor returns the token replacing the one whose Identity.ID is id, and
+// its identity, provided the successor is currently valid. The token is
+// empty when the successor is stored as a hash; it can then only be handed
+// out by its ID, in signed URLs.
+func (s *TokenStore) Successor(id string) (string, Identity, bool) {
+	s.mu.RLock()
+	tokens := s.tokens
+	s.mu.RUnlock()
+	return tokens.successor(id, time.Now())
+}
+
+// limitReplacements bounds the grace period of every replaced token in
+// tokens, bringing its expiry forward to the end of the period. The
+// period starts when this store first loaded the replacement and is
+// carried across reloads of the file. It returns the entries whose expires
+// field in the file ends later than their grace period, by index, so the
+// end can be recorded there and survive restarts. Callers hold s.mu.
+func (s *TokenStore) limitReplacements(tokens *tokenSet, now time.Time) map[int]time.Time {
+	ends := make(map[int]time.Time)
+	since := make(map[string]time.Time, len(tokens.successors))
+	for i, j := range tokens.successors {
+		old := &tokens.entries[i].identity
+		successor := tokens.entries[j].identity
+
+		key := old.ID + "\x00" + successor.ID
+		start, ok := s.replacedSince[key]
+		if !ok {
+			start = now
+		}
+		since[key] = start
+
+		if successor.NotBefore.After(start) {
+			start = successor.NotBefore
+		}
+		// The file stores whole seconds.
+		if end := start.Add(s.grace).Truncate(time.Second); old.Expires.IsZero() || end.Before(old.Expires) {
+			old.Expires = end
+			ends[i] = end
+		}
+	}
+	s.replacedSince = since
+	return ends
+}
+
+// recordReplacementEnds writes the end of each grace period in ends to the
+// expires field of its entry in the token file. The store enforces the end
+// either way; when the file cannot be written it is lost on restart, so the
+// failure is logged with the value to add by hand.
+func (s *TokenStore) recordReplacementEnds(tokens *tokenSet, ends map[int]time.Time) {
+	if len(ends) == 0 {
+		return
+	}
+	replaced := slices.Sorted(maps.Keys(ends))
+
+	file, err := ReadTokenFile(s.file)
+	if err == nil {
+		// An edit since the file was loaded may have moved the lines; the
+		// reload it triggers records the ends instead.
+		lines := make(map[int]string)
+		for _, entry := range file.Entries(nil) {
+			lines[entry.Line] = entry.Identity.ID
+		}
+		for _, i := range replaced {
+			if lines[tokens.entries[i].line] != tokens.entries[i].identity.ID {
+				return
+			}
+		}
+		for _, i := range replaced {
+			if err = file.SetExpires(tokens.entries[i].line, ends[i]); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = file.Save()
+	}
+	for _, i := range replaced {
+		end := formatTokenTime(ends[i])
+		if err != nil {
+			s.logger.Printf("token %s: cannot record the end of its replacement grace period in %s: %v; add expires=%s to its line to keep it across restarts",
+				tokens.entries[i].label(), s.file, err, end)
+		} else {
+			s.logger.Printf("token %s is replaced; recorded expires=%s in %s", tokens.entries[i].label(), end, s.file)
+		}
+	}
+}
+
+// checkExpiry logs tokens that are about to expire or have just expired.
+// Expiry itself needs no action: Identify compares against the clock.
+func (s *TokenStore) checkExpiry() {
+	s.mu.RLock()
+	tokens := s.tokens
+	s.mu.RUnlock()
+	if tokens == nil {
+		return
+	}
+	tokens.reportExpiry(time.Now(), s.warning, s.logger.Printf)
+}
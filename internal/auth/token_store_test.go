@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -15,7 +18,7 @@ func TestTokenStoreLoadsAndWatchesTokens(t *testing.T) {
 	file := filepath.Join(dir, "tokens.txt")
 	writeTokenFile(t, file, "alpha\n")
 
-	store, err := NewTokenStore(file, 20*time.Millisecond, log.New(io.Discard, "", 0))
+	store, err := NewTokenStore(file, 20*time.Millisecond, log.New(io.Discard, "", 0), Options{})
 	if err != nil {
 		t.Fatalf("NewTokenStore: %v", err)
 	}
@@ -49,7 +52,7 @@ func TestTokenStoreHandlesFileRemoval(t *testing.T) {
 	file := filepath.Join(dir, "tokens.txt")
 	writeTokenFile(t, file, "alpha\n")
 
-	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0))
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
 	if err != nil {
 		t.Fatalf("NewTokenStore: %v", err)
 	}
@@ -93,7 +96,7 @@ func TestTokenStoreSiblingFileIgnored(t *testing.T) {
 	file := filepath.Join(dir, "tokens.txt")
 	writeTokenFile(t, file, "alpha\n")
 
-	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0))
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
 	if err != nil {
 		t.Fatalf("NewTokenStore: %v", err)
 	}
@@ -120,7 +123,7 @@ func TestTokenStoreEmptyFile(t *testing.T) {
 	file := filepath.Join(dir, "tokens.txt")
 	writeTokenFile(t, file, "")
 
-	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0))
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
 	if err != nil {
 		t.Fatalf("NewTokenStore: %v", err)
 	}
@@ -136,7 +139,7 @@ func TestTokenStoreConcurrentValidation(t *testing.T) {
 	file := filepath.Join(dir, "tokens.txt")
 	writeTokenFile(t, file, "alpha\nbeta\n")
 
-	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0))
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
 	if err != nil {
 		t.Fatalf("NewTokenStore: %v", err)
 	}
@@ -162,3 +165,372 @@ func TestTokenStoreConcurrentValidation(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestTokenStoreScopes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	writeTokenFile(t, file, strings.Join([]string{
+		"# family podcast apps",
+		"plain",
+		"alice-token scopes=read,upload,delete name=alice",
+		"  bob-token   name=bob scopes=READ ",
+		"broken-token scopes=read,admin",
+		"odd-token listen",
+		"nobody scopes=",
+	}, "\n"))
+
+	var logs strings.Builder
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(&logs, "", 0), Options{DefaultScopes: []Scope{ScopeRead}})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	cases := []struct {
+		token string
+		want  Identity
+	}{
+		{"plain", Identity{Scopes: []Scope{ScopeRead}}},
+		{"alice-token", Identity{Name: "alice", Scopes: []Scope{ScopeRead, ScopeUpload, ScopeDelete}}},
+		{"bob-token", Identity{Name: "bob", Scopes: []Scope{ScopeRead}}},
+		{"nobody", Identity{}},
+	}
+	for _, tc := range cases {
+		identity, ok := store.Identify(tc.token)
+		if !ok {
+			t.Fatalf("expected %s to be valid", tc.token)
+		}
+		if identity.Name != tc.want.Name || !slices.Equal(identity.Scopes, tc.want.Scopes) {
+			t.Fatalf("%s: got %+v want %+v", tc.token, identity, tc.want)
+		}
+	}
+	if identity, _ := store.Identify("nobody"); identity.Has(ScopeRead) {
+		t.Fatalf("expected an empty scopes field to grant nothing")
+	}
+
+	if identity, ok := store.Identify("odd-token listen"); !ok || !slices.Equal(identity.Scopes, []Scope{ScopeRead}) {
+		t.Fatalf("expected a line without fields to be read whole as a token, got %+v %v", identity, ok)
+	}
+	for _, token := range []string{"broken-token", "odd-token", "# family podcast apps", "#"} {
+		if store.IsValidToken(token) {
+			t.Fatalf("expected %q to be rejected", token)
+		}
+	}
+	if !strings.Contains(logs.String(), "line 5 ignored") || strings.Contains(logs.String(), "broken-token") {
+		t.Fatalf("expected invalid lines to be logged by position only, got %q", logs.String())
+	}
+}
+
+func TestTokenStoreKeepsLegacyTokens(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	writeTokenFile(t, file, "# household tokens\n#legacyToken\nplain\n  correct horse battery  \n#\n")
+
+	var logs strings.Builder
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(&logs, "", 0), Options{DefaultScopes: []Scope{ScopeRead}})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	for _, token := range []string{"#legacyToken", "plain", "correct horse battery"} {
+		if identity, ok := store.Identify(token); !ok || !slices.Equal(identity.Scopes, []Scope{ScopeRead}) {
+			t.Fatalf("expected the plain line %q to stay a token with the default scopes, got %+v %v", token, identity, ok)
+		}
+	}
+	for _, token := range []string{"# household tokens", "#", "legacyToken", "correct"} {
+		if store.IsValidToken(token) {
+			t.Fatalf("expected %q to be rejected", token)
+		}
+	}
+	if !strings.Contains(logs.String(), "line 2: tokens starting with # are deprecated") ||
+		!strings.Contains(logs.String(), "line 4 has no scopes=") ||
+		strings.Contains(logs.String(), "line 1") || strings.Contains(logs.String(), "legacyToken") {
+		t.Fatalf("expected the legacy lines to be reported by position only, got %q", logs.String())
+	}
+
+	tokens, err := ReadTokenFile(file)
+	if err != nil {
+		t.Fatalf("ReadTokenFile: %v", err)
+	}
+	if entries := tokens.Entries(nil); len(entries) != 3 || entries[0].Token != "#legacyToken" || entries[2].Token != "correct horse battery" {
+		t.Fatalf("expected the token file to list the same tokens, got %+v", entries)
+	}
+}
+
+func TestTokenStoreDefaultScopes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	writeTokenFile(t, file, "alpha\n")
+
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	identity, ok := store.Identify("alpha")
+	if !ok || !slices.Equal(identity.Scopes, AllScopes) {
+		t.Fatalf("expected plain tokens to keep every scope by default, got %+v", identity)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" read, Upload ,,read")
+	if err != nil || !slices.Equal(scopes, []Scope{ScopeRead, ScopeUpload}) {
+		t.Fatalf("unexpected scopes %v (%v)", scopes, err)
+	}
+	if _, err := ParseScopes("read,write"); err == nil {
+		t.Fatalf("expected unknown scope to fail")
+	}
+}
+
+func TestTokenStoreExpiry(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	now := time.Now().UTC()
+	writeTokenFile(t, file, strings.Join([]string{
+		"expired expires=" + now.Add(-time.Minute).Format(time.RFC3339),
+		"pending not_before=" + now.Add(time.Hour).Format(time.RFC3339),
+		"expiring name=laptop expires=" + now.Add(48*time.Hour).Format(time.RFC3339),
+		"dated not_before=2000-01-01 expires=2999-01-01",
+		"bad expires=tomorrow",
+		"rotated replaced_by=sha256:00:00",
+	}, "\n"))
+
+	var logs strings.Builder
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(&logs, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	for token, want := range map[string]bool{
+		"expired":  false,
+		"pending":  false,
+		"expiring": true,
+		"dated":    true,
+		"bad":      false,
+		"rotated":  false,
+	} {
+		if got := store.IsValidToken(token); got != want {
+			t.Fatalf("IsValidToken(%q) = %v, want %v", token, got, want)
+		}
+	}
+	for _, line := range []string{
+		"token on line 1 expired at",
+		`warning: token "laptop" expires in 48h0m0s`,
+		"line 5 ignored",
+		"line 6 ignored",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Fatalf("expected log to contain %q, got %q", line, logs.String())
+		}
+	}
+}
+
+func TestTokenSetExpiryIsReevaluated(t *testing.T) {
+	expires := time.Date(2030, 1, 8, 0, 0, 0, 0, time.UTC)
+	entry, err := newTokenEntry("alpha", Identity{Name: "phone", Expires: expires})
+	if err != nil {
+		t.Fatalf("newTokenEntry: %v", err)
+	}
+	tokens := newTokenSet([]tokenEntry{entry})
+
+	if _, ok := tokens.identify("alpha", expires.Add(-time.Second)); !ok {
+		t.Fatalf("expected token to be valid before expiry")
+	}
+	if _, ok := tokens.identify("alpha", expires); ok {
+		t.Fatalf("expected cached token to be rejected once expired")
+	}
+
+	var logs []string
+	logf := func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	for _, now := range []time.Time{
+		expires.Add(-30 * 24 * time.Hour),
+		expires.Add(-6 * 24 * time.Hour),
+		expires.Add(-time.Hour),
+		expires,
+		expires.Add(time.Hour),
+	} {
+		tokens.reportExpiry(now, 7*24*time.Hour, logf)
+	}
+	want := []string{
+		`warning: token "phone" expires in 144h0m0s, at 2030-01-08T00:00:00Z`,
+		`token "phone" expired at 2030-01-08T00:00:00Z`,
+	}
+	if !slices.Equal(logs, want) {
+		t.Fatalf("expected each notice once, got %q", logs)
+	}
+}
+
+func TestTokenStoreIdentifyID(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	hashed, err := HashToken("beta")
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	writeTokenFile(t, file, "alpha name=a\n"+hashed+" name=b\ngamma expires=2000-01-01\n")
+
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(io.Discard, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ids := make(map[string]string)
+	for _, token := range []string{"alpha", "beta"} {
+		identity, ok := store.Identify(token)
+		if !ok || identity.ID == "" || strings.Contains(identity.ID, token) {
+			t.Fatalf("expected an opaque ID for %q, got %+v", token, identity)
+		}
+		byID, ok := store.IdentifyID(identity.ID)
+		if !ok || byID.Name != identity.Name {
+			t.Fatalf("expected ID of %q to resolve, got %+v %v", token, byID, ok)
+		}
+		ids[token] = identity.ID
+	}
+	if ids["alpha"] == ids["beta"] {
+		t.Fatalf("expected distinct IDs, got %v", ids)
+	}
+	if _, ok := store.IdentifyID("unknown"); ok {
+		t.Fatalf("expected unknown ID to be rejected")
+	}
+
+	entry, err := newTokenEntry("gamma", Identity{})
+	if err != nil {
+		t.Fatalf("newTokenEntry: %v", err)
+	}
+	if _, ok := store.IdentifyID(entry.identity.ID); ok {
+		t.Fatalf("expected ID of an expired token to be rejected")
+	}
+
+	writeTokenFile(t, file, "beta\n")
+	waitForToken(t, store, "alpha", false)
+	if _, ok := store.IdentifyID(ids["alpha"]); ok {
+		t.Fatalf("expected ID of a revoked token to be rejected")
+	}
+}
+
+func TestTokenStoreReplacement(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	hashed, err := HashToken("laptop-new")
+	if err != nil {
+		t.Fatalf("HashToken: %v", err)
+	}
+	later := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	content := strings.Join([]string{
+		"grandma-new scopes=read name=grandma",
+		"grandma-old scopes=read replaced_by=grandma",
+		hashed + " name=laptop",
+		"laptop-old replaced_by=laptop expires=2999-01-01",
+		"pending-new name=pending not_before=" + later.Format(time.RFC3339),
+		"pending-old replaced_by=pending",
+		"orphan replaced_by=nobody",
+	}, "\n")
+	writeTokenFile(t, file, content)
+
+	var logs strings.Builder
+	store, err := NewTokenStore(file, 5*time.Millisecond, log.New(&logs, "", 0), Options{ReplacementGrace: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	old, ok := store.Identify("grandma-old")
+	if !ok || old.Expires.IsZero() || old.Expires.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expected the replaced token to expire within the grace period, got %+v %v", old, ok)
+	}
+	if token, successor, ok := store.Successor(old.ID); !ok || token != "grandma-new" || successor.Name != "grandma" {
+		t.Fatalf("expected the plaintext successor, got %q %+v %v", token, successor, ok)
+	}
+
+	laptop, ok := store.Identify("laptop-old")
+	if !ok || laptop.Expires.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expected the grace period to override a later expires, got %+v %v", laptop, ok)
+	}
+	if token, successor, ok := store.Successor(laptop.ID); !ok || token != "" || successor.Name != "laptop" {
+		t.Fatalf("expected a hashed successor to be returned without its token, got %q %+v %v", token, successor, ok)
+	}
+
+	pending, ok := store.Identify("pending-old")
+	if !ok || !pending.Expires.Equal(later.Add(time.Hour)) {
+		t.Fatalf("expected the grace period to start at the successor's not_before, got %+v %v", pending, ok)
+	}
+	if _, _, ok := store.Successor(pending.ID); ok {
+		t.Fatalf("expected a successor that is not valid yet not to be handed out")
+	}
+
+	if orphan, ok := store.Identify("orphan"); !ok || !orphan.Expires.IsZero() {
+		t.Fatalf("expected an unresolved replacement to leave the token alone, got %+v %v", orphan, ok)
+	}
+	if !strings.Contains(logs.String(), "token on line 7: replaced_by matches no other token") {
+		t.Fatalf("expected the unresolved replacement to be logged, got %q", logs.String())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := store.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if again, _ := store.Identify("grandma-old"); !again.Expires.Equal(old.Expires) {
+		t.Fatalf("expected the grace period to survive a reload, got %v want %v", again.Expires, old.Expires)
+	}
+}
+
+func TestTokenStoreReplacementGraceSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tokens.txt")
+	writeTokenFile(t, file, strings.Join([]string{
+		"# rotated in October",
+		"grandma-new scopes=read name=grandma",
+		"grandma-old scopes=read name=grandma-old replaced_by=grandma",
+	}, "\n"))
+
+	var logs strings.Builder
+	first, err := NewTokenStore(file, time.Hour, log.New(&logs, "", 0), Options{ReplacementGrace: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTokenStore: %v", err)
+	}
+	old, ok := first.Identify("grandma-old")
+	if !ok || old.Expires.IsZero() {
+		t.Fatalf("expected the replaced token to get an end, got %+v %v", old, ok)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read token file: %v", err)
+	}
+	want := "grandma-old scopes=read name=grandma-old expires=" + formatTokenTime(old.Expires) + " replaced_by=grandma"
+	if !strings.Contains(string(data), "# rotated in October\n") || !strings.Contains(string(data), want+"\n") {
+		t.Fatalf("expected the end to be recorded on the replaced line, got %q", data)
+	}
+	if !strings.Contains(logs.String(), `token "grandma-old" is replaced; recorded expires=`) {
+		t.Fatalf("expected the recorded end to be logged, got %q", logs.String())
+	}
+
+	// A store started later, as after a restart, keeps the recorded end
+	// rather than granting a new grace period.
+	second, err := NewTokenStore(file, time.Hour, log.New(io.Discard, "", 0), Options{ReplacementGrace: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTokenStore restart: %v", err)
+	}
+	t.Cleanup(func() { _ = second.Close() })
+	second.mu.Lock()
+	second.replacedSince = nil
+	second.mu.Unlock()
+	if err := second.refreshAt(time.Now().Add(50 * time.Minute)); err != nil {
+		t.Fatalf("refreshAt: %v", err)
+	}
+	if again, ok := second.Identify("grandma-old"); !ok || !again.Expires.Equal(old.Expires) {
+		t.Fatalf("expected the restarted store to keep the end %v, got %+v %v", old.Expires, again, ok)
+	}
+	after, err := os.ReadFile(file)
+	if err != nil || string(after) != string(data) {
+		t.Fatalf("expected the restart to leave the file alone, got %q %v", after, err)
+	}
+}
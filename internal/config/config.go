@@ -2,8 +2,12 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +30,10 @@ const (
 	defaultFeedTitle         = "Home Podcast"
 	defaultFeedDescription   = "Private podcast feed generated from the local audio library."
 	defaultFeedLanguage      = "en"
+	mp3DurationFast          = "fast"
+	mp3DurationAccurate      = "accurate"
+	defaultSignedURLTTLHours = 72
+	minURLSigningKeyLength   = 32
 )
 
 // AllowedExtensions returns the list of supported audio file extensions (lowercase).
@@ -90,6 +98,69 @@ func RefreshDebounce() time.Duration {
 	return time.Duration(ms) * time.Millisecond
 }
 
+// ScanWorkers returns how many files the library may extract metadata from
+// concurrently. It defaults to the number of CPUs available to the process.
+func ScanWorkers() int {
+	value := strings.TrimSpace(os.Getenv("PODCAST_SCAN_WORKERS"))
+	if value == "" {
+		return runtime.NumCPU()
+	}
+
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+// FeedMaxItems returns how many episodes a feed page holds by default, from
+// PODCAST_FEED_MAX_ITEMS. Zero, the default, publishes every episode on a
+// single page.
+func FeedMaxItems() int {
+	value := strings.TrimSpace(os.Getenv("PODCAST_FEED_MAX_ITEMS"))
+	if value == "" {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// MP3DurationMode reports how MP3 durations are measured: "fast" (the
+// default) trusts Xing/Info/VBRI headers and constant-bitrate arithmetic,
+// while "accurate" decodes every frame.
+func MP3DurationMode() string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("PODCAST_MP3_DURATION_MODE")))
+	if value == mp3DurationAccurate {
+		return mp3DurationAccurate
+	}
+	return mp3DurationFast
+}
+
+// PublicURL returns the externally visible base URL of the service from
+// PODCAST_PUBLIC_URL, without a trailing slash, or an empty string when it is
+// not configured.
+func PublicURL() (string, error) {
+	value := strings.TrimSpace(os.Getenv("PODCAST_PUBLIC_URL"))
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid PODCAST_PUBLIC_URL %q: must be an absolute http(s) URL", value)
+	}
+	return strings.TrimRight(value, "/"), nil
+}
+
+// Debug reports whether verbose diagnostic logging is enabled.
+func Debug() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("PODCAST_DEBUG")))
+	return err == nil && enabled
+}
+
 // ValidateListenAddr ensures the configured listen address is restricted to localhost.
 func ValidateListenAddr(addr string) error {
 	addr = strings.TrimSpace(strings.ToLower(addr))
@@ -141,19 +212,140 @@ func ResolveTokenFile() (string, bool, error) {
 	return abs, true, nil
 }
 
+// TokenDefaultScopes returns the comma-separated scopes granted to tokens
+// listed without a scopes field, from PODCAST_TOKEN_DEFAULT_SCOPES. An empty
+// value keeps the historical behaviour of granting every scope.
+func TokenDefaultScopes() string {
+	return strings.TrimSpace(os.Getenv("PODCAST_TOKEN_DEFAULT_SCOPES"))
+}
+
+// URLSigningKey returns the secret used to sign the URLs in feeds, from
+// PODCAST_URL_SIGNING_KEY, or an empty string when signing is not configured.
+// Short keys are rejected because they could be guessed from signed URLs.
+func URLSigningKey() (string, error) {
+	value := strings.TrimSpace(os.Getenv("PODCAST_URL_SIGNING_KEY"))
+	if value != "" && len(value) < minURLSigningKeyLength {
+		return "", fmt.Errorf("PODCAST_URL_SIGNING_KEY must be at least %d characters", minURLSigningKeyLength)
+	}
+	return value, nil
+}
+
+// SignedURLTTL returns how long signed URLs of feed resources stay valid, from
+// PODCAST_SIGNED_URL_TTL_HOURS.
+func SignedURLTTL() time.Duration {
+	value := strings.TrimSpace(os.Getenv("PODCAST_SIGNED_URL_TTL_HOURS"))
+	if value == "" {
+		return defaultSignedURLTTLHours * time.Hour
+	}
+
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours <= 0 {
+		return defaultSignedURLTTLHours * time.Hour
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// MediaQueryTokens reports whether audio, artwork, chapters and transcripts
+// keep accepting ?token= URLs, from PODCAST_MEDIA_QUERY_TOKENS. It defaults to true so feeds fetched before
+// signing was enabled keep working.
+func MediaQueryTokens() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("PODCAST_MEDIA_QUERY_TOKENS")))
+	return err != nil || enabled
+}
+
+// ResolveStateDir returns the absolute path to the directory used for persisted
+// service state such as the metadata index. The directory is created when it
+// does not yet exist. When no directory is configured the second return value
+// will be false.
+func ResolveStateDir() (string, bool, error) {
+	dir := strings.TrimSpace(os.Getenv("PODCAST_STATE_DIR"))
+	if dir == "" {
+		return "", false, nil
+	}
+
+	abs, err := resolveConfigPath(dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return "", false, err
+	}
+
+	return abs, true, nil
+}
+
 // FeedMetadata represents the static metadata used to render the podcast RSS feed.
+// Optional fields are left empty (or nil) when not configured so the feed
+// omits the corresponding elements.
 type FeedMetadata struct {
 	Title       string
 	Description string
 	Language    string
 	Author      string
+	// Image is the URL of the channel artwork (itunes:image).
+	Image      string
+	Categories []FeedCategory
+	Explicit   *bool
+	OwnerName  string
+	OwnerEmail string
+	// Type is "episodic" or "serial" (itunes:type).
+	Type      string
+	Copyright string
+	// Link is the website of the show; the feed falls back to the server's
+	// own address.
+	Link string
+	// Locked asks podcast platforms not to import the feed (podcast:locked).
+	Locked *bool
+	// Medium is the podcast:medium value, such as "podcast" or "audiobook".
+	Medium  string
+	Persons []FeedPerson
+}
+
+// FeedPerson credits someone involved in the whole show (podcast:person).
+type FeedPerson struct {
+	Name  string `yaml:"name"`
+	Role  string `yaml:"role"`
+	Group string `yaml:"group"`
+	Image string `yaml:"image"`
+	URL   string `yaml:"url"`
+}
+
+// FeedCategory is an iTunes category with an optional subcategory.
+type FeedCategory struct {
+	Name        string
+	Subcategory string
+}
+
+// feedTypes lists the accepted itunes:type values.
+var feedTypes = []string{"episodic", "serial"}
+
+// feedMedia lists the podcast:medium values defined by the Podcasting 2.0
+// namespace.
+var feedMedia = []string{
+	"podcast", "music", "video", "film", "audiobook", "newsletter", "blog", "publisher", "course",
+	"podcastL", "musicL", "videoL", "filmL", "audiobookL", "newsletterL", "blogL", "publisherL", "courseL",
+	"mixed",
 }
 
 type feedMetadataYAML struct {
-	Title       string `yaml:"title"`
-	Description string `yaml:"description"`
-	Language    string `yaml:"language"`
-	Author      string `yaml:"author"`
+	Title       string   `yaml:"title"`
+	Description string   `yaml:"description"`
+	Language    string   `yaml:"language"`
+	Author      string   `yaml:"author"`
+	Image       string   `yaml:"image"`
+	Categories  []string `yaml:"categories"`
+	Explicit    *bool    `yaml:"explicit"`
+	Owner       struct {
+		Name  string `yaml:"name"`
+		Email string `yaml:"email"`
+	} `yaml:"owner"`
+	Type      string       `yaml:"type"`
+	Copyright string       `yaml:"copyright"`
+	Link      string       `yaml:"link"`
+	Locked    *bool        `yaml:"locked"`
+	Medium    string       `yaml:"medium"`
+	Persons   []FeedPerson `yaml:"persons"`
 }
 
 // ResolveFeedMetadata returns the podcast feed metadata after applying defaults,
@@ -191,6 +383,45 @@ func ResolveFeedMetadata() (FeedMetadata, error) {
 		if value := strings.TrimSpace(yamlConfig.Author); value != "" {
 			meta.Author = value
 		}
+		if value := strings.TrimSpace(yamlConfig.Image); value != "" {
+			meta.Image = value
+		}
+		if len(yamlConfig.Categories) > 0 {
+			meta.Categories = parseFeedCategories(yamlConfig.Categories)
+		}
+		if yamlConfig.Explicit != nil {
+			explicit := *yamlConfig.Explicit
+			meta.Explicit = &explicit
+		}
+		if value := strings.TrimSpace(yamlConfig.Owner.Name); value != "" {
+			meta.OwnerName = value
+		}
+		if value := strings.TrimSpace(yamlConfig.Owner.Email); value != "" {
+			meta.OwnerEmail = value
+		}
+		if value := strings.TrimSpace(yamlConfig.Type); value != "" {
+			meta.Type = strings.ToLower(value)
+		}
+		if value := strings.TrimSpace(yamlConfig.Copyright); value != "" {
+			meta.Copyright = value
+		}
+		if value := strings.TrimSpace(yamlConfig.Link); value != "" {
+			meta.Link = value
+		}
+		if yamlConfig.Locked != nil {
+			locked := *yamlConfig.Locked
+			meta.Locked = &locked
+		}
+		if value := strings.TrimSpace(yamlConfig.Medium); value != "" {
+			meta.Medium = value
+		}
+		for i, person := range yamlConfig.Persons {
+			person.Name = strings.TrimSpace(person.Name)
+			if person.Name == "" {
+				return FeedMetadata{}, fmt.Errorf("feed person %d has no name", i+1)
+			}
+			meta.Persons = append(meta.Persons, person)
+		}
 	}
 
 	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_TITLE")); value != "" {
@@ -205,10 +436,84 @@ func ResolveFeedMetadata() (FeedMetadata, error) {
 	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_AUTHOR")); value != "" {
 		meta.Author = value
 	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_IMAGE")); value != "" {
+		meta.Image = value
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_CATEGORIES")); value != "" {
+		meta.Categories = parseFeedCategories(strings.Split(value, ","))
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_EXPLICIT")); value != "" {
+		explicit, err := parseFlag(value)
+		if err != nil {
+			return FeedMetadata{}, fmt.Errorf("invalid PODCAST_FEED_EXPLICIT %q: %w", value, err)
+		}
+		meta.Explicit = &explicit
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_OWNER_NAME")); value != "" {
+		meta.OwnerName = value
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_OWNER_EMAIL")); value != "" {
+		meta.OwnerEmail = value
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_TYPE")); value != "" {
+		meta.Type = strings.ToLower(value)
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_COPYRIGHT")); value != "" {
+		meta.Copyright = value
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_LINK")); value != "" {
+		meta.Link = value
+	}
+
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_LOCKED")); value != "" {
+		locked, err := parseFlag(value)
+		if err != nil {
+			return FeedMetadata{}, fmt.Errorf("invalid PODCAST_FEED_LOCKED %q: %w", value, err)
+		}
+		meta.Locked = &locked
+	}
+	if value := strings.TrimSpace(os.Getenv("PODCAST_FEED_MEDIUM")); value != "" {
+		meta.Medium = value
+	}
+
+	if meta.Type != "" && !slices.Contains(feedTypes, meta.Type) {
+		return FeedMetadata{}, fmt.Errorf("invalid feed type %q: must be episodic or serial", meta.Type)
+	}
+
+	if meta.Medium != "" && !slices.Contains(feedMedia, meta.Medium) {
+		return FeedMetadata{}, fmt.Errorf("invalid feed medium %q", meta.Medium)
+	}
 
 	return meta, nil
 }
 
+// parseFlag accepts the values strconv.ParseBool does plus "yes" and "no",
+// which the iTunes and Podcasting 2.0 namespaces use.
+func parseFlag(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseFeedCategories turns entries such as "Technology" or
+// "Society & Culture/Documentary" into categories, skipping blank ones.
+func parseFeedCategories(entries []string) []FeedCategory {
+	var categories []FeedCategory
+	for _, entry := range entries {
+		name, sub, _ := strings.Cut(entry, "/")
+		name, sub = strings.TrimSpace(name), strings.TrimSpace(sub)
+		if name == "" {
+			continue
+		}
+		categories = append(categories, FeedCategory{Name: name, Subcategory: sub})
+	}
+	return categories
+}
+
 func resolveConfigPath(path string) (string, error) {
 	if strings.HasPrefix(path, "~") {
 		home, err := os.UserHomeDir()
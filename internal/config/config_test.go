@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -134,6 +137,148 @@ func TestRefreshDebounce(t *testing.T) {
 	}
 }
 
+func TestScanWorkers(t *testing.T) {
+	t.Setenv("PODCAST_SCAN_WORKERS", "")
+	if ScanWorkers() != runtime.NumCPU() {
+		t.Fatalf("expected default of one worker per CPU")
+	}
+
+	t.Setenv("PODCAST_SCAN_WORKERS", "3")
+	if ScanWorkers() != 3 {
+		t.Fatalf("expected custom worker count")
+	}
+
+	t.Setenv("PODCAST_SCAN_WORKERS", "zero")
+	if ScanWorkers() != runtime.NumCPU() {
+		t.Fatalf("expected fallback on parse error")
+	}
+
+	t.Setenv("PODCAST_SCAN_WORKERS", "0")
+	if ScanWorkers() != runtime.NumCPU() {
+		t.Fatalf("expected fallback on non-positive value")
+	}
+}
+
+func TestFeedMaxItems(t *testing.T) {
+	t.Setenv("PODCAST_FEED_MAX_ITEMS", "")
+	if FeedMaxItems() != 0 {
+		t.Fatalf("expected unlimited feed by default")
+	}
+
+	t.Setenv("PODCAST_FEED_MAX_ITEMS", "50")
+	if FeedMaxItems() != 50 {
+		t.Fatalf("expected custom item limit")
+	}
+
+	t.Setenv("PODCAST_FEED_MAX_ITEMS", "many")
+	if FeedMaxItems() != 0 {
+		t.Fatalf("expected fallback on parse error")
+	}
+
+	t.Setenv("PODCAST_FEED_MAX_ITEMS", "-5")
+	if FeedMaxItems() != 0 {
+		t.Fatalf("expected fallback on negative value")
+	}
+}
+
+func TestTokenDefaultScopes(t *testing.T) {
+	t.Setenv("PODCAST_TOKEN_DEFAULT_SCOPES", "")
+	if TokenDefaultScopes() != "" {
+		t.Fatalf("expected no default scopes by default")
+	}
+
+	t.Setenv("PODCAST_TOKEN_DEFAULT_SCOPES", " read ")
+	if TokenDefaultScopes() != "read" {
+		t.Fatalf("expected trimmed scopes, got %q", TokenDefaultScopes())
+	}
+}
+
+func TestURLSigningKey(t *testing.T) {
+	t.Setenv("PODCAST_URL_SIGNING_KEY", "")
+	if key, err := URLSigningKey(); err != nil || key != "" {
+		t.Fatalf("expected signing to be off by default, got %q, %v", key, err)
+	}
+
+	t.Setenv("PODCAST_URL_SIGNING_KEY", "too-short")
+	if _, err := URLSigningKey(); err == nil {
+		t.Fatalf("expected short key to be rejected")
+	}
+
+	key := strings.Repeat("k", 32)
+	t.Setenv("PODCAST_URL_SIGNING_KEY", " "+key+" ")
+	if value, err := URLSigningKey(); err != nil || value != key {
+		t.Fatalf("expected trimmed key, got %q, %v", value, err)
+	}
+}
+
+func TestSignedURLTTL(t *testing.T) {
+	t.Setenv("PODCAST_SIGNED_URL_TTL_HOURS", "")
+	if SignedURLTTL() != 72*time.Hour {
+		t.Fatalf("expected 72 hour default, got %v", SignedURLTTL())
+	}
+
+	t.Setenv("PODCAST_SIGNED_URL_TTL_HOURS", "12")
+	if SignedURLTTL() != 12*time.Hour {
+		t.Fatalf("expected custom lifetime, got %v", SignedURLTTL())
+	}
+
+	t.Setenv("PODCAST_SIGNED_URL_TTL_HOURS", "0")
+	if SignedURLTTL() != 72*time.Hour {
+		t.Fatalf("expected fallback on non-positive value")
+	}
+}
+
+func TestMediaQueryTokens(t *testing.T) {
+	t.Setenv("PODCAST_MEDIA_QUERY_TOKENS", "")
+	if !MediaQueryTokens() {
+		t.Fatalf("expected query tokens to be accepted by default")
+	}
+
+	t.Setenv("PODCAST_MEDIA_QUERY_TOKENS", "false")
+	if MediaQueryTokens() {
+		t.Fatalf("expected query tokens to be refused")
+	}
+
+	t.Setenv("PODCAST_MEDIA_QUERY_TOKENS", "sometimes")
+	if !MediaQueryTokens() {
+		t.Fatalf("expected fallback to accepting query tokens")
+	}
+}
+
+func TestMP3DurationMode(t *testing.T) {
+	t.Setenv("PODCAST_MP3_DURATION_MODE", "")
+	if MP3DurationMode() != "fast" {
+		t.Fatalf("expected fast mode by default")
+	}
+
+	t.Setenv("PODCAST_MP3_DURATION_MODE", " Accurate ")
+	if MP3DurationMode() != "accurate" {
+		t.Fatalf("expected accurate mode")
+	}
+
+	t.Setenv("PODCAST_MP3_DURATION_MODE", "bogus")
+	if MP3DurationMode() != "fast" {
+		t.Fatalf("expected fallback to fast mode for unknown values")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	t.Setenv("PODCAST_DEBUG", "")
+	if Debug() {
+		t.Fatalf("expected debug logging off by default")
+	}
+
+	t.Setenv("PODCAST_DEBUG", "true")
+	if !Debug() {
+		t.Fatalf("expected debug logging enabled")
+	}
+
+	t.Setenv("PODCAST_DEBUG", "maybe")
+	if Debug() {
+		t.Fatalf("expected debug logging off for unparsable values")
+	}
+}
+
 func TestValidateListenAddr(t *testing.T) {
 	valid := []string{"127.0.0.1:8080", "localhost:9000", "[::1]:7000"}
 	for _, addr := range valid {
@@ -218,6 +363,136 @@ func TestResolveFeedMetadataFromFile(t *testing.T) {
 	}
 }
 
+func TestResolveFeedMetadataITunesFields(t *testing.T) {
+	for _, name := range []string{"IMAGE", "CATEGORIES", "EXPLICIT", "OWNER_NAME", "OWNER_EMAIL", "TYPE", "COPYRIGHT", "LINK"} {
+		t.Setenv("PODCAST_FEED_"+name, "")
+	}
+	t.Setenv("PODCAST_FEED_CONFIG", "")
+
+	meta, err := ResolveFeedMetadata()
+	if err != nil {
+		t.Fatalf("ResolveFeedMetadata: %v", err)
+	}
+	if meta.Image != "" || meta.Categories != nil || meta.Explicit != nil || meta.OwnerName != "" || meta.Type != "" || meta.Link != "" {
+		t.Fatalf("expected optional fields to be unset by default, got %+v", meta)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "feed.yaml")
+	content := "" +
+		"image: https://example.com/show.png\n" +
+		"categories:\n" +
+		"  - Technology\n" +
+		"  - Society & Culture / Documentary\n" +
+		"explicit: false\n" +
+		"owner:\n" +
+		"  name: File Owner\n" +
+		"  email: owner@example.com\n" +
+		"type: Serial\n" +
+		"copyright: 2026 File Owner\n" +
+		"link: https://example.com\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("PODCAST_FEED_CONFIG", configPath)
+
+	meta, err = ResolveFeedMetadata()
+	if err != nil {
+		t.Fatalf("ResolveFeedMetadata: %v", err)
+	}
+	wantCategories := []FeedCategory{{Name: "Technology"}, {Name: "Society & Culture", Subcategory: "Documentary"}}
+	if meta.Image != "https://example.com/show.png" || !slices.Equal(meta.Categories, wantCategories) || meta.Explicit == nil || *meta.Explicit ||
+		meta.OwnerName != "File Owner" || meta.OwnerEmail != "owner@example.com" || meta.Type != "serial" ||
+		meta.Copyright != "2026 File Owner" || meta.Link != "https://example.com" {
+		t.Fatalf("expected file-derived iTunes metadata, got %+v", meta)
+	}
+
+	t.Setenv("PODCAST_FEED_CATEGORIES", "Comedy, Arts/Books")
+	t.Setenv("PODCAST_FEED_EXPLICIT", "true")
+	t.Setenv("PODCAST_FEED_TYPE", "episodic")
+	t.Setenv("PODCAST_FEED_OWNER_EMAIL", "env@example.com")
+	meta, err = ResolveFeedMetadata()
+	if err != nil {
+		t.Fatalf("ResolveFeedMetadata env override: %v", err)
+	}
+	wantCategories = []FeedCategory{{Name: "Comedy"}, {Name: "Arts", Subcategory: "Books"}}
+	if !slices.Equal(meta.Categories, wantCategories) || meta.Explicit == nil || !*meta.Explicit || meta.Type != "episodic" ||
+		meta.OwnerName != "File Owner" || meta.OwnerEmail != "env@example.com" {
+		t.Fatalf("expected env overrides, got %+v", meta)
+	}
+
+	t.Setenv("PODCAST_FEED_EXPLICIT", "sometimes")
+	if _, err := ResolveFeedMetadata(); err == nil {
+		t.Fatalf("expected invalid explicit flag to fail")
+	}
+	t.Setenv("PODCAST_FEED_EXPLICIT", "")
+	t.Setenv("PODCAST_FEED_TYPE", "daily")
+	if _, err := ResolveFeedMetadata(); err == nil {
+		t.Fatalf("expected invalid feed type to fail")
+	}
+}
+
+func TestResolveFeedMetadataPodcastNamespace(t *testing.T) {
+	t.Setenv("PODCAST_FEED_LOCKED", "")
+	t.Setenv("PODCAST_FEED_MEDIUM", "")
+	configPath := filepath.Join(t.TempDir(), "feed.yaml")
+	content := "" +
+		"locked: true\n" +
+		"medium: audiobook\n" +
+		"persons:\n" +
+		"  - name: Jane Host\n" +
+		"    role: host\n" +
+		"    image: https://example.com/jane.jpg\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("PODCAST_FEED_CONFIG", configPath)
+
+	meta, err := ResolveFeedMetadata()
+	if err != nil {
+		t.Fatalf("ResolveFeedMetadata: %v", err)
+	}
+	if meta.Locked == nil || !*meta.Locked || meta.Medium != "audiobook" {
+		t.Fatalf("expected file-derived locked/medium, got %+v", meta)
+	}
+	if len(meta.Persons) != 1 || meta.Persons[0] != (FeedPerson{Name: "Jane Host", Role: "host", Image: "https://example.com/jane.jpg"}) {
+		t.Fatalf("unexpected persons %+v", meta.Persons)
+	}
+
+	t.Setenv("PODCAST_FEED_LOCKED", "no")
+	t.Setenv("PODCAST_FEED_MEDIUM", "music")
+	meta, err = ResolveFeedMetadata()
+	if err != nil {
+		t.Fatalf("ResolveFeedMetadata env override: %v", err)
+	}
+	if meta.Locked == nil || *meta.Locked || meta.Medium != "music" {
+		t.Fatalf("expected env overrides, got %+v", meta)
+	}
+
+	t.Setenv("PODCAST_FEED_MEDIUM", "radio")
+	if _, err := ResolveFeedMetadata(); err == nil {
+		t.Fatalf("expected unknown medium to fail")
+	}
+}
+
+func TestPublicURL(t *testing.T) {
+	t.Setenv("PODCAST_PUBLIC_URL", "")
+	if value, err := PublicURL(); err != nil || value != "" {
+		t.Fatalf("expected empty public URL, got %q, %v", value, err)
+	}
+
+	t.Setenv("PODCAST_PUBLIC_URL", " https://podcast.example.com/ ")
+	if value, err := PublicURL(); err != nil || value != "https://podcast.example.com" {
+		t.Fatalf("expected trimmed public URL, got %q, %v", value, err)
+	}
+
+	for _, invalid := range []string{"podcast.example.com", "ftp://podcast.example.com", "https://"} {
+		t.Setenv("PODCAST_PUBLIC_URL", invalid)
+		if _, err := PublicURL(); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
 func TestResolveTokenFileExistingFileNotOverwritten(t *testing.T) {
 	temp := t.TempDir()
 	tokenFile := filepath.Join(temp, "tokens.txt")
@@ -331,3 +606,32 @@ func assertSamePath(t *testing.T, got, want string) {
 		t.Fatalf("expected %s, got %s", resolvedWant, resolvedGot)
 	}
 }
+
+func TestResolveStateDir(t *testing.T) {
+	temp := t.TempDir()
+
+	t.Setenv("PODCAST_STATE_DIR", "")
+	if path, ok, err := ResolveStateDir(); err != nil || ok || path != "" {
+		t.Fatalf("expected no state dir when env unset, got %q %t %v", path, ok, err)
+	}
+
+	stateDir := filepath.Join(temp, "state", "nested")
+	t.Setenv("PODCAST_STATE_DIR", stateDir)
+
+	path, ok, err := ResolveStateDir()
+	if err != nil {
+		t.Fatalf("ResolveStateDir: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected ok flag when env set")
+	}
+	assertSamePath(t, path, stateDir)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat state dir: %v", err)
+	}
+	if !info.IsDir() {
+		t.Fatalf("expected state path to be a directory")
+	}
+}
@@ -0,0 +1,68 @@
+// Package fsutil holds file system helpers shared by the other packages.
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never observe a partial write. The file is
+// synced before the rename and the directory after it, so the new contents
+// survive a crash once WriteFileAtomic returns. A file that already exists
+// keeps its owner and group; when they cannot be kept, the file is left
+// alone and an error returned.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	original, err := os.Stat(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if original != nil {
+		if err := keepOwner(tmp, original); err != nil {
+			cleanup()
+			return fmt.Errorf("replace %s: %w", path, err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fsutil
+
+import "os"
+
+// keepOwner does nothing where files have no Unix owner.
+func keepOwner(f *os.File, original os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fchown changes the owner of an open file; tests replace it.
+var fchown = (*os.File).Chown
+
+// keepOwner gives f the owner and group of original where they differ, as
+// when root replaces a file belonging to a service account.
+func keepOwner(f *os.File, original os.FileInfo) error {
+	want, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	got, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || (got.Uid == want.Uid && got.Gid == want.Gid) {
+		return nil
+	}
+	if err := fchown(f, int(want.Uid), int(want.Gid)); err != nil {
+		return fmt.Errorf("it belongs to uid %d gid %d, which its replacement cannot be given (%w); run as its owner", want.Uid, want.Gid, err)
+	}
+	return nil
+}
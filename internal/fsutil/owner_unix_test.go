@@ -0,0 +1,69 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileAtomicKeepsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing a file's owner needs root")
+	}
+	path := filepath.Join(t.TempDir(), "tokens.txt")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chown(path, 65534, 65534); err != nil {
+		t.Fatalf("chown: %v", err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new"), 0o600); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid != 65534 || st.Gid != 65534 {
+		t.Fatalf("expected the file to keep uid and gid 65534, got %d %d", st.Uid, st.Gid)
+	}
+}
+
+func TestWriteFileAtomicRefusesToChangeOwner(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.txt")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if os.Geteuid() == 0 {
+		if err := os.Chown(path, 65534, 65534); err != nil {
+			t.Fatalf("chown: %v", err)
+		}
+	}
+	// Files of other users cannot be created without root, so the test
+	// fakes the refusal a non-root caller gets for any owner change.
+	fchown = func(*os.File, int, int) error { return syscall.EPERM }
+	t.Cleanup(func() { fchown = (*os.File).Chown })
+
+	err := WriteFileAtomic(path, []byte("new"), 0o600)
+	if os.Geteuid() != 0 {
+		// The caller owns the file, so nothing needs changing.
+		if err != nil {
+			t.Fatalf("expected a file of the caller to be replaced, got %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), "belongs to uid 65534 gid 65534") {
+		t.Fatalf("expected an error naming the owner, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	entries, _ := os.ReadDir(dir)
+	if string(data) != "old" || len(entries) != 1 {
+		t.Fatalf("expected the file to be left alone, got %q and %d entries", data, len(entries))
+	}
+}
@@ -0,0 +1,199 @@
+package library
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"home-podcast/internal/fsutil"
+	"home-podcast/internal/metadata"
+	"home-podcast/internal/models"
+)
+
+// ErrArtworkNotFound is returned by OpenArtwork for unknown identifiers. It
+// matches fs.ErrNotExist.
+var ErrArtworkNotFound = fmt.Errorf("artwork %w", fs.ErrNotExist)
+
+// artworkIDLength is the number of hex characters of the SHA-256 content
+// hash used to identify artwork.
+const artworkIDLength = 32
+
+// artworkCache stores cover images by content hash so episodes sharing a
+// cover share one copy. With a directory the images persist across restarts;
+// otherwise they are kept in memory.
+type artworkCache struct {
+	dir string
+
+	mu     sync.RWMutex
+	memory map[string][]byte
+}
+
+func newArtworkCache(dir string) (*artworkCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &artworkCache{dir: dir, memory: make(map[string][]byte)}, nil
+}
+
+func artworkID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:artworkIDLength]
+}
+
+func validArtworkID(id string) bool {
+	if len(id) != artworkIDLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// put stores data and returns its identifier. It is safe for concurrent use.
+func (c *artworkCache) put(data []byte) (string, error) {
+	id := artworkID(data)
+
+	if c.dir == "" {
+		c.mu.Lock()
+		if _, ok := c.memory[id]; !ok {
+			c.memory[id] = bytes.Clone(data)
+		}
+		c.mu.Unlock()
+		return id, nil
+	}
+
+	path := filepath.Join(c.dir, id)
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// has reports whether id is still stored.
+func (c *artworkCache) has(id string) bool {
+	if c.dir == "" {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		_, ok := c.memory[id]
+		return ok
+	}
+	_, err := os.Stat(filepath.Join(c.dir, id))
+	return err == nil
+}
+
+// retain deletes every stored image whose identifier is not in keep.
+func (c *artworkCache) retain(keep map[string]struct{}) error {
+	if c.dir == "" {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for id := range c.memory {
+			if _, ok := keep[id]; !ok {
+				delete(c.memory, id)
+			}
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, ok := keep[entry.Name()]; ok || !validArtworkID(entry.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// open returns the image stored under id together with its modification
+// time.
+func (c *artworkCache) open(id string) (io.ReadSeekCloser, time.Time, error) {
+	if !validArtworkID(id) {
+		return nil, time.Time{}, ErrArtworkNotFound
+	}
+
+	if c.dir == "" {
+		c.mu.RLock()
+		data, ok := c.memory[id]
+		c.mu.RUnlock()
+		if !ok {
+			return nil, time.Time{}, ErrArtworkNotFound
+		}
+		return nopSeekCloser{bytes.NewReader(data)}, time.Time{}, nil
+	}
+
+	f, err := os.Open(filepath.Join(c.dir, id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, time.Time{}, ErrArtworkNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, info.ModTime(), nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// OpenArtwork returns the cached cover image with the given identifier, as
+// referenced by models.Episode.ArtworkID, and its modification time (zero
+// when unknown). Callers must close the reader.
+func (l *Library) OpenArtwork(id string) (io.ReadSeekCloser, time.Time, error) {
+	return l.artwork.open(id)
+}
+
+// cacheArtwork stores the cover art of the audio file at path, listed in dir,
+// and records its identifier on the episode.
+func (l *Library) cacheArtwork(path string, dir *metadata.Directory, episode *models.Episode) {
+	data, err := metadata.ReadArtworkIn(path, l.root, dir, *episode)
+	if err != nil {
+		l.logger.Printf("artwork error for %s: %v", path, err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	id, err := l.artwork.put(data)
+	if err != nil {
+		l.logger.Printf("artwork cache error for %s: %v", path, err)
+		return
+	}
+	episode.ArtworkID = id
+}
+
+// pruneArtwork drops cached images no episode in catalog refers to.
+func (l *Library) pruneArtwork(catalog map[string]models.Episode) {
+	keep := make(map[string]struct{})
+	for _, episode := range catalog {
+		if episode.ArtworkID != "" {
+			keep[episode.ArtworkID] = struct{}{}
+		}
+	}
+	if err := l.artwork.retain(keep); err != nil {
+		l.logger.Printf("artwork cache prune error: %v", err)
+	}
+}
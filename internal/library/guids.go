@@ -0,0 +1,244 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"home-podcast/internal/fsutil"
+	"home-podcast/internal/models"
+	"home-podcast/internal/uuid"
+)
+
+// guidRegistryVersion identifies the on-disk layout of the GUID registry.
+const guidRegistryVersion = 1
+
+// fingerprintChunk is how many bytes from each end of a file feed the
+// content fingerprint used to follow renames.
+const fingerprintChunk = 64 << 10
+
+type guidEntry struct {
+	GUID        string `json:"guid"`
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type guidDocument struct {
+	Version int         `json:"version"`
+	Entries []guidEntry `json:"entries"`
+}
+
+// guidRegistry assigns each episode a GUID that never changes, following
+// files across renames and moves by content fingerprint. Entries for files
+// that disappeared are kept so a later reappearance reclaims the same GUID.
+// It is not safe for concurrent use; callers hold the library scan lock.
+type guidRegistry struct {
+	path    string
+	entries map[string]*guidEntry
+	byPath  map[string]*guidEntry
+	// migrate is set when no registry existed yet: episodes present on the
+	// first run keep their path-based identifier so existing subscribers do
+	// not see them as new.
+	migrate bool
+	dirty   bool
+}
+
+// loadGUIDRegistry reads the registry at path. An empty path disables the
+// registry and every episode falls back to its relative path as GUID.
+func loadGUIDRegistry(path string) (*guidRegistry, error) {
+	reg := &guidRegistry{
+		path:    path,
+		entries: make(map[string]*guidEntry),
+		byPath:  make(map[string]*guidEntry),
+	}
+	if path == "" {
+		return reg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			reg.migrate = true
+			reg.dirty = true
+			return reg, nil
+		}
+		return nil, err
+	}
+
+	var doc guidDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode guid registry: %w", err)
+	}
+	if doc.Version != guidRegistryVersion {
+		return nil, fmt.Errorf("unsupported guid registry version %d", doc.Version)
+	}
+
+	for i := range doc.Entries {
+		entry := doc.Entries[i]
+		if entry.GUID == "" {
+			continue
+		}
+		reg.entries[entry.GUID] = &entry
+		if entry.Path != "" {
+			reg.byPath[entry.Path] = &entry
+		}
+	}
+	return reg, nil
+}
+
+// assign sets the GUID of every episode in catalog. fingerprints holds the
+// fingerprints computed during this scan; missing ones are computed on
+// demand through fingerprint when a file has no registry entry yet.
+func (reg *guidRegistry) assign(catalog map[string]models.Episode, fingerprints map[string]string, fingerprint func(rel string) (string, error)) error {
+	if reg.path == "" {
+		for rel, episode := range catalog {
+			episode.GUID = rel
+			catalog[rel] = episode
+		}
+		return nil
+	}
+
+	var unassigned []string
+	for rel, episode := range catalog {
+		entry, ok := reg.byPath[rel]
+		if !ok {
+			unassigned = append(unassigned, rel)
+			continue
+		}
+		if fp, ok := fingerprints[rel]; ok && fp != entry.Fingerprint {
+			entry.Fingerprint = fp
+			reg.dirty = true
+		}
+		episode.GUID = entry.GUID
+		catalog[rel] = episode
+	}
+	sort.Strings(unassigned)
+
+	orphans := make(map[string][]*guidEntry)
+	if len(unassigned) > 0 {
+		for _, entry := range reg.entries {
+			if entry.Fingerprint == "" {
+				continue
+			}
+			if _, present := catalog[entry.Path]; present && entry.Path != "" {
+				continue
+			}
+			orphans[entry.Fingerprint] = append(orphans[entry.Fingerprint], entry)
+		}
+		for _, list := range orphans {
+			sort.Slice(list, func(i, j int) bool { return list[i].GUID < list[j].GUID })
+		}
+	}
+
+	var firstErr error
+	for _, rel := range unassigned {
+		fp, ok := fingerprints[rel]
+		if !ok {
+			var err error
+			fp, err = fingerprint(rel)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		var entry *guidEntry
+		if candidates := orphans[fp]; fp != "" && len(candidates) > 0 {
+			entry = candidates[0]
+			orphans[fp] = candidates[1:]
+			if entry.Path != "" && reg.byPath[entry.Path] == entry {
+				delete(reg.byPath, entry.Path)
+			}
+			entry.Path = rel
+		} else {
+			guid := rel
+			if !reg.migrate {
+				var err error
+				guid, err = uuid.NewV4()
+				if err != nil {
+					return err
+				}
+			}
+			entry = &guidEntry{GUID: guid, Path: rel, Fingerprint: fp}
+			reg.entries[guid] = entry
+		}
+
+		reg.byPath[rel] = entry
+		reg.dirty = true
+
+		episode := catalog[rel]
+		episode.GUID = entry.GUID
+		catalog[rel] = episode
+	}
+
+	reg.migrate = false
+	return firstErr
+}
+
+// save persists the registry atomically when it changed.
+func (reg *guidRegistry) save() error {
+	if reg.path == "" || !reg.dirty {
+		return nil
+	}
+
+	doc := guidDocument{Version: guidRegistryVersion}
+	for _, entry := range reg.entries {
+		doc.Entries = append(doc.Entries, *entry)
+	}
+	sort.Slice(doc.Entries, func(i, j int) bool { return doc.Entries[i].GUID < doc.Entries[j].GUID })
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(reg.path, data, 0o644); err != nil {
+		return err
+	}
+
+	reg.dirty = false
+	return nil
+}
+
+// fileFingerprint hashes the file size together with its leading and
+// trailing bytes. It is cheap on large files yet changes whenever the audio
+// content does, while tag-only edits near the middle rarely matter for
+// identity.
+func fileFingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(info.Size()))
+	h.Write(size[:])
+
+	if _, err := io.CopyN(h, f, fingerprintChunk); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if info.Size() > fingerprintChunk {
+		offset := max(info.Size()-fingerprintChunk, fingerprintChunk)
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,148 @@
+package library
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func noFingerprint(string) (string, error) { return "", nil }
+
+func TestGUIDRegistryMigratesThenAssignsUUIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guids.json")
+	reg, err := loadGUIDRegistry(path)
+	if err != nil {
+		t.Fatalf("loadGUIDRegistry: %v", err)
+	}
+
+	catalog := map[string]models.Episode{"old.mp3": {ID: "old.mp3"}}
+	if err := reg.assign(catalog, map[string]string{"old.mp3": "fp-old"}, noFingerprint); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if got := catalog["old.mp3"].GUID; got != "old.mp3" {
+		t.Fatalf("expected existing episode to keep its path as GUID, got %q", got)
+	}
+
+	catalog["new.mp3"] = models.Episode{ID: "new.mp3"}
+	if err := reg.assign(catalog, map[string]string{"new.mp3": "fp-new"}, noFingerprint); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	guid := catalog["new.mp3"].GUID
+	if len(guid) != 36 || guid[14] != '4' {
+		t.Fatalf("expected a random UUID for a new episode, got %q", guid)
+	}
+	if err := reg.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	reloaded, err := loadGUIDRegistry(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	fresh := map[string]models.Episode{"old.mp3": {}, "new.mp3": {}}
+	if err := reloaded.assign(fresh, nil, noFingerprint); err != nil {
+		t.Fatalf("assign after reload: %v", err)
+	}
+	if fresh["old.mp3"].GUID != "old.mp3" || fresh["new.mp3"].GUID != guid {
+		t.Fatalf("GUIDs changed across reload: %+v", fresh)
+	}
+}
+
+func TestGUIDRegistryFollowsRenames(t *testing.T) {
+	reg, err := loadGUIDRegistry(filepath.Join(t.TempDir(), "guids.json"))
+	if err != nil {
+		t.Fatalf("loadGUIDRegistry: %v", err)
+	}
+	reg.migrate = false
+
+	catalog := map[string]models.Episode{"a.mp3": {}, "b.mp3": {}}
+	fps := map[string]string{"a.mp3": "fp-a", "b.mp3": "fp-b"}
+	if err := reg.assign(catalog, fps, noFingerprint); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	guidA := catalog["a.mp3"].GUID
+
+	delete(catalog, "a.mp3")
+	catalog["archive/a.mp3"] = models.Episode{}
+	if err := reg.assign(catalog, map[string]string{"archive/a.mp3": "fp-a"}, noFingerprint); err != nil {
+		t.Fatalf("assign after move: %v", err)
+	}
+	if got := catalog["archive/a.mp3"].GUID; got != guidA {
+		t.Fatalf("expected moved file to keep GUID %q, got %q", guidA, got)
+	}
+
+	catalog["c.mp3"] = models.Episode{}
+	if err := reg.assign(catalog, map[string]string{"c.mp3": "fp-a"}, noFingerprint); err != nil {
+		t.Fatalf("assign copy: %v", err)
+	}
+	if got := catalog["c.mp3"].GUID; got == guidA {
+		t.Fatalf("copy of a present file must not steal its GUID")
+	}
+}
+
+func TestLibraryKeepsGUIDAcrossRename(t *testing.T) {
+	root := t.TempDir()
+	state := t.TempDir()
+	opts := Options{GUIDFile: filepath.Join(state, "guids.json")}
+	logger := log.New(io.Discard, "", 0)
+
+	if err := os.WriteFile(filepath.Join(root, "first.wav"), []byte("first"), 0o644); err != nil {
+		t.Fatalf("write first: %v", err)
+	}
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, opts)
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	if err := os.WriteFile(filepath.Join(root, "second.wav"), []byte("second"), 0o644); err != nil {
+		t.Fatalf("write second: %v", err)
+	}
+	waitFor(t, func() bool { return len(lib.ListEpisodes()) == 2 }, "detect second file")
+
+	guids := make(map[string]string)
+	for _, ep := range lib.ListEpisodes() {
+		guids[ep.RelativePath] = ep.GUID
+	}
+	if guids["first.wav"] != "first.wav" {
+		t.Fatalf("expected pre-existing episode to migrate with its path GUID, got %q", guids["first.wav"])
+	}
+	if guids["second.wav"] == "" || guids["second.wav"] == "second.wav" {
+		t.Fatalf("expected new episode to get a UUID, got %q", guids["second.wav"])
+	}
+
+	if err := os.Rename(filepath.Join(root, "second.wav"), filepath.Join(root, "renamed.wav")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	waitFor(t, func() bool {
+		for _, ep := range lib.ListEpisodes() {
+			if ep.RelativePath == "renamed.wav" {
+				return ep.GUID == guids["second.wav"]
+			}
+		}
+		return false
+	}, "renamed episode keeps its GUID")
+
+	if err := lib.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	restarted, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, opts)
+	if err != nil {
+		t.Fatalf("NewLibrary after restart: %v", err)
+	}
+	t.Cleanup(func() { _ = restarted.Close() })
+	for _, ep := range restarted.ListEpisodes() {
+		want := guids["second.wav"]
+		if ep.RelativePath == "first.wav" {
+			want = "first.wav"
+		}
+		if ep.GUID != want {
+			t.Fatalf("GUID for %s changed across restart: got %q want %q", ep.RelativePath, ep.GUID, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"home-podcast/internal/fsutil"
+	"home-podcast/internal/metadata"
+	"home-podcast/internal/models"
+)
+
+// indexVersion identifies the on-disk layout of the metadata index. Bump it
+// whenever the file structure changes in a way older readers cannot handle.
+const indexVersion = 2
+
+// indexSchema fingerprints the models.Episode layout so that adding, removing
+// or retyping fields invalidates previously persisted entries automatically.
+var indexSchema = schemaSignature(reflect.TypeOf(models.Episode{}))
+
+type indexEntry struct {
+	Size       int64          `json:"size"`
+	ModTime    int64          `json:"mod_time"`
+	Companions string         `json:"companions,omitempty"`
+	Episode    models.Episode `json:"episode"`
+}
+
+type indexDocument struct {
+	Version int                   `json:"version"`
+	Schema  string                `json:"schema"`
+	Mode    string                `json:"mode,omitempty"`
+	Entries map[string]indexEntry `json:"entries"`
+}
+
+// metadataIndex caches extracted episode metadata keyed by relative path and
+// fingerprinted by file size and modification time, plus the same details of
+// the episode's companion files (sidecar and directory cover). It is not safe for
+// concurrent use; callers serialise access through the library scan lock.
+type metadataIndex struct {
+	path    string
+	mode    string
+	entries map[string]indexEntry
+	dirty   bool
+}
+
+// loadIndex reads the index stored at path. A missing, unreadable or outdated
+// file yields an empty index; the reason is returned alongside so callers can
+// log it. An empty path produces an in-memory index that is never persisted.
+// mode describes extraction settings that affect the stored metadata; an
+// index written under a different mode is discarded.
+func loadIndex(path, mode string) (*metadataIndex, error) {
+	idx := &metadataIndex{
+		path:    path,
+		mode:    mode,
+		entries: make(map[string]indexEntry),
+	}
+	if path == "" {
+		return idx, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return idx, nil
+		}
+		return idx, err
+	}
+
+	var doc indexDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		idx.dirty = true
+		return idx, fmt.Errorf("decode index: %w", err)
+	}
+
+	if doc.Version != indexVersion || doc.Schema != indexSchema {
+		idx.dirty = true
+		return idx, fmt.Errorf("index version %d/%s does not match %d/%s", doc.Version, doc.Schema, indexVersion, indexSchema)
+	}
+	if doc.Mode != mode {
+		idx.dirty = true
+		return idx, fmt.Errorf("index extraction mode %q does not match %q", doc.Mode, mode)
+	}
+
+	for rel, entry := range doc.Entries {
+		idx.entries[rel] = entry
+	}
+	return idx, nil
+}
+
+// lookup returns the cached episode for rel when its fingerprint still
+// matches. companions is the stamp produced by companionStamp.
+func (idx *metadataIndex) lookup(rel string, info fs.FileInfo, companions string) (models.Episode, bool) {
+	entry, ok := idx.entries[rel]
+	if !ok {
+		return models.Episode{}, false
+	}
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() || entry.Companions != companions {
+		return models.Episode{}, false
+	}
+	return entry.Episode, true
+}
+
+// store records freshly extracted metadata for rel.
+func (idx *metadataIndex) store(rel string, info fs.FileInfo, companions string, episode models.Episode) {
+	idx.entries[rel] = indexEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Companions: companions,
+		Episode:    episode,
+	}
+	idx.dirty = true
+}
+
+// extractionMode summarises the metadata options that change extracted
+// values, for use as the index mode.
+func extractionMode(opts metadata.Options) string {
+	if opts.AccurateMP3 {
+		return "mp3=accurate"
+	}
+	return ""
+}
+
+// companionStamp identifies the files whose content feeds an episode's
+// metadata besides the audio itself, namely its sidecar, chapters file and
+// the directory cover image, by name, size and modification time. Transcripts
+// are listed by name only, since their content is served straight from disk.
+// dir is the listing of the directory holding path.
+func companionStamp(path string, dir *metadata.Directory) string {
+	var parts []string
+	if sidecar, info := dir.Sidecar(path); sidecar != "" {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", filepath.Base(sidecar), info.Size(), info.ModTime().UnixNano()))
+	}
+	if chapters, info := dir.ChaptersFile(path); chapters != "" {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", filepath.Base(chapters), info.Size(), info.ModTime().UnixNano()))
+	}
+	if cover, info := dir.Artwork(); cover != "" {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", filepath.Base(cover), info.Size(), info.ModTime().UnixNano()))
+	}
+	parts = append(parts, transcriptNames(path, dir)...)
+	return strings.Join(parts, "|")
+}
+
+// remove forgets rel.
+func (idx *metadataIndex) remove(rel string) {
+	if _, ok := idx.entries[rel]; ok {
+		delete(idx.entries, rel)
+		idx.dirty = true
+	}
+}
+
+// retain drops every entry whose path is not in keep.
+func (idx *metadataIndex) retain(keep map[string]struct{}) {
+	for rel := range idx.entries {
+		if _, ok := keep[rel]; !ok {
+			delete(idx.entries, rel)
+			idx.dirty = true
+		}
+	}
+}
+
+// save persists the index when it changed since the last save. The document
+// is written to a temporary file in the same directory and renamed into
+// place so a crash never leaves a truncated index behind.
+func (idx *metadataIndex) save() error {
+	if idx.path == "" || !idx.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(indexDocument{
+		Version: indexVersion,
+		Schema:  indexSchema,
+		Mode:    idx.mode,
+		Entries: idx.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFileAtomic(idx.path, data, 0o644); err != nil {
+		return err
+	}
+
+	idx.dirty = false
+	return nil
+}
+
+func schemaSignature(t reflect.Type) string {
+	var b strings.Builder
+	describeType(&b, t, map[reflect.Type]bool{})
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func describeType(b *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		b.WriteString(t.Kind().String())
+		b.WriteByte('(')
+		describeType(b, t.Elem(), seen)
+		b.WriteByte(')')
+	case reflect.Map:
+		b.WriteString("map(")
+		describeType(b, t.Key(), seen)
+		b.WriteByte(',')
+		describeType(b, t.Elem(), seen)
+		b.WriteByte(')')
+	case reflect.Struct:
+		b.WriteString(t.String())
+		if seen[t] || t.PkgPath() == "time" {
+			return
+		}
+		seen[t] = true
+		b.WriteByte('{')
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			b.WriteString(field.Name)
+			b.WriteByte(' ')
+			b.WriteString(string(field.Tag))
+			b.WriteByte(' ')
+			describeType(b, field.Type, seen)
+			b.WriteByte(';')
+		}
+		b.WriteByte('}')
+	default:
+		b.WriteString(t.String())
+	}
+}
@@ -0,0 +1,223 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestMetadataIndexRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.json")
+	audio := filepath.Join(dir, "clip.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	info, err := os.Stat(audio)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	idx, err := loadIndex(indexPath, "")
+	if err != nil {
+		t.Fatalf("loadIndex missing file: %v", err)
+	}
+	idx.store("clip.wav", info, "", models.Episode{ID: "clip.wav", Title: "Clip"})
+	if err := idx.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	reloaded, err := loadIndex(indexPath, "")
+	if err != nil {
+		t.Fatalf("loadIndex: %v", err)
+	}
+	ep, ok := reloaded.lookup("clip.wav", info, "")
+	if !ok || ep.Title != "Clip" {
+		t.Fatalf("expected cached episode, got %+v (ok=%v)", ep, ok)
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(audio, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	changed, err := os.Stat(audio)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if _, ok := reloaded.lookup("clip.wav", changed, ""); ok {
+		t.Fatalf("expected lookup miss after modification time change")
+	}
+	if _, ok := reloaded.lookup("clip.wav", info, "clip.yaml:12:34"); ok {
+		t.Fatalf("expected lookup miss after sidecar change")
+	}
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no leftover temp files, got %v", entries)
+	}
+}
+
+func TestMetadataIndexDiscardsOutdatedSchema(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.json")
+	doc := indexDocument{
+		Version: indexVersion,
+		Schema:  "stale",
+		Entries: map[string]indexEntry{"a.wav": {Size: 1}},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(indexPath, data, 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	idx, err := loadIndex(indexPath, "")
+	if err == nil {
+		t.Fatalf("expected schema mismatch to be reported")
+	}
+	if len(idx.entries) != 0 {
+		t.Fatalf("expected outdated entries to be dropped, got %d", len(idx.entries))
+	}
+
+	if err := os.WriteFile(indexPath, []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("write corrupt index: %v", err)
+	}
+	idx, err = loadIndex(indexPath, "")
+	if err == nil || len(idx.entries) != 0 {
+		t.Fatalf("expected corrupt index to be discarded")
+	}
+}
+
+func TestLibraryUsesPersistedIndex(t *testing.T) {
+	root := t.TempDir()
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	audio := filepath.Join(root, "show.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{IndexFile: indexPath})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	if err := lib.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Tamper with the persisted title: a restart with an unchanged file must
+	// serve the cached entry rather than re-extracting metadata.
+	idx, err := loadIndex(indexPath, "")
+	if err != nil {
+		t.Fatalf("loadIndex: %v", err)
+	}
+	entry := idx.entries["show.wav"]
+	entry.Episode.Title = "from index"
+	idx.entries["show.wav"] = entry
+	idx.dirty = true
+	if err := idx.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	lib, err = NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{IndexFile: indexPath})
+	if err != nil {
+		t.Fatalf("NewLibrary restart: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	eps := lib.ListEpisodes()
+	if len(eps) != 1 || eps[0].Title != "from index" {
+		t.Fatalf("expected cached episode after restart, got %+v", eps)
+	}
+}
+
+// writeFlatLibrary fills dir with count audio files sharing one cover image
+// and directory chapters file, each with a transcript, as uploads produce.
+func writeFlatLibrary(tb testing.TB, dir string, count int) {
+	tb.Helper()
+	for _, name := range []string{"cover.jpg", "chapters.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			tb.Fatalf("write %s: %v", name, err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		stem := filepath.Join(dir, fmt.Sprintf("episode-%05d", i))
+		if err := os.WriteFile(stem+".wav", []byte("audio"), 0o644); err != nil {
+			tb.Fatalf("write audio: %v", err)
+		}
+		if err := os.WriteFile(stem+".en.vtt", []byte("WEBVTT\n"), 0o644); err != nil {
+			tb.Fatalf("write transcript: %v", err)
+		}
+	}
+}
+
+func TestScanBatchListsEachDirectoryOnce(t *testing.T) {
+	root := t.TempDir()
+	writeFlatLibrary(t, root, 300)
+
+	lib := &Library{root: root, index: &metadataIndex{entries: make(map[string]indexEntry)}}
+	batch := newScanBatch(nil)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".wav" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("Info: %v", err)
+		}
+		lib.collect(batch, filepath.Join(root, entry.Name()), info)
+	}
+
+	if len(batch.dirs) != 1 || len(batch.jobs) != 300 {
+		t.Fatalf("expected one listing for 300 jobs, got %d listings and %d jobs", len(batch.dirs), len(batch.jobs))
+	}
+	job := batch.jobs[42]
+	for _, part := range []string{"chapters.json:", "cover.jpg:", "episode-00042.en.vtt"} {
+		if !strings.Contains(job.companions, part) {
+			t.Fatalf("expected %q in the companion stamp %q", part, job.companions)
+		}
+	}
+	if strings.Contains(job.companions, "episode-00043") {
+		t.Fatalf("expected only the episode's own transcript in %q", job.companions)
+	}
+	transcripts := lib.findTranscripts(job.path, job.dir)
+	if len(transcripts) != 1 || transcripts[0].Path != "episode-00042.en.vtt" || transcripts[0].Language != "en" {
+		t.Fatalf("unexpected transcripts %+v", transcripts)
+	}
+}
+
+// BenchmarkLibraryWarmRescan measures a rescan of a large flat directory
+// whose metadata is already indexed, the common case on restart.
+func BenchmarkLibraryWarmRescan(b *testing.B) {
+	root := b.TempDir()
+	writeFlatLibrary(b, root, 5000)
+	lib, err := NewLibrary(root, []string{".wav"}, time.Hour, log.New(io.Discard, "", 0), Options{})
+	if err != nil {
+		b.Fatalf("NewLibrary: %v", err)
+	}
+	b.Cleanup(func() { _ = lib.Close() })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := lib.refresh(); err != nil {
+			b.Fatalf("refresh: %v", err)
+		}
+	}
+}
@@ -1,20 +1,45 @@
 package library
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
-
 	"home-podcast/internal/metadata"
 	"home-podcast/internal/models"
 )
 
+// Options tunes optional Library behaviour.
+type Options struct {
+	// IndexFile is the path of the persistent metadata index. When empty the
+	// index is kept in memory only and every restart re-extracts metadata.
+	IndexFile string
+
+	// GUIDFile is the path of the persistent GUID registry that keeps episode
+	// GUIDs stable across renames. When empty each episode's GUID is its
+	// relative path.
+	GUIDFile string
+
+	// ArtworkDir is where cover images are cached by content hash. When
+	// empty they are cached in memory.
+	ArtworkDir string
+
+	// Workers bounds the number of files whose metadata is extracted
+	// concurrently. Zero or negative values use one worker per CPU.
+	Workers int
+
+	// Metadata is passed to metadata.BuildEpisode for every extracted file.
+	Metadata metadata.Options
+}
+
 // Library monitors an audio directory and keeps in-memory metadata for clients.
 type Library struct {
 	root    string
@@ -22,12 +47,31 @@ type Library struct {
 	watcher *fsnotify.Watcher
 	logger  *log.Logger
 
-	mu       sync.RWMutex
-	episodes []models.Episode
+	mu         sync.RWMutex
+	episodes   []models.Episode
+	generation uint64
+	// history holds the recent change sets for ChangesSince. It changes
+	// together with generation, so no reader sees one without the other.
+	history []models.ChangeSet
+
+	scanMu   sync.Mutex
+	index    *metadataIndex
+	guids    *guidRegistry
+	artwork  *artworkCache
+	metadata metadata.Options
+	catalog  map[string]models.Episode
+	workers  int
 
 	refreshMu    sync.Mutex
 	refreshTimer *time.Timer
 	refreshDelay time.Duration
+	pending      map[string]fsnotify.Op
+	fullRefresh  bool
+
+	subMu      sync.Mutex
+	subs       map[uint64]chan models.ChangeSet
+	nextSubID  uint64
+	subsClosed bool
 
 	done      chan struct{}
 	wg        sync.WaitGroup
@@ -36,7 +80,7 @@ type Library struct {
 }
 
 // NewLibrary creates a new Library and starts watching the provided root path.
-func NewLibrary(root string, allowed []string, debounce time.Duration, logger *log.Logger) (*Library, error) {
+func NewLibrary(root string, allowed []string, debounce time.Duration, logger *log.Logger, opts Options) (*Library, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -52,6 +96,8 @@ func NewLibrary(root string, allowed []string, debounce time.Duration, logger *l
 		watcher:      watcher,
 		logger:       logger,
 		refreshDelay: debounce,
+		pending:      make(map[string]fsnotify.Op),
+		subs:         make(map[uint64]chan models.ChangeSet),
 		done:         make(chan struct{}),
 	}
 
@@ -59,6 +105,32 @@ func NewLibrary(root string, allowed []string, debounce time.Duration, logger *l
 		lib.allowed[strings.ToLower(ext)] = struct{}{}
 	}
 
+	index, err := loadIndex(opts.IndexFile, extractionMode(opts.Metadata))
+	if err != nil {
+		logger.Printf("metadata index %s discarded: %v", opts.IndexFile, err)
+	}
+	lib.index = index
+
+	guids, err := loadGUIDRegistry(opts.GUIDFile)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	lib.guids = guids
+
+	artwork, err := newArtworkCache(opts.ArtworkDir)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	lib.artwork = artwork
+
+	lib.metadata = opts.Metadata
+	lib.workers = opts.Workers
+	if lib.workers <= 0 {
+		lib.workers = runtime.NumCPU()
+	}
+
 	lib.addWatchRecursive(root)
 
 	if err := lib.refresh(); err != nil {
@@ -86,6 +158,7 @@ func (l *Library) Close() error {
 
 		l.closeErr = l.watcher.Close()
 		l.wg.Wait()
+		l.closeSubscribers()
 	})
 	return l.closeErr
 }
@@ -115,6 +188,9 @@ func (l *Library) run() {
 				return
 			}
 			l.logger.Printf("watcher error: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				l.scheduleFullRefresh()
+			}
 		case <-l.done:
 			return
 		}
@@ -125,18 +201,53 @@ func (l *Library) handleEvent(event fsnotify.Event) {
 	if event.Op&fsnotify.Create == fsnotify.Create {
 		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
 			l.addWatchRecursive(event.Name)
+			l.scheduleRefresh(event.Name, event.Op)
+			return
 		}
 	}
 
 	if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+		if !l.isAllowed(event.Name) && metadata.IsSidecar(event.Name) {
+			// A sidecar or chapters file edit is an edit of the episode it
+			// describes.
+			for _, owner := range l.sidecarOwners(event.Name) {
+				l.scheduleRefresh(owner, fsnotify.Write)
+			}
+			return
+		}
+		if !l.isAllowed(event.Name) && isTranscript(event.Name) {
+			// Transcripts are listed on the episodes they belong to.
+			for _, owner := range l.transcriptOwners(event.Name) {
+				l.scheduleRefresh(owner, fsnotify.Write)
+			}
+			return
+		}
+		if metadata.IsDirectoryArtwork(event.Name) {
+			// A directory cover applies to every episode beside it.
+			for _, owner := range l.audioInDir(filepath.Dir(event.Name), func(string) bool { return true }) {
+				l.scheduleRefresh(owner, fsnotify.Write)
+			}
+			return
+		}
 		if l.isAllowed(event.Name) || event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
-			l.scheduleRefresh()
+			l.scheduleRefresh(event.Name, event.Op)
 		}
 	}
 }
 
+// refresh walks the whole audio root and rebuilds the catalog from scratch,
+// reusing index entries for files whose fingerprint is unchanged.
 func (l *Library) refresh() error {
-	var episodes []models.Episode
+	l.scanMu.Lock()
+	defer l.scanMu.Unlock()
+
+	return l.rescanLocked()
+}
+
+func (l *Library) rescanLocked() error {
+	start := time.Now()
+	batch := newScanBatch(nil)
+	seen := make(map[string]struct{})
 
 	err := filepath.WalkDir(l.root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -152,19 +263,168 @@ func (l *Library) refresh() error {
 			return nil
 		}
 
-		episode, err := metadata.BuildEpisode(path, l.root)
+		info, err := d.Info()
 		if err != nil {
-			l.logger.Printf("metadata error for %s: %v", path, err)
+			l.logger.Printf("stat error for %s: %v", path, err)
 			return nil
 		}
 
-		episodes = append(episodes, episode)
+		seen[l.relativePath(path)] = struct{}{}
+		l.collect(batch, path, info)
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	l.extract(batch)
+	l.assignGUIDs(batch)
+	l.pruneArtwork(batch.catalog)
+
+	l.index.retain(seen)
+	if err := l.index.save(); err != nil {
+		l.logger.Printf("metadata index save error: %v", err)
+	}
+
+	l.publish(batch.catalog)
+	l.logger.Printf("library refreshed with %d episodes (%d from index, %d extracted) in %s",
+		len(batch.catalog), batch.cached, len(batch.jobs), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// applyChanges updates the catalog for the given paths only. Paths that no
+// longer exist are removed together with anything beneath them, new
+// directories are walked, and audio files are re-extracted when their
+// fingerprint changed. A rename of a directory that held episodes falls back
+// to a full rescan because its new location may not have produced events.
+func (l *Library) applyChanges(changes map[string]fsnotify.Op) error {
+	l.scanMu.Lock()
+	defer l.scanMu.Unlock()
+
+	start := time.Now()
+	batch := newScanBatch(l.catalog)
+
+	for path, op := range changes {
+		rel := l.relativePath(path)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				l.logger.Printf("stat error for %s: %v", path, err)
+				continue
+			}
+			if op&fsnotify.Rename == fsnotify.Rename && hasDescendants(batch.catalog, rel) {
+				l.logger.Printf("directory %s renamed; rescanning library", path)
+				return l.rescanLocked()
+			}
+			l.removeEpisodes(batch.catalog, rel)
+			continue
+		}
+
+		if info.IsDir() {
+			l.walkInto(batch, path)
+			continue
+		}
+
+		if !l.isAllowed(path) {
+			continue
+		}
+
+		l.collect(batch, path, info)
+	}
+
+	l.extract(batch)
+	l.assignGUIDs(batch)
+	l.pruneArtwork(batch.catalog)
+
+	if err := l.index.save(); err != nil {
+		l.logger.Printf("metadata index save error: %v", err)
+	}
+
+	l.publish(batch.catalog)
+	l.logger.Printf("library updated %d paths with %d episodes (%d extracted) in %s",
+		len(changes), len(batch.catalog), len(batch.jobs), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (l *Library) walkInto(batch *scanBatch, dir string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			l.logger.Printf("walk error for %s: %v", path, err)
+			return nil
+		}
+
+		if d.IsDir() || !l.isAllowed(path) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			l.logger.Printf("stat error for %s: %v", path, err)
+			return nil
+		}
+
+		l.collect(batch, path, info)
+		return nil
+	})
+}
+
+// sidecarOwners returns the audio files in the same directory whose sidecar
+// or chapters file is path, i.e. those sharing its file name stem, or every
+// audio file beside a directory chapters file.
+func (l *Library) sidecarOwners(path string) []string {
+	if metadata.IsDirectoryChaptersFile(path) {
+		return l.audioInDir(filepath.Dir(path), func(string) bool { return true })
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if metadata.IsChaptersFile(path) {
+		stem = metadata.ChaptersStem(path)
+	}
+	return l.audioInDir(filepath.Dir(path), func(name string) bool {
+		return strings.TrimSuffix(name, filepath.Ext(name)) == stem
+	})
+}
+
+// audioInDir lists the audio files directly inside dir whose name satisfies
+// match.
+func (l *Library) audioInDir(dir string, match func(name string) bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !match(entry.Name()) {
+			continue
+		}
+		if path := filepath.Join(dir, entry.Name()); l.isAllowed(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func (l *Library) removeEpisodes(catalog map[string]models.Episode, rel string) {
+	prefix := rel + "/"
+	for key := range catalog {
+		if key == rel || strings.HasPrefix(key, prefix) {
+			delete(catalog, key)
+			l.index.remove(key)
+		}
+	}
+}
+
+// publish swaps in the new catalog and notifies subscribers of the
+// differences. Callers must hold scanMu.
+func (l *Library) publish(catalog map[string]models.Episode) {
+	changes := diffCatalogs(l.catalog, catalog)
+
+	episodes := make([]models.Episode, 0, len(catalog))
+	for _, episode := range catalog {
+		episodes = append(episodes, episode)
+	}
+
 	sort.SliceStable(episodes, func(i, j int) bool {
 		if episodes[i].RelativePath == episodes[j].RelativePath {
 			return episodes[i].Filename < episodes[j].Filename
@@ -172,15 +432,38 @@ func (l *Library) refresh() error {
 		return episodes[i].RelativePath < episodes[j].RelativePath
 	})
 
+	l.catalog = catalog
+
 	l.mu.Lock()
 	l.episodes = episodes
+	var set models.ChangeSet
+	if len(changes) > 0 {
+		l.generation++
+		set = models.ChangeSet{Generation: l.generation, Changes: changes}
+		l.record(set)
+	}
 	l.mu.Unlock()
 
-	l.logger.Printf("library refreshed with %d episodes", len(episodes))
-	return nil
+	if len(changes) > 0 {
+		l.broadcast(set)
+	}
+}
+
+// scheduleRefresh records path as dirty and (re)arms the debounce timer.
+func (l *Library) scheduleRefresh(path string, op fsnotify.Op) {
+	l.schedule(func() {
+		l.pending[path] |= op
+	})
 }
 
-func (l *Library) scheduleRefresh() {
+// scheduleFullRefresh discards pending per-path work in favour of a full walk.
+func (l *Library) scheduleFullRefresh() {
+	l.schedule(func() {
+		l.fullRefresh = true
+	})
+}
+
+func (l *Library) schedule(mark func()) {
 	select {
 	case <-l.done:
 		return
@@ -190,21 +473,33 @@ func (l *Library) scheduleRefresh() {
 	l.refreshMu.Lock()
 	defer l.refreshMu.Unlock()
 
+	mark()
+
 	if l.refreshTimer != nil {
 		l.refreshTimer.Stop()
 	}
 
 	var timer *time.Timer
 	timer = time.AfterFunc(l.refreshDelay, func() {
-		if err := l.refresh(); err != nil {
-			l.logger.Printf("refresh error: %v", err)
-		}
-
 		l.refreshMu.Lock()
+		changes := l.pending
+		full := l.fullRefresh
+		l.pending = make(map[string]fsnotify.Op)
+		l.fullRefresh = false
 		if l.refreshTimer == timer {
 			l.refreshTimer = nil
 		}
 		l.refreshMu.Unlock()
+
+		var err error
+		if full {
+			err = l.refresh()
+		} else if len(changes) > 0 {
+			err = l.applyChanges(changes)
+		}
+		if err != nil {
+			l.logger.Printf("refresh error: %v", err)
+		}
 	})
 
 	l.refreshTimer = timer
@@ -226,6 +521,24 @@ func (l *Library) addWatchRecursive(path string) {
 	})
 }
 
+func (l *Library) relativePath(path string) string {
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func hasDescendants(catalog map[string]models.Episode, rel string) bool {
+	prefix := rel + "/"
+	for key := range catalog {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *Library) isAllowed(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	_, ok := l.allowed[ext]
@@ -1,12 +1,18 @@
 package library
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"home-podcast/internal/models"
 )
 
 func TestLibraryWatchesAndRefreshes(t *testing.T) {
@@ -17,7 +23,7 @@ func TestLibraryWatchesAndRefreshes(t *testing.T) {
 	}
 
 	logger := log.New(io.Discard, "", 0)
-	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
 	if err != nil {
 		t.Fatalf("NewLibrary: %v", err)
 	}
@@ -85,7 +91,7 @@ func TestLibraryIgnoresNonAudioFiles(t *testing.T) {
 	}
 
 	logger := log.New(io.Discard, "", 0)
-	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
 	if err != nil {
 		t.Fatalf("NewLibrary: %v", err)
 	}
@@ -122,7 +128,7 @@ func TestLibraryMultipleExtensions(t *testing.T) {
 	}
 
 	logger := log.New(io.Discard, "", 0)
-	lib, err := NewLibrary(root, []string{".mp3", ".flac"}, 10*time.Millisecond, logger)
+	lib, err := NewLibrary(root, []string{".mp3", ".flac"}, 10*time.Millisecond, logger, Options{})
 	if err != nil {
 		t.Fatalf("NewLibrary: %v", err)
 	}
@@ -135,7 +141,7 @@ func TestLibraryEmptyDirectory(t *testing.T) {
 	root := t.TempDir()
 
 	logger := log.New(io.Discard, "", 0)
-	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
 	if err != nil {
 		t.Fatalf("NewLibrary: %v", err)
 	}
@@ -165,7 +171,7 @@ func TestLibraryPreexistingSubdirectory(t *testing.T) {
 	}
 
 	logger := log.New(io.Discard, "", 0)
-	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
 	if err != nil {
 		t.Fatalf("NewLibrary: %v", err)
 	}
@@ -179,6 +185,118 @@ func TestLibraryPreexistingSubdirectory(t *testing.T) {
 	}
 }
 
+func TestLibraryParallelScanKeepsOrder(t *testing.T) {
+	root := t.TempDir()
+	var want []string
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("ep-%02d.wav", i)
+		want = append(want, name)
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{Workers: 8})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	var got []string
+	for _, ep := range lib.ListEpisodes() {
+		got = append(got, ep.RelativePath)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected sorted episodes %v, got %v", want, got)
+	}
+}
+
+func TestLibraryAppliesIncrementalChanges(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.wav"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("write a: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	// Mark the in-memory entry so a full rescan (which would re-read it from
+	// the index) is distinguishable from a per-path update.
+	lib.scanMu.Lock()
+	catalog := make(map[string]models.Episode, len(lib.catalog))
+	for rel, ep := range lib.catalog {
+		catalog[rel] = ep
+	}
+	sentinel := catalog["a.wav"]
+	sentinel.Title = "sentinel"
+	catalog["a.wav"] = sentinel
+	lib.publish(catalog)
+	lib.scanMu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(root, "b.wav"), []byte("b"), 0o644); err != nil {
+		t.Fatalf("write b: %v", err)
+	}
+	waitFor(t, func() bool { return len(lib.ListEpisodes()) == 2 }, "detect b.wav")
+
+	for _, ep := range lib.ListEpisodes() {
+		if ep.RelativePath == "a.wav" && ep.Title != "sentinel" {
+			t.Fatalf("expected untouched episode to be preserved, got title %q", ep.Title)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(root, "b.wav")); err != nil {
+		t.Fatalf("remove b: %v", err)
+	}
+	waitFor(t, func() bool { return len(lib.ListEpisodes()) == 1 }, "remove b.wav")
+}
+
+func TestLibraryHandlesDirectoryRenameAndRemoval(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "season1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"one.wav", "two.wav"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	renamed := filepath.Join(root, "archive")
+	if err := os.Rename(dir, renamed); err != nil {
+		t.Fatalf("rename dir: %v", err)
+	}
+	waitFor(t, func() bool {
+		eps := lib.ListEpisodes()
+		if len(eps) != 2 {
+			return false
+		}
+		for _, ep := range eps {
+			if !strings.HasPrefix(ep.RelativePath, "archive/") {
+				return false
+			}
+		}
+		return true
+	}, "detect directory rename")
+
+	if err := os.RemoveAll(renamed); err != nil {
+		t.Fatalf("remove dir: %v", err)
+	}
+	waitFor(t, func() bool { return len(lib.ListEpisodes()) == 0 }, "detect directory removal")
+}
+
 func waitFor(t *testing.T, predicate func() bool, label string) {
 	t.Helper()
 	deadline := time.Now().Add(3 * time.Second)
@@ -190,3 +308,146 @@ func waitFor(t *testing.T, predicate func() bool, label string) {
 	}
 	t.Fatalf("timeout waiting for %s", label)
 }
+
+func TestLibraryAppliesSidecarEdits(t *testing.T) {
+	root := t.TempDir()
+	audio := filepath.Join(root, "show.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	titleIs := func(want string) func() bool {
+		return func() bool {
+			eps := lib.ListEpisodes()
+			return len(eps) == 1 && eps[0].Title == want
+		}
+	}
+	waitFor(t, titleIs("show"), "initial scan")
+
+	sidecar := filepath.Join(root, "show.yaml")
+	if err := os.WriteFile(sidecar, []byte("title: From Sidecar\n"), 0o644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+	waitFor(t, titleIs("From Sidecar"), "apply new sidecar")
+
+	if err := os.WriteFile(sidecar, []byte("title: Edited Sidecar Title\n"), 0o644); err != nil {
+		t.Fatalf("edit sidecar: %v", err)
+	}
+	waitFor(t, titleIs("Edited Sidecar Title"), "apply sidecar edit")
+
+	if err := os.Remove(sidecar); err != nil {
+		t.Fatalf("remove sidecar: %v", err)
+	}
+	waitFor(t, titleIs("show"), "fall back after sidecar removal")
+
+	chapters := filepath.Join(root, "show.chapters.json")
+	if err := os.WriteFile(chapters, []byte(`{"version":"1.2.0","chapters":[{"startTime":0,"title":"Intro"}]}`), 0o644); err != nil {
+		t.Fatalf("write chapters: %v", err)
+	}
+	waitFor(t, func() bool {
+		eps := lib.ListEpisodes()
+		return len(eps) == 1 && len(eps[0].Chapters) == 1 && eps[0].Chapters[0].Title == "Intro"
+	}, "apply chapters file")
+}
+
+func TestLibraryAssociatesTranscripts(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"show.wav":       "audio",
+		"show.vtt":       "WEBVTT\n",
+		"show.en-GB.srt": "1\n",
+		"show.notes.vtt": "not a language tag",
+		"other.srt":      "1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	eps := lib.ListEpisodes()
+	want := []models.Transcript{
+		{Path: "show.en-GB.srt", Type: "application/x-subrip", Language: "en-GB"},
+		{Path: "show.vtt", Type: "text/vtt"},
+	}
+	if len(eps) != 1 || fmt.Sprint(eps[0].Transcripts) != fmt.Sprint(want) {
+		t.Fatalf("unexpected transcripts %+v", eps)
+	}
+
+	if err := os.Remove(filepath.Join(root, "show.vtt")); err != nil {
+		t.Fatalf("remove transcript: %v", err)
+	}
+	waitFor(t, func() bool {
+		eps := lib.ListEpisodes()
+		return len(eps) == 1 && len(eps[0].Transcripts) == 1
+	}, "drop removed transcript")
+}
+
+func TestLibraryCachesDirectoryArtwork(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.wav", "b.wav"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	cover := filepath.Join(root, "cover.jpg")
+	if err := os.WriteFile(cover, []byte("first cover"), 0o644); err != nil {
+		t.Fatalf("write cover: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	artworkDir := filepath.Join(t.TempDir(), "artwork")
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{ArtworkDir: artworkDir})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	eps := lib.ListEpisodes()
+	if len(eps) != 2 || eps[0].ArtworkID == "" || eps[0].ArtworkID != eps[1].ArtworkID {
+		t.Fatalf("expected both episodes to share the directory cover, got %+v", eps)
+	}
+	first := eps[0].ArtworkID
+
+	content, _, err := lib.OpenArtwork(first)
+	if err != nil {
+		t.Fatalf("OpenArtwork: %v", err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if string(data) != "first cover" {
+		t.Fatalf("unexpected artwork content %q", data)
+	}
+
+	if err := os.WriteFile(cover, []byte("second cover"), 0o644); err != nil {
+		t.Fatalf("rewrite cover: %v", err)
+	}
+	waitFor(t, func() bool {
+		for _, ep := range lib.ListEpisodes() {
+			if ep.ArtworkID == first || ep.ArtworkID == "" {
+				return false
+			}
+		}
+		return true
+	}, "pick up replaced cover")
+
+	if _, _, err := lib.OpenArtwork(first); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected replaced artwork to be pruned, got %v", err)
+	}
+	if _, _, err := lib.OpenArtwork("../../etc/passwd"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected invalid id to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package library
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"home-podcast/internal/metadata"
+	"home-podcast/internal/models"
+)
+
+// scanJob describes a file whose metadata must be extracted.
+type scanJob struct {
+	path       string
+	rel        string
+	info       fs.FileInfo
+	dir        *metadata.Directory
+	companions string
+}
+
+type scanResult struct {
+	episode     models.Episode
+	fingerprint string
+	err         error
+}
+
+// scanBatch accumulates the catalog being built by a scan along with the
+// files that missed the metadata index and still need extraction. Each
+// directory is listed once per batch, so finding the companion files of many
+// audio files in one directory does not read it again for every file.
+type scanBatch struct {
+	catalog      map[string]models.Episode
+	fingerprints map[string]string
+	dirs         map[string]*metadata.Directory
+	jobs         []scanJob
+	cached       int
+}
+
+func newScanBatch(base map[string]models.Episode) *scanBatch {
+	catalog := make(map[string]models.Episode, len(base))
+	for rel, episode := range base {
+		catalog[rel] = episode
+	}
+	return &scanBatch{
+		catalog:      catalog,
+		fingerprints: make(map[string]string),
+		dirs:         make(map[string]*metadata.Directory),
+	}
+}
+
+// directory returns the listing of dir, reading it on first use.
+func (b *scanBatch) directory(dir string) *metadata.Directory {
+	listing, ok := b.dirs[dir]
+	if !ok {
+		listing = metadata.ReadDirectory(dir)
+		b.dirs[dir] = listing
+	}
+	return listing
+}
+
+// collect serves path from the index when its fingerprint matches and queues
+// it for extraction otherwise.
+func (l *Library) collect(batch *scanBatch, path string, info fs.FileInfo) {
+	rel := l.relativePath(path)
+	dir := batch.directory(filepath.Dir(path))
+	companions := companionStamp(path, dir)
+	if episode, ok := l.index.lookup(rel, info, companions); ok {
+		if episode.ArtworkID == "" || l.artwork.has(episode.ArtworkID) {
+			batch.catalog[rel] = episode
+			batch.cached++
+			return
+		}
+	}
+	batch.jobs = append(batch.jobs, scanJob{path: path, rel: rel, info: info, dir: dir, companions: companions})
+}
+
+// extract runs metadata extraction for every queued job on a bounded worker
+// pool, then folds the results into the batch catalog and the index in job
+// order so logging and index updates stay deterministic.
+func (l *Library) extract(batch *scanBatch) {
+	if len(batch.jobs) == 0 {
+		return
+	}
+
+	results := make([]scanResult, len(batch.jobs))
+	workers := min(l.workers, len(batch.jobs))
+
+	trackGUIDs := l.guids.path != ""
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				job := batch.jobs[i]
+				episode, err := metadata.BuildEpisodeIn(job.path, l.root, job.dir, l.metadata)
+				var sidecarErr *metadata.SidecarError
+				if errors.As(err, &sidecarErr) {
+					// The episode is still usable from its embedded tags.
+					l.logger.Printf("metadata warning for %s: %v", job.path, err)
+					err = nil
+				}
+				if err == nil {
+					l.cacheArtwork(job.path, job.dir, &episode)
+					episode.Transcripts = l.findTranscripts(job.path, job.dir)
+				}
+				result := scanResult{episode: episode, err: err}
+				if err == nil && trackGUIDs {
+					fp, fpErr := fileFingerprint(job.path)
+					if fpErr != nil {
+						l.logger.Printf("fingerprint error for %s: %v", job.path, fpErr)
+					}
+					result.fingerprint = fp
+				}
+				results[i] = result
+			}
+		}()
+	}
+	for i := range batch.jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, job := range batch.jobs {
+		result := results[i]
+		if result.err != nil {
+			l.logger.Printf("metadata error for %s: %v", job.path, result.err)
+			delete(batch.catalog, job.rel)
+			l.index.remove(job.rel)
+			continue
+		}
+		l.index.store(job.rel, job.info, job.companions, result.episode)
+		batch.catalog[job.rel] = result.episode
+		if result.fingerprint != "" {
+			batch.fingerprints[job.rel] = result.fingerprint
+		}
+	}
+}
+
+// assignGUIDs gives every episode in the batch its stable GUID and persists
+// any registry changes.
+func (l *Library) assignGUIDs(batch *scanBatch) {
+	err := l.guids.assign(batch.catalog, batch.fingerprints, func(rel string) (string, error) {
+		return fileFingerprint(filepath.Join(l.root, filepath.FromSlash(rel)))
+	})
+	if err != nil {
+		l.logger.Printf("guid assignment error: %v", err)
+	}
+	if err := l.guids.save(); err != nil {
+		l.logger.Printf("guid registry save error: %v", err)
+	}
+}
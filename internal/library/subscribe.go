@@ -0,0 +1,152 @@
+package library
+
+import (
+	"reflect"
+	"sort"
+
+	"home-podcast/internal/models"
+)
+
+// changeHistoryLimit bounds how many recent change sets are retained for
+// ChangesSince.
+const changeHistoryLimit = 256
+
+// Subscribe registers a listener for change sets produced by library
+// refreshes and returns its identifier together with the delivery channel.
+// Delivery never blocks the watcher: when the channel buffer is full the
+// change set is dropped for that subscriber, which can detect the gap through
+// a skipped Generation and resynchronise with ListEpisodes.
+func (l *Library) Subscribe(buffer int) (uint64, <-chan models.ChangeSet) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	ch := make(chan models.ChangeSet, buffer)
+
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	l.nextSubID++
+	id := l.nextSubID
+	if l.subsClosed {
+		close(ch)
+		return id, ch
+	}
+	l.subs[id] = ch
+	return id, ch
+}
+
+// Unsubscribe removes the listener and closes its channel. Unknown
+// identifiers are ignored.
+func (l *Library) Unsubscribe(id uint64) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	if ch, ok := l.subs[id]; ok {
+		delete(l.subs, id)
+		close(ch)
+	}
+}
+
+// Generation reports the identifier of the most recent change set. It
+// increases whenever the set of episodes or their metadata changes.
+func (l *Library) Generation() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.generation
+}
+
+// ChangesSince returns the change sets newer than generation, oldest first.
+// The second result is false when the requested generation is unknown or has
+// already fallen out of the retained history, in which case callers should
+// resynchronise from ListEpisodes instead.
+func (l *Library) ChangesSince(generation uint64) ([]models.ChangeSet, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	current := l.generation
+	if generation > current {
+		return nil, false
+	}
+	if generation == current {
+		return nil, true
+	}
+	if len(l.history) == 0 || l.history[0].Generation > generation+1 {
+		return nil, false
+	}
+
+	var sets []models.ChangeSet
+	for _, set := range l.history {
+		if set.Generation > generation {
+			sets = append(sets, set)
+		}
+	}
+	return sets, true
+}
+
+// record adds set to the history ChangesSince replays. Callers hold l.mu
+// and have just advanced the generation to set's.
+func (l *Library) record(set models.ChangeSet) {
+	l.history = append(l.history, set)
+	if len(l.history) > changeHistoryLimit {
+		l.history = append([]models.ChangeSet(nil), l.history[len(l.history)-changeHistoryLimit:]...)
+	}
+}
+
+// broadcast delivers set to the current subscribers.
+func (l *Library) broadcast(set models.ChangeSet) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	for id, ch := range l.subs {
+		select {
+		case ch <- set:
+		default:
+			l.logger.Printf("subscriber %d is lagging; dropped change set %d", id, set.Generation)
+		}
+	}
+}
+
+func (l *Library) closeSubscribers() {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	for id, ch := range l.subs {
+		delete(l.subs, id)
+		close(ch)
+	}
+	l.subsClosed = true
+}
+
+// diffCatalogs lists the differences between two catalogs ordered by
+// relative path.
+func diffCatalogs(previous, current map[string]models.Episode) []models.EpisodeChange {
+	var changes []models.EpisodeChange
+
+	for rel, next := range current {
+		prev, ok := previous[rel]
+		switch {
+		case !ok:
+			changes = append(changes, models.EpisodeChange{Type: models.ChangeAdded, New: &next})
+		case !reflect.DeepEqual(prev, next):
+			changes = append(changes, models.EpisodeChange{Type: models.ChangeModified, Old: &prev, New: &next})
+		}
+	}
+
+	for rel, prev := range previous {
+		if _, ok := current[rel]; !ok {
+			changes = append(changes, models.EpisodeChange{Type: models.ChangeRemoved, Old: &prev})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changeKey(changes[i]) < changeKey(changes[j])
+	})
+	return changes
+}
+
+func changeKey(change models.EpisodeChange) string {
+	if change.New != nil {
+		return change.New.RelativePath
+	}
+	return change.Old.RelativePath
+}
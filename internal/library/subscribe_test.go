@@ -0,0 +1,246 @@
+package library
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestLibrarySubscribeDeliversTypedChanges(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "first.wav")
+	if err := os.WriteFile(first, []byte("one"), 0o644); err != nil {
+		t.Fatalf("write first: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	initial := lib.Generation()
+	if initial == 0 {
+		t.Fatalf("expected initial scan to produce a generation")
+	}
+
+	id, events := lib.Subscribe(8)
+	defer lib.Unsubscribe(id)
+
+	second := filepath.Join(root, "second.wav")
+	if err := os.WriteFile(second, []byte("two"), 0o644); err != nil {
+		t.Fatalf("write second: %v", err)
+	}
+	set := receiveChange(t, events)
+	if set.Generation != initial+1 {
+		t.Fatalf("expected generation %d, got %d", initial+1, set.Generation)
+	}
+	assertChange(t, set, models.ChangeAdded, "second.wav")
+
+	if err := os.WriteFile(first, []byte("one, re-recorded"), 0o644); err != nil {
+		t.Fatalf("rewrite first: %v", err)
+	}
+	set = receiveChange(t, events)
+	assertChange(t, set, models.ChangeModified, "first.wav")
+	if set.Changes[0].Old == nil || set.Changes[0].New == nil {
+		t.Fatalf("expected old and new episodes on modification")
+	}
+
+	if err := os.Remove(second); err != nil {
+		t.Fatalf("remove second: %v", err)
+	}
+	set = receiveChange(t, events)
+	assertChange(t, set, models.ChangeRemoved, "second.wav")
+	if set.Changes[0].New != nil {
+		t.Fatalf("expected no new episode on removal")
+	}
+}
+
+func TestLibrarySlowSubscriberDoesNotBlock(t *testing.T) {
+	root := t.TempDir()
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 5*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	stalled, _ := lib.Subscribe(0)
+	defer lib.Unsubscribe(stalled)
+
+	for i, name := range []string{"a.wav", "b.wav", "c.wav"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		want := i + 1
+		waitFor(t, func() bool { return len(lib.ListEpisodes()) == want }, "refresh past stalled subscriber")
+	}
+}
+
+func TestLibraryUnsubscribeAndCloseCloseChannels(t *testing.T) {
+	root := t.TempDir()
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+
+	id, events := lib.Subscribe(1)
+	lib.Unsubscribe(id)
+	if _, ok := <-events; ok {
+		t.Fatalf("expected channel to be closed after Unsubscribe")
+	}
+	lib.Unsubscribe(id)
+
+	_, events = lib.Subscribe(1)
+	if err := lib.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, ok := <-events; ok {
+		t.Fatalf("expected channel to be closed after Close")
+	}
+
+	_, events = lib.Subscribe(1)
+	if _, ok := <-events; ok {
+		t.Fatalf("expected subscription after Close to be closed immediately")
+	}
+}
+
+func TestLibraryChangesSince(t *testing.T) {
+	root := t.TempDir()
+
+	logger := log.New(io.Discard, "", 0)
+	lib, err := NewLibrary(root, []string{".wav"}, 10*time.Millisecond, logger, Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	start := lib.Generation()
+	if sets, ok := lib.ChangesSince(start); !ok || len(sets) != 0 {
+		t.Fatalf("expected no changes at current generation, got %v %v", sets, ok)
+	}
+	if _, ok := lib.ChangesSince(start + 10); ok {
+		t.Fatalf("expected future generation to be unknown")
+	}
+
+	for i, name := range []string{"a.wav", "b.wav"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		want := start + uint64(i) + 1
+		waitFor(t, func() bool { return lib.Generation() == want }, "generation bump")
+	}
+
+	sets, ok := lib.ChangesSince(start)
+	if !ok || len(sets) != 2 {
+		t.Fatalf("expected two retained change sets, got %d (ok=%v)", len(sets), ok)
+	}
+	if sets[0].Generation != start+1 || sets[1].Generation != start+2 {
+		t.Fatalf("unexpected generations %d, %d", sets[0].Generation, sets[1].Generation)
+	}
+}
+
+func TestLibraryChangesSinceSeesEveryPublishedGeneration(t *testing.T) {
+	lib, err := NewLibrary(t.TempDir(), []string{".wav"}, time.Hour, log.New(io.Discard, "", 0), Options{})
+	if err != nil {
+		t.Fatalf("NewLibrary: %v", err)
+	}
+	t.Cleanup(func() { _ = lib.Close() })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lib.scanMu.Lock()
+		defer lib.scanMu.Unlock()
+		for i := 0; i < 200; i++ {
+			name := fmt.Sprintf("%03d.wav", i)
+			lib.publish(map[string]models.Episode{name: {ID: name, RelativePath: name}})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// A generation that is visible must already be replayable.
+		current := lib.Generation()
+		if current == 0 {
+			continue
+		}
+		sets, ok := lib.ChangesSince(current - 1)
+		if !ok || len(sets) == 0 || sets[len(sets)-1].Generation < current {
+			t.Fatalf("expected generation %d to be replayable, got %v %v", current, sets, ok)
+		}
+	}
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	previous := map[string]models.Episode{
+		"keep.mp3":   {RelativePath: "keep.mp3", Title: "Keep"},
+		"change.mp3": {RelativePath: "change.mp3", Title: "Before"},
+		"gone.mp3":   {RelativePath: "gone.mp3", Title: "Gone"},
+	}
+	current := map[string]models.Episode{
+		"keep.mp3":   {RelativePath: "keep.mp3", Title: "Keep"},
+		"change.mp3": {RelativePath: "change.mp3", Title: "After"},
+		"new.mp3":    {RelativePath: "new.mp3", Title: "New"},
+	}
+
+	changes := diffCatalogs(previous, current)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+
+	want := []struct {
+		typ models.ChangeType
+		rel string
+	}{
+		{models.ChangeModified, "change.mp3"},
+		{models.ChangeRemoved, "gone.mp3"},
+		{models.ChangeAdded, "new.mp3"},
+	}
+	for i, w := range want {
+		if changes[i].Type != w.typ || changeKey(changes[i]) != w.rel {
+			t.Fatalf("change %d: expected %s %s, got %s %s", i, w.typ, w.rel, changes[i].Type, changeKey(changes[i]))
+		}
+	}
+	if changes[0].Old.Title != "Before" || changes[0].New.Title != "After" {
+		t.Fatalf("unexpected modification payload: %+v", changes[0])
+	}
+}
+
+func receiveChange(t *testing.T, events <-chan models.ChangeSet) models.ChangeSet {
+	t.Helper()
+	select {
+	case set, ok := <-events:
+		if !ok {
+			t.Fatalf("subscription closed unexpectedly")
+		}
+		return set
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for change set")
+	}
+	return models.ChangeSet{}
+}
+
+func assertChange(t *testing.T, set models.ChangeSet, typ models.ChangeType, rel string) {
+	t.Helper()
+	if len(set.Changes) != 1 {
+		t.Fatalf("expected a single change, got %+v", set.Changes)
+	}
+	if set.Changes[0].Type != typ || changeKey(set.Changes[0]) != rel {
+		t.Fatalf("expected %s %s, got %s %s", typ, rel, set.Changes[0].Type, changeKey(set.Changes[0]))
+	}
+}
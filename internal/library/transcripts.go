@@ -0,0 +1,85 @@
+package library
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"home-podcast/internal/metadata"
+	"home-podcast/internal/models"
+)
+
+// transcriptTypes maps the transcript extensions recognised next to audio
+// files to their MIME types.
+var transcriptTypes = map[string]string{
+	".vtt": "text/vtt",
+	".srt": "application/x-subrip",
+}
+
+// transcriptLanguagePattern matches the optional language tag in
+// "<stem>.<language>.vtt", such as "en" or "pt-BR".
+var transcriptLanguagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+func isTranscript(path string) bool {
+	_, ok := transcriptTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// matchTranscript reports whether the file called name is a transcript of the
+// audio file with the given stem: either "<stem>.vtt" or
+// "<stem>.<language>.vtt" (likewise for .srt). It returns the language tag,
+// if any.
+func matchTranscript(stem, name string) (string, bool) {
+	if !isTranscript(name) {
+		return "", false
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if base == stem {
+		return "", true
+	}
+	language, ok := strings.CutPrefix(base, stem+".")
+	if !ok || !transcriptLanguagePattern.MatchString(language) {
+		return "", false
+	}
+	return language, true
+}
+
+// transcriptNames lists the transcripts stored next to the audio file at
+// path in dir, the listing of its directory, in file name order.
+func transcriptNames(path string, dir *metadata.Directory) []string {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var names []string
+	for _, name := range dir.NamesWithPrefix(stem + ".") {
+		if _, ok := matchTranscript(stem, name); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// findTranscripts describes the transcripts of the audio file at path in
+// dir.
+func (l *Library) findTranscripts(path string, dir *metadata.Directory) []models.Transcript {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var transcripts []models.Transcript
+	for _, name := range transcriptNames(path, dir) {
+		language, _ := matchTranscript(stem, name)
+		transcripts = append(transcripts, models.Transcript{
+			Path:     l.relativePath(filepath.Join(dir.Path(), name)),
+			Type:     transcriptTypes[strings.ToLower(filepath.Ext(name))],
+			Language: language,
+		})
+	}
+	return transcripts
+}
+
+// transcriptOwners returns the audio files in the same directory that the
+// transcript at path belongs to.
+func (l *Library) transcriptOwners(path string) []string {
+	name := filepath.Base(path)
+	return l.audioInDir(filepath.Dir(path), func(audio string) bool {
+		_, ok := matchTranscript(strings.TrimSuffix(audio, filepath.Ext(audio)), name)
+		return ok
+	})
+}
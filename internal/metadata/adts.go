@@ -0,0 +1,78 @@
+package metadata
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	adtsHeaderSize      = 7
+	adtsSamplesPerBlock = 1024
+)
+
+var adtsSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseADTS walks the ADTS frame headers of a raw AAC stream. Every raw data
+// block holds 1024 samples, so the frame count gives an exact duration.
+// Counting stops at the first byte that is not a frame header, which covers
+// trailing ID3v1 or APE tags.
+func parseADTS(f *os.File, _ int64) (streamInfo, error) {
+	start := id3v2Size(f)
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return streamInfo{}, err
+	}
+	r := bufio.NewReaderSize(f, 64<<10)
+
+	var (
+		info    streamInfo
+		samples int64
+		audio   int64
+		header  [adtsHeaderSize]byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return streamInfo{}, err
+		}
+		if header[0] != 0xff || header[1]&0xf6 != 0xf0 {
+			break
+		}
+
+		rateIndex := int(header[2] >> 2 & 0x0f)
+		if rateIndex >= len(adtsSampleRates) {
+			break
+		}
+		length := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+		if length < adtsHeaderSize {
+			break
+		}
+
+		if samples == 0 {
+			info.sampleRate = adtsSampleRates[rateIndex]
+			channels := int(header[2]&0x01)<<2 | int(header[3]>>6)
+			if channels == 7 {
+				channels = 8
+			}
+			info.channels = channels
+		}
+		samples += int64(header[6]&0x03+1) * adtsSamplesPerBlock
+		audio += int64(length)
+
+		if _, err := r.Discard(length - adtsHeaderSize); err != nil {
+			break
+		}
+	}
+
+	if samples == 0 || info.sampleRate == 0 {
+		return streamInfo{}, errUnrecognised
+	}
+
+	info.codec = "aac"
+	info.duration = float64(samples) / float64(info.sampleRate)
+	info.bitrateKbps = int(float64(audio) * 8 / info.duration / 1000)
+	return info, nil
+}
@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+
+	"home-podcast/internal/models"
+)
+
+// maxArtworkBytes caps the size of artwork read from disk or tags so a
+// mislabelled file cannot exhaust memory.
+const maxArtworkBytes = 16 << 20
+
+// DirectoryArtworkNames lists the image files that act as cover art for
+// every episode in their directory, in order of precedence. Matching is
+// case-insensitive.
+var DirectoryArtworkNames = []string{"cover.jpg", "cover.jpeg", "cover.png", "folder.jpg", "folder.jpeg", "folder.png"}
+
+// IsDirectoryArtwork reports whether path names a directory cover image.
+func IsDirectoryArtwork(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	for _, name := range DirectoryArtworkNames {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDirectoryArtwork returns the cover image in dir, or an empty path when
+// there is none.
+func FindDirectoryArtwork(dir string) (string, os.FileInfo) {
+	return ReadDirectory(dir).Artwork()
+}
+
+// Artwork is FindDirectoryArtwork for d.
+func (d *Directory) Artwork() (string, os.FileInfo) {
+	for _, name := range DirectoryArtworkNames {
+		if cover, info := d.fileFold(name); cover != "" {
+			return cover, info
+		}
+	}
+	return "", nil
+}
+
+// ReadArtwork returns the cover art for the audio file at path. Sources are
+// tried in order: an artwork file named by the episode's sidecar, a picture
+// embedded in the tags (ID3 APIC, MP4 covr, FLAC PICTURE), then a directory
+// cover image. Artwork given as a URL is left to the caller. It returns nil
+// data when the episode has no artwork.
+func ReadArtwork(path, root string, episode models.Episode) ([]byte, error) {
+	return ReadArtworkIn(path, root, ReadDirectory(filepath.Dir(path)), episode)
+}
+
+// ReadArtworkIn is ReadArtwork for an audio file in dir.
+func ReadArtworkIn(path, root string, dir *Directory, episode models.Episode) ([]byte, error) {
+	if episode.Artwork != "" && !strings.Contains(episode.Artwork, "://") {
+		rel := filepath.FromSlash(episode.Artwork)
+		if filepath.IsLocal(rel) {
+			if data, err := readArtworkFile(filepath.Join(root, rel)); err == nil {
+				return data, nil
+			}
+		}
+	}
+
+	if data := readPicture(path); len(data) > 0 {
+		return data, nil
+	}
+
+	if cover, _ := dir.Artwork(); cover != "" {
+		return readArtworkFile(cover)
+	}
+	return nil, nil
+}
+
+func readArtworkFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxArtworkBytes {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+func readPicture(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	meta, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil
+	}
+	picture := meta.Picture()
+	if picture == nil || len(picture.Data) > maxArtworkBytes {
+		return nil
+	}
+	return picture.Data
+}
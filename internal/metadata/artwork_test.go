@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"home-podcast/internal/models"
+)
+
+// id3WithPicture builds an ID3v2.3 tag holding a single APIC frame.
+func id3WithPicture(picture []byte) []byte {
+	frame := concat([]byte{0}, []byte("image/png\x00"), []byte{3}, []byte{0}, picture)
+	body := concat([]byte("APIC"), binary.BigEndian.AppendUint32(nil, uint32(len(frame))), []byte{0, 0}, frame)
+	size := len(body)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return concat(header, body)
+}
+
+func TestReadArtworkPrecedence(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "show")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	embedded := []byte("embedded-picture")
+	audio := filepath.Join(dir, "ep.mp3")
+	if err := os.WriteFile(audio, append(id3WithPicture(embedded), make([]byte, 64)...), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	plain := filepath.Join(dir, "plain.mp3")
+	if err := os.WriteFile(plain, []byte("no tags"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Folder.JPG"), []byte("folder-cover"), 0o644); err != nil {
+		t.Fatalf("write cover: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "art.png"), []byte("sidecar-art"), 0o644); err != nil {
+		t.Fatalf("write art: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		episode models.Episode
+		want    []byte
+	}{
+		{"sidecar file wins", audio, models.Episode{Artwork: "art.png"}, []byte("sidecar-art")},
+		{"embedded picture", audio, models.Episode{}, embedded},
+		{"directory cover", plain, models.Episode{}, []byte("folder-cover")},
+		{"escaping sidecar path ignored", plain, models.Episode{Artwork: "../outside.png"}, []byte("folder-cover")},
+		{"url left to caller", plain, models.Episode{Artwork: "https://cdn.example/a.png"}, []byte("folder-cover")},
+	}
+	for _, tc := range cases {
+		got, err := ReadArtwork(tc.path, root, tc.episode)
+		if err != nil {
+			t.Fatalf("%s: ReadArtwork: %v", tc.name, err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Fatalf("%s: got %q want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if !IsDirectoryArtwork("/x/COVER.png") || IsDirectoryArtwork("/x/cover.gif") {
+		t.Fatalf("unexpected IsDirectoryArtwork result")
+	}
+}
@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errUnrecognised is returned by the stream parsers when the file does not
+// look like the format they handle.
+var errUnrecognised = errors.New("unrecognised audio stream")
+
+// streamInfo describes the audio stream of a file. Zero values mean the
+// parser could not determine the field.
+type streamInfo struct {
+	duration    float64
+	bitrateKbps int
+	sampleRate  int
+	channels    int
+	codec       string
+}
+
+// streamParsers maps lowercase extensions to the parser for that container.
+// MP3 is handled separately by parseMP3 because it depends on Options.
+var streamParsers = map[string]func(f *os.File, size int64) (streamInfo, error){
+	".m4a":  parseMP4,
+	".aac":  parseADTS,
+	".flac": parseFLAC,
+	".ogg":  parseOgg,
+	".wav":  parseWAV,
+}
+
+// probeStream reads the stream properties of the audio file at path using
+// the parser registered for its extension.
+func probeStream(path string, opts Options) (streamInfo, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	parse, ok := streamParsers[ext]
+	if ext == ".mp3" {
+		parse = func(f *os.File, size int64) (streamInfo, error) {
+			return parseMP3(f, size, opts)
+		}
+	} else if !ok {
+		return streamInfo{}, errUnrecognised
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return streamInfo{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return streamInfo{}, err
+	}
+	return parse(f, info.Size())
+}
+
+// id3v2Size returns the length of the ID3v2 tag at the start of r, or zero
+// when there is none. Some encoders prepend one to FLAC and ADTS streams.
+func id3v2Size(r io.ReaderAt) int64 {
+	var header [10]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return 0
+	}
+	if string(header[:3]) != "ID3" {
+		return 0
+	}
+	size := syncsafe(header[6:10]) + 10
+	if header[5]&0x10 != 0 {
+		// Footer present.
+		size += 10
+	}
+	return size
+}
+
+// readFull reads exactly len(buf) bytes at off, reporting short reads as
+// errUnrecognised so truncated files are treated like foreign ones.
+func readFull(r io.ReaderAt, buf []byte, off int64) error {
+	if _, err := r.ReadAt(buf, off); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errUnrecognised
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFixture(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func assertStream(t *testing.T, path string, want streamInfo) {
+	t.Helper()
+	got, err := probeStream(path, Options{})
+	if err != nil {
+		t.Fatalf("probeStream(%s): %v", filepath.Base(path), err)
+	}
+	if math.Abs(got.duration-want.duration) > 0.001 {
+		t.Fatalf("duration: got %f want %f", got.duration, want.duration)
+	}
+	if got.sampleRate != want.sampleRate || got.channels != want.channels || got.codec != want.codec {
+		t.Fatalf("stream: got %+v want %+v", got, want)
+	}
+	if want.bitrateKbps != 0 && got.bitrateKbps != want.bitrateKbps {
+		t.Fatalf("bitrate: got %d want %d", got.bitrateKbps, want.bitrateKbps)
+	}
+}
+
+func le16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func be16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func wavFixture() []byte {
+	fmtChunk := concat(le16(wavFormatPCM), le16(2), le32(8000), le32(32000), le16(4), le16(16))
+	data := make([]byte, 64000)
+	return concat(
+		[]byte("RIFF"), le32(uint32(4+8+len(fmtChunk)+8+len(data))), []byte("WAVE"),
+		[]byte("LIST"), le32(3), []byte("abc"), []byte{0},
+		[]byte("fmt "), le32(uint32(len(fmtChunk))), fmtChunk,
+		[]byte("data"), le32(uint32(len(data))), data,
+	)
+}
+
+func TestParseWAV(t *testing.T) {
+	path := writeFixture(t, "clip.wav", wavFixture())
+	assertStream(t, path, streamInfo{duration: 2, bitrateKbps: 256, sampleRate: 8000, channels: 2, codec: "pcm"})
+}
+
+func TestParseFLAC(t *testing.T) {
+	const sampleRate, channels, bits, total = 44100, 2, 16, 441000
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bits-1)<<36 | total
+	streamInfoBlock := concat(make([]byte, 10), binary.BigEndian.AppendUint64(nil, packed), make([]byte, 16))
+
+	id3 := concat([]byte("ID3"), []byte{4, 0, 0}, []byte{0, 0, 0, 5}, make([]byte, 5))
+	flac := concat(
+		id3,
+		[]byte("fLaC"),
+		[]byte{0x04, 0, 0, 4}, []byte("\x00\x00\x00\x00"), // vorbis comment block
+		[]byte{0x80 | flacBlockStreamInfo, 0, 0, flacStreamInfoSize}, streamInfoBlock,
+		make([]byte, 1000),
+	)
+	path := writeFixture(t, "clip.flac", flac)
+	assertStream(t, path, streamInfo{duration: 10, sampleRate: sampleRate, channels: channels, codec: "flac"})
+}
+
+func oggPageBytes(granule int64, serial uint32, packet []byte) []byte {
+	var segments []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	return concat(
+		[]byte("OggS"), []byte{0, 0},
+		binary.LittleEndian.AppendUint64(nil, uint64(granule)),
+		le32(serial), le32(0), le32(0),
+		[]byte{byte(len(segments))}, segments, packet,
+	)
+}
+
+func TestParseOggVorbis(t *testing.T) {
+	id := concat([]byte{0x01}, []byte("vorbis"), le32(0), []byte{2}, le32(44100), le32(0), le32(128000), le32(0), []byte{0xb8, 0x01})
+	data := concat(
+		oggPageBytes(0, 7, id),
+		oggPageBytes(-1, 7, make([]byte, 300)),
+		oggPageBytes(220500, 7, make([]byte, 100)),
+		oggPageBytes(441000, 7, make([]byte, 100)),
+		oggPageBytes(999999, 8, make([]byte, 10)), // another logical stream
+	)
+	path := writeFixture(t, "clip.ogg", data)
+	assertStream(t, path, streamInfo{duration: 10, sampleRate: 44100, channels: 2, codec: "vorbis"})
+}
+
+func TestParseOggOpus(t *testing.T) {
+	head := concat([]byte("OpusHead"), []byte{1, 1}, le16(312), le32(44100), le16(0), []byte{0})
+	data := concat(
+		oggPageBytes(0, 1, head),
+		oggPageBytes(0, 1, []byte("OpusTags")),
+		oggPageBytes(3*opusRate+312, 1, make([]byte, 80)),
+	)
+	path := writeFixture(t, "clip.ogg", data)
+	assertStream(t, path, streamInfo{duration: 3, sampleRate: opusRate, channels: 1, codec: "opus"})
+}
+
+func mp4BoxBytes(kind string, payload ...[]byte) []byte {
+	body := concat(payload...)
+	return concat(be32(uint32(8+len(body))), []byte(kind), body)
+}
+
+func TestParseMP4(t *testing.T) {
+	mvhd := mp4BoxBytes("mvhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(1000), be32(5000), make([]byte, 80))
+	mdhd := mp4BoxBytes("mdhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(44100), be32(4*44100), be32(0))
+	hdlr := mp4BoxBytes("hdlr", []byte{0, 0, 0, 0}, be32(0), []byte("soun"), make([]byte, 12), []byte{0})
+	entry := mp4BoxBytes("mp4a", make([]byte, 6), be16(1), be16(0), be16(0), be32(0), be16(2), be16(16), be16(0), be16(0), be32(44100<<16))
+	stsd := mp4BoxBytes("stsd", []byte{0, 0, 0, 0}, be32(1), entry)
+	trak := mp4BoxBytes("trak", mp4BoxBytes("mdia", mdhd, hdlr, mp4BoxBytes("minf", mp4BoxBytes("stbl", stsd))))
+	data := concat(
+		mp4BoxBytes("ftyp", []byte("M4A "), be32(0)),
+		mp4BoxBytes("moov", mvhd, trak),
+		mp4BoxBytes("mdat", make([]byte, 2000)),
+	)
+	path := writeFixture(t, "clip.m4a", data)
+	assertStream(t, path, streamInfo{duration: 4, sampleRate: 44100, channels: 2, codec: "aac"})
+}
+
+func TestParseADTS(t *testing.T) {
+	const frameLen = 100
+	frame := []byte{
+		0xff, 0xf1,
+		1<<6 | 3<<2 | 2>>2, // AAC LC, 48 kHz, channel config 2
+		(2&3)<<6 | frameLen>>11,
+		frameLen >> 3 & 0xff,
+		(frameLen&7)<<5 | 0x1f,
+		0xfc,
+	}
+	frame = append(frame, make([]byte, frameLen-len(frame))...)
+
+	var data []byte
+	for range 375 {
+		data = append(data, frame...)
+	}
+	data = append(data, []byte("TAG")...)
+	data = append(data, make([]byte, 125)...)
+
+	path := writeFixture(t, "clip.aac", data)
+	assertStream(t, path, streamInfo{duration: 8, bitrateKbps: 37, sampleRate: 48000, channels: 2, codec: "aac"})
+}
+
+func TestParsersRejectForeignData(t *testing.T) {
+	for _, name := range []string{"x.wav", "x.flac", "x.ogg", "x.m4a", "x.aac"} {
+		path := writeFixture(t, name, []byte("definitely not audio"))
+		if _, err := probeStream(path, Options{}); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestBuildEpisodeReportsStreamDetails(t *testing.T) {
+	path := writeFixture(t, "clip.wav", wavFixture())
+	episode, err := BuildEpisode(path, filepath.Dir(path), Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	if episode.DurationSeconds == nil || *episode.DurationSeconds != 2 {
+		t.Fatalf("unexpected duration %v", episode.DurationSeconds)
+	}
+	if episode.BitrateKbps == nil || *episode.BitrateKbps != 256 {
+		t.Fatalf("unexpected bitrate %v", episode.BitrateKbps)
+	}
+	if episode.SampleRateHz == nil || *episode.SampleRateHz != 8000 || episode.Channels == nil || *episode.Channels != 2 {
+		t.Fatalf("unexpected sample rate/channels %v/%v", episode.SampleRateHz, episode.Channels)
+	}
+	if episode.Codec != "pcm" {
+		t.Fatalf("unexpected codec %q", episode.Codec)
+	}
+}
@@ -0,0 +1,156 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"home-podcast/internal/models"
+)
+
+// ChaptersSuffix names the chapters file stored next to an audio file:
+// "episode.mp3" is paired with "episode.chapters.json". Its contents use the
+// Podcasting 2.0 JSON chapters format and replace any embedded chapters.
+const ChaptersSuffix = ".chapters.json"
+
+// DirectoryChaptersName names a chapters file that applies to every audio
+// file in its directory without a chapters file of its own, which suits
+// directories holding a single long recording. Matching is case-insensitive.
+const DirectoryChaptersName = "chapters.json"
+
+// maxChapters caps the number of chapters kept for one episode.
+const maxChapters = 4096
+
+// IsChaptersFile reports whether path names a chapters file, either for one
+// audio file or for its whole directory.
+func IsChaptersFile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	return base == DirectoryChaptersName || (strings.HasSuffix(base, ChaptersSuffix) && len(base) > len(ChaptersSuffix))
+}
+
+// IsDirectoryChaptersFile reports whether path names a directory-wide
+// chapters file.
+func IsDirectoryChaptersFile(path string) bool {
+	return strings.EqualFold(filepath.Base(path), DirectoryChaptersName)
+}
+
+// ChaptersStem returns the audio file stem a per-episode chapters file
+// belongs to, relative to the directory of path.
+func ChaptersStem(path string) string {
+	base := filepath.Base(path)
+	return base[:len(base)-len(ChaptersSuffix)]
+}
+
+// FindChaptersFile returns the chapters file belonging to the audio file at
+// path, or an empty path when there is none. A file named after the episode
+// wins over the directory's chapters.json, which is ignored for audio files
+// whose own metadata sidecar it would be, such as "chapters.mp3".
+func FindChaptersFile(path string) (string, os.FileInfo) {
+	return ReadDirectory(filepath.Dir(path)).ChaptersFile(path)
+}
+
+// ChaptersFile is FindChaptersFile for an audio file in d.
+func (d *Directory) ChaptersFile(path string) (string, os.FileInfo) {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if candidate, info := d.file(stem + ChaptersSuffix); candidate != "" {
+		return candidate, info
+	}
+
+	if strings.EqualFold(stem, strings.TrimSuffix(DirectoryChaptersName, ".json")) {
+		return "", nil
+	}
+	return d.fileFold(DirectoryChaptersName)
+}
+
+// chaptersDocument is the Podcasting 2.0 JSON chapters format.
+type chaptersDocument struct {
+	Version  string `json:"version"`
+	Chapters []struct {
+		StartTime *float64 `json:"startTime"`
+		EndTime   *float64 `json:"endTime"`
+		Title     string   `json:"title"`
+		URL       string   `json:"url"`
+		Img       string   `json:"img"`
+	} `json:"chapters"`
+}
+
+// ReadChaptersFile parses a Podcasting 2.0 JSON chapters file. Unknown
+// fields are ignored since the format allows extensions.
+func ReadChaptersFile(path string) ([]models.Chapter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc chaptersDocument
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Chapters) > maxChapters {
+		return nil, fmt.Errorf("more than %d chapters", maxChapters)
+	}
+
+	chapters := make([]models.Chapter, 0, len(doc.Chapters))
+	for i, entry := range doc.Chapters {
+		if entry.StartTime == nil || *entry.StartTime < 0 {
+			return nil, fmt.Errorf("chapter %d: missing or negative startTime", i+1)
+		}
+		chapters = append(chapters, models.Chapter{
+			StartSeconds: *entry.StartTime,
+			EndSeconds:   entry.EndTime,
+			Title:        strings.TrimSpace(entry.Title),
+			URL:          strings.TrimSpace(entry.URL),
+			Image:        strings.TrimSpace(entry.Img),
+		})
+	}
+	sortChapters(chapters)
+	return chapters, nil
+}
+
+// readChapters returns the chapters embedded in the audio file at path:
+// ID3v2 CHAP frames for files carrying an ID3v2 tag, otherwise a QuickTime
+// chapter track or Nero chpl box for MP4 files.
+func readChapters(path string) ([]models.Chapter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if id3v2Size(f) > 0 {
+		return readID3Chapters(f)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".m4a") {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		chapters, err := readMP4Chapters(f, info.Size())
+		if errors.Is(err, errUnrecognised) {
+			return nil, nil
+		}
+		return chapters, err
+	}
+	return nil, nil
+}
+
+func sortChapters(chapters []models.Chapter) {
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].StartSeconds < chapters[j].StartSeconds
+	})
+}
+
+// fillChapterEnds sets missing end times to the start of the next chapter.
+func fillChapterEnds(chapters []models.Chapter) {
+	for i := 0; i+1 < len(chapters); i++ {
+		if chapters[i].EndSeconds == nil {
+			end := chapters[i+1].StartSeconds
+			chapters[i].EndSeconds = &end
+		}
+	}
+}
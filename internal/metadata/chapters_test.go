@@ -0,0 +1,220 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"home-podcast/internal/models"
+)
+
+func id3v23Frame(id string, body ...[]byte) []byte {
+	payload := concat(body...)
+	return concat([]byte(id), be32(uint32(len(payload))), []byte{0, 0}, payload)
+}
+
+func id3v23Tag(frames ...[]byte) []byte {
+	body := concat(frames...)
+	size := len(body)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return concat(header, body)
+}
+
+func id3Chapter(id string, startMs, endMs uint32, title string) []byte {
+	return id3v23Frame("CHAP", []byte(id+"\x00"), be32(startMs), be32(endMs), be32(0xffffffff), be32(0xffffffff),
+		id3v23Frame("TIT2", []byte{3}, []byte(title)))
+}
+
+func assertChapters(t *testing.T, got []models.Chapter, want ...models.Chapter) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d chapters, got %+v", len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.StartSeconds != w.StartSeconds || g.Title != w.Title || g.URL != w.URL {
+			t.Fatalf("chapter %d: got %+v want %+v", i, g, w)
+		}
+		if (g.EndSeconds == nil) != (w.EndSeconds == nil) || (g.EndSeconds != nil && *g.EndSeconds != *w.EndSeconds) {
+			t.Fatalf("chapter %d end: got %v want %v", i, g.EndSeconds, w.EndSeconds)
+		}
+	}
+}
+
+func seconds(v float64) *float64 { return &v }
+
+func TestReadID3Chapters(t *testing.T) {
+	url := id3v23Frame("WXXX", []byte{0}, []byte("link\x00"), []byte("https://example.com/a"))
+	tag := id3v23Tag(
+		id3v23Frame("TIT2", []byte{0}, []byte("Episode")),
+		id3Chapter("ch0", 0, 30000, "Intro"),
+		id3v23Frame("CHAP", []byte("ch1\x00"), be32(30000), be32(90000), be32(0xffffffff), be32(0xffffffff),
+			id3v23Frame("TIT2", []byte{1, 0xff, 0xfe, 'M', 0, 'a', 0, 'i', 0, 'n', 0}), url),
+		id3Chapter("hidden", 5000, 6000, "Not in the table of contents"),
+		id3v23Frame("CTOC", []byte("toc\x00"), []byte{0x03, 2}, []byte("ch0\x00ch1\x00")),
+	)
+	path := writeFixture(t, "talk.mp3", concat(tag, repeatFrames(mp3FrameBytes(9, nil), 4)))
+
+	chapters, err := readChapters(path)
+	if err != nil {
+		t.Fatalf("readChapters: %v", err)
+	}
+	assertChapters(t, chapters,
+		models.Chapter{StartSeconds: 0, EndSeconds: seconds(30), Title: "Intro"},
+		models.Chapter{StartSeconds: 30, EndSeconds: seconds(90), Title: "Main", URL: "https://example.com/a"},
+	)
+
+	// Without a table of contents every chapter is listed by start time.
+	tag = id3v23Tag(id3Chapter("b", 60000, 0, "Second"), id3Chapter("a", 0, 60000, "First"))
+	path = writeFixture(t, "untitled.mp3", tag)
+	chapters, err = readChapters(path)
+	if err != nil {
+		t.Fatalf("readChapters: %v", err)
+	}
+	assertChapters(t, chapters,
+		models.Chapter{StartSeconds: 0, EndSeconds: seconds(60), Title: "First"},
+		models.Chapter{StartSeconds: 60, Title: "Second"},
+	)
+}
+
+func mp4ChapterFixture(withTrack bool) []byte {
+	ftyp := mp4BoxBytes("ftyp", []byte("M4A "), be32(0))
+	samples := concat(be16(5), []byte("Intro"), be16(4), []byte("Main"))
+	mdat := mp4BoxBytes("mdat", samples)
+	sampleOffset := uint32(len(ftyp) + 8)
+
+	tkhd := func(id uint32) []byte {
+		return mp4BoxBytes("tkhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(id), make([]byte, 68))
+	}
+	hdlr := func(kind string) []byte {
+		return mp4BoxBytes("hdlr", []byte{0, 0, 0, 0}, be32(0), []byte(kind), make([]byte, 12), []byte{0})
+	}
+	mdhd := mp4BoxBytes("mdhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(1000), be32(120000), be32(0))
+
+	sound := mp4BoxBytes("trak", tkhd(1), mp4BoxBytes("tref", mp4BoxBytes("chap", be32(2))), mp4BoxBytes("mdia", mdhd, hdlr("soun")))
+	text := mp4BoxBytes("trak", tkhd(2), mp4BoxBytes("mdia", mdhd, hdlr("text"), mp4BoxBytes("minf", mp4BoxBytes("stbl",
+		mp4BoxBytes("stts", []byte{0, 0, 0, 0}, be32(2), be32(1), be32(30000), be32(1), be32(90000)),
+		mp4BoxBytes("stsc", []byte{0, 0, 0, 0}, be32(1), be32(1), be32(2), be32(1)),
+		mp4BoxBytes("stsz", []byte{0, 0, 0, 0}, be32(0), be32(2), be32(7), be32(6)),
+		mp4BoxBytes("stco", []byte{0, 0, 0, 0}, be32(1), be32(sampleOffset)),
+	))))
+	chpl := mp4BoxBytes("chpl", []byte{1, 0, 0, 0}, be32(0), []byte{2},
+		be32(0), be32(0), []byte{7}, []byte("Opening"),
+		be32(0), be32(450000000), []byte{5}, []byte("Later"))
+	udta := mp4BoxBytes("udta", chpl)
+
+	moov := []byte{}
+	if withTrack {
+		moov = concat(sound, text)
+	}
+	return concat(ftyp, mdat, mp4BoxBytes("moov", moov, udta))
+}
+
+func TestReadMP4Chapters(t *testing.T) {
+	path := writeFixture(t, "track.m4a", mp4ChapterFixture(true))
+	chapters, err := readChapters(path)
+	if err != nil {
+		t.Fatalf("readChapters: %v", err)
+	}
+	assertChapters(t, chapters,
+		models.Chapter{StartSeconds: 0, EndSeconds: seconds(30), Title: "Intro"},
+		models.Chapter{StartSeconds: 30, EndSeconds: seconds(120), Title: "Main"},
+	)
+
+	path = writeFixture(t, "nero.m4a", mp4ChapterFixture(false))
+	chapters, err = readChapters(path)
+	if err != nil {
+		t.Fatalf("readChapters: %v", err)
+	}
+	assertChapters(t, chapters,
+		models.Chapter{StartSeconds: 0, EndSeconds: seconds(45), Title: "Opening"},
+		models.Chapter{StartSeconds: 45, Title: "Later"},
+	)
+}
+
+func TestBuildEpisodeChaptersFileOverridesEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "talk.mp3")
+	if err := os.WriteFile(path, id3v23Tag(id3Chapter("ch0", 0, 1000, "Embedded")), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	episode, err := BuildEpisode(path, dir, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	assertChapters(t, episode.Chapters, models.Chapter{StartSeconds: 0, EndSeconds: seconds(1), Title: "Embedded"})
+
+	chaptersPath := filepath.Join(dir, "talk.chapters.json")
+	doc := `{"version":"1.2.0","chapters":[{"startTime":12.5,"title":"Later","url":"https://example.com"},{"startTime":0,"title":"Start","img":"https://example.com/a.png"}]}`
+	if err := os.WriteFile(chaptersPath, []byte(doc), 0o644); err != nil {
+		t.Fatalf("write chapters: %v", err)
+	}
+	episode, err = BuildEpisode(path, dir, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	assertChapters(t, episode.Chapters,
+		models.Chapter{StartSeconds: 0, Title: "Start"},
+		models.Chapter{StartSeconds: 12.5, Title: "Later", URL: "https://example.com"},
+	)
+	if episode.Chapters[0].Image != "https://example.com/a.png" {
+		t.Fatalf("expected chapter image, got %+v", episode.Chapters[0])
+	}
+
+	if err := os.WriteFile(chaptersPath, []byte(`{"chapters":[{"title":"no start"}]}`), 0o644); err != nil {
+		t.Fatalf("write chapters: %v", err)
+	}
+	episode, err = BuildEpisode(path, dir, Options{})
+	var sidecarErr *SidecarError
+	if !errors.As(err, &sidecarErr) || sidecarErr.Path != chaptersPath {
+		t.Fatalf("expected chapters file error, got %v", err)
+	}
+	assertChapters(t, episode.Chapters, models.Chapter{StartSeconds: 0, EndSeconds: seconds(1), Title: "Embedded"})
+}
+
+func TestIsChaptersFile(t *testing.T) {
+	if !IsChaptersFile("/x/Talk.Chapters.JSON") || ChaptersStem("/x/talk.chapters.json") != "talk" {
+		t.Fatalf("expected chapters file to be recognised")
+	}
+	if !IsChaptersFile("/x/Chapters.json") || !IsDirectoryChaptersFile("/x/Chapters.json") || IsDirectoryChaptersFile("/x/talk.chapters.json") {
+		t.Fatalf("expected directory chapters file to be recognised")
+	}
+	if IsChaptersFile("/x/talk.json") || IsChaptersFile("/x/.chapters.json") {
+		t.Fatalf("unexpected chapters file match")
+	}
+}
+
+func TestFindChaptersFilePrefersEpisodeFile(t *testing.T) {
+	dir := t.TempDir()
+	talk := filepath.Join(dir, "talk.mp3")
+	other := filepath.Join(dir, "other.mp3")
+	shared := filepath.Join(dir, "chapters.json")
+	own := filepath.Join(dir, "talk.chapters.json")
+
+	if path, _ := FindChaptersFile(talk); path != "" {
+		t.Fatalf("expected no chapters file, got %q", path)
+	}
+	if err := os.WriteFile(shared, []byte(`{"chapters":[]}`), 0o644); err != nil {
+		t.Fatalf("write chapters: %v", err)
+	}
+	for _, path := range []string{talk, other} {
+		if found, _ := FindChaptersFile(path); found != shared {
+			t.Fatalf("expected directory chapters file for %s, got %q", path, found)
+		}
+	}
+	if found, _ := FindChaptersFile(filepath.Join(dir, "chapters.mp3")); found != "" {
+		t.Fatalf("expected chapters.json not to apply to its own audio file, got %q", found)
+	}
+
+	if err := os.WriteFile(own, []byte(`{"chapters":[]}`), 0o644); err != nil {
+		t.Fatalf("write chapters: %v", err)
+	}
+	if found, _ := FindChaptersFile(talk); found != own {
+		t.Fatalf("expected episode chapters file to win, got %q", found)
+	}
+	if found, _ := FindChaptersFile(other); found != shared {
+		t.Fatalf("expected other episodes to keep the directory file, got %q", found)
+	}
+}
@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory is a listing of the regular files in one directory with their
+// sizes and modification times. Looking companion files up in a Directory
+// instead of the file system lets a scan read each directory once rather
+// than once per audio file. A Directory is not updated after it is read and
+// is safe for concurrent use.
+type Directory struct {
+	path  string
+	names []string
+	files map[string]os.FileInfo
+	// folded maps lower-case names to the first file spelled that way.
+	folded map[string]string
+}
+
+// ReadDirectory lists the regular files in dir, following symbolic links.
+// An unreadable directory reads as an empty one.
+func ReadDirectory(dir string) *Directory {
+	d := &Directory{path: dir, files: make(map[string]os.FileInfo), folded: make(map[string]string)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return d
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		d.names = append(d.names, entry.Name())
+		d.files[entry.Name()] = info
+		if _, ok := d.folded[strings.ToLower(entry.Name())]; !ok {
+			d.folded[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	return d
+}
+
+// Path returns the directory that was listed.
+func (d *Directory) Path() string {
+	return d.path
+}
+
+// NamesWithPrefix returns the regular files whose name starts with prefix,
+// in name order, without going through the whole listing.
+func (d *Directory) NamesWithPrefix(prefix string) []string {
+	start := sort.SearchStrings(d.names, prefix)
+	end := start
+	for end < len(d.names) && strings.HasPrefix(d.names[end], prefix) {
+		end++
+	}
+	return d.names[start:end]
+}
+
+// file returns the file called name, matched exactly.
+func (d *Directory) file(name string) (string, os.FileInfo) {
+	info, ok := d.files[name]
+	if !ok {
+		return "", nil
+	}
+	return filepath.Join(d.path, name), info
+}
+
+// fileFold returns the first file whose name matches name case-insensitively.
+func (d *Directory) fileFold(name string) (string, os.FileInfo) {
+	if candidate, ok := d.folded[strings.ToLower(name)]; ok {
+		return d.file(candidate)
+	}
+	return "", nil
+}
@@ -0,0 +1,78 @@
+package metadata
+
+import "os"
+
+const (
+	flacBlockStreamInfo = 0
+	flacStreamInfoSize  = 34
+)
+
+// parseFLAC reads the STREAMINFO metadata block, which records the sample
+// rate, channel count and total number of samples of the stream.
+func parseFLAC(f *os.File, size int64) (streamInfo, error) {
+	off := id3v2Size(f)
+
+	var marker [4]byte
+	if err := readFull(f, marker[:], off); err != nil {
+		return streamInfo{}, err
+	}
+	if string(marker[:]) != "fLaC" {
+		return streamInfo{}, errUnrecognised
+	}
+	off += 4
+
+	var (
+		block      [flacStreamInfoSize]byte
+		haveStream bool
+	)
+	for {
+		var header [4]byte
+		if err := readFull(f, header[:], off); err != nil {
+			return streamInfo{}, err
+		}
+		last := header[0]&0x80 != 0
+		kind := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		off += 4
+
+		if kind == flacBlockStreamInfo {
+			if length < flacStreamInfoSize {
+				return streamInfo{}, errUnrecognised
+			}
+			if err := readFull(f, block[:], off); err != nil {
+				return streamInfo{}, err
+			}
+			haveStream = true
+		}
+
+		off += length
+		if last || off >= size {
+			break
+		}
+	}
+	if !haveStream {
+		return streamInfo{}, errUnrecognised
+	}
+
+	// Bytes 10-17 pack: sample rate (20 bits), channels-1 (3 bits),
+	// bits per sample-1 (5 bits) and total samples (36 bits).
+	sampleRate := int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4
+	channels := int(block[12]>>1&0x07) + 1
+	totalSamples := int64(block[13]&0x0f)<<32 | int64(block[14])<<24 | int64(block[15])<<16 | int64(block[16])<<8 | int64(block[17])
+	if sampleRate == 0 {
+		return streamInfo{}, errUnrecognised
+	}
+
+	info := streamInfo{
+		sampleRate: sampleRate,
+		channels:   channels,
+		codec:      "flac",
+	}
+	if totalSamples > 0 {
+		info.duration = float64(totalSamples) / float64(sampleRate)
+		if audio := size - off; audio > 0 {
+			info.bitrateKbps = int(float64(audio) * 8 / info.duration / 1000)
+		}
+	}
+	return info, nil
+}
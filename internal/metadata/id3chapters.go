@@ -0,0 +1,304 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"home-podcast/internal/models"
+)
+
+// maxID3TagBytes caps how much of an ID3v2 tag is read when looking for
+// chapters; larger tags are almost always dominated by embedded pictures.
+const maxID3TagBytes = 64 << 20
+
+// id3Frame is one frame of an ID3v2.3 or ID3v2.4 tag.
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// readID3Chapters decodes the CHAP and CTOC frames (ID3v2 Chapter Frame
+// Addendum) of the ID3v2 tag at the start of f. Chapters are ordered by the
+// top-level table of contents when one exists, otherwise by start time.
+func readID3Chapters(f *os.File) ([]models.Chapter, error) {
+	var header [10]byte
+	if err := readFull(f, header[:], 0); err != nil {
+		return nil, err
+	}
+	version := int(header[3])
+	if version != 3 && version != 4 {
+		return nil, nil
+	}
+	size := syncsafe(header[6:10])
+	if size > maxID3TagBytes {
+		return nil, nil
+	}
+	tag := make([]byte, size)
+	if err := readFull(f, tag, 10); err != nil {
+		return nil, err
+	}
+
+	flags := header[5]
+	if version == 3 && flags&0x80 != 0 {
+		tag = unsynchronise(tag)
+	}
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		// Extended header: v2.3 stores its size without the size field,
+		// v2.4 as a syncsafe integer that includes it.
+		skip := int(binary.BigEndian.Uint32(tag[0:4])) + 4
+		if version == 4 {
+			skip = int(syncsafe(tag[0:4]))
+		}
+		if skip > len(tag) {
+			return nil, nil
+		}
+		tag = tag[skip:]
+	}
+
+	chaps := make(map[string]models.Chapter)
+	var order []string
+	tocs := make(map[string]id3TOC)
+	var topLevel string
+
+	for _, frame := range parseID3Frames(tag, version) {
+		switch frame.id {
+		case "CHAP":
+			id, chapter, ok := parseID3Chapter(frame.body, version)
+			if ok {
+				if _, dup := chaps[id]; !dup {
+					order = append(order, id)
+				}
+				chaps[id] = chapter
+			}
+		case "CTOC":
+			id, toc, ok := parseID3TOC(frame.body)
+			if ok {
+				tocs[id] = toc
+				if toc.topLevel && topLevel == "" {
+					topLevel = id
+				}
+			}
+		}
+		if len(chaps) > maxChapters {
+			break
+		}
+	}
+	if len(chaps) == 0 {
+		return nil, nil
+	}
+
+	var chapters []models.Chapter
+	if toc, ok := tocs[topLevel]; ok && toc.ordered {
+		seen := make(map[string]bool)
+		var walk func(children []string)
+		walk = func(children []string) {
+			for _, child := range children {
+				if seen[child] {
+					continue
+				}
+				seen[child] = true
+				if chapter, ok := chaps[child]; ok {
+					chapters = append(chapters, chapter)
+				} else if nested, ok := tocs[child]; ok {
+					walk(nested.children)
+				}
+			}
+		}
+		walk(toc.children)
+	}
+	if len(chapters) == 0 {
+		for _, id := range order {
+			chapters = append(chapters, chaps[id])
+		}
+		sortChapters(chapters)
+	}
+	return chapters, nil
+}
+
+// parseID3Frames splits data into frames, stopping at padding or the first
+// malformed header.
+func parseID3Frames(data []byte, version int) []id3Frame {
+	var frames []id3Frame
+	for len(data) >= 10 && data[0] != 0 {
+		id := string(data[0:4])
+		var size int64
+		if version == 4 {
+			size = syncsafe(data[4:8])
+		} else {
+			size = int64(binary.BigEndian.Uint32(data[4:8]))
+		}
+		formatFlags := data[9]
+		if size > int64(len(data)-10) {
+			break
+		}
+		body := data[10 : 10+size]
+		if version == 4 && formatFlags&0x02 != 0 {
+			body = unsynchronise(body)
+		}
+		if version == 4 && formatFlags&0x01 != 0 && len(body) >= 4 {
+			// Data length indicator.
+			body = body[4:]
+		}
+		// Compressed or encrypted frames are skipped.
+		compressed := (version == 3 && formatFlags&0xc0 != 0) || (version == 4 && formatFlags&0x0c != 0)
+		if !compressed {
+			frames = append(frames, id3Frame{id: id, body: body})
+		}
+		data = data[10+size:]
+	}
+	return frames
+}
+
+// parseID3Chapter decodes a CHAP frame: element ID, start and end times in
+// milliseconds, byte offsets (unused) and optional sub-frames.
+func parseID3Chapter(body []byte, version int) (string, models.Chapter, bool) {
+	id, rest, ok := cutNull(body)
+	if !ok || len(rest) < 16 {
+		return "", models.Chapter{}, false
+	}
+	start := binary.BigEndian.Uint32(rest[0:4])
+	end := binary.BigEndian.Uint32(rest[4:8])
+
+	chapter := models.Chapter{StartSeconds: float64(start) / 1000}
+	if end > start && end != 0xffffffff {
+		endSeconds := float64(end) / 1000
+		chapter.EndSeconds = &endSeconds
+	}
+	for _, sub := range parseID3Frames(rest[16:], version) {
+		switch sub.id {
+		case "TIT2":
+			chapter.Title = decodeID3Text(sub.body)
+		case "WXXX":
+			chapter.URL = decodeID3UserURL(sub.body)
+		}
+	}
+	return id, chapter, true
+}
+
+type id3TOC struct {
+	topLevel bool
+	ordered  bool
+	children []string
+}
+
+// parseID3TOC decodes a CTOC frame: element ID, flags, entry count and the
+// child element IDs.
+func parseID3TOC(body []byte) (string, id3TOC, bool) {
+	id, rest, ok := cutNull(body)
+	if !ok || len(rest) < 2 {
+		return "", id3TOC{}, false
+	}
+	toc := id3TOC{topLevel: rest[0]&0x02 != 0, ordered: rest[0]&0x01 != 0}
+	count := int(rest[1])
+	rest = rest[2:]
+	for range count {
+		child, remaining, ok := cutNull(rest)
+		if !ok {
+			break
+		}
+		toc.children = append(toc.children, child)
+		rest = remaining
+	}
+	return id, toc, true
+}
+
+// decodeID3Text decodes a text frame body: an encoding byte followed by the
+// text.
+func decodeID3Text(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	text := decodeID3String(body[0], body[1:])
+	if i := strings.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+// decodeID3UserURL returns the URL of a WXXX frame, skipping its
+// description.
+func decodeID3UserURL(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	encoding, rest := body[0], body[1:]
+	terminator := []byte{0}
+	if encoding == 1 || encoding == 2 {
+		terminator = []byte{0, 0}
+	}
+	for i := 0; i+len(terminator) <= len(rest); i += len(terminator) {
+		if bytes.Equal(rest[i:i+len(terminator)], terminator) {
+			url := rest[i+len(terminator):]
+			if j := bytes.IndexByte(url, 0); j >= 0 {
+				url = url[:j]
+			}
+			return strings.TrimSpace(decodeLatin1(url))
+		}
+	}
+	return ""
+}
+
+func decodeID3String(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(data) >= 2 {
+			switch {
+			case data[0] == 0xff && data[1] == 0xfe:
+				bigEndian, data = false, data[2:]
+			case data[0] == 0xfe && data[1] == 0xff:
+				bigEndian, data = true, data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[i:]))
+			}
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(data)
+	default:
+		return decodeLatin1(data)
+	}
+}
+
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// cutNull splits data at the first NUL byte.
+func cutNull(data []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(data[:i]), data[i+1:], true
+}
+
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+// unsynchronise reverses the ID3v2 unsynchronisation scheme, which inserts a
+// zero byte after every 0xff.
+func unsynchronise(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
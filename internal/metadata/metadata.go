@@ -3,6 +3,7 @@ package metadata
 import (
 	"errors"
 	"io"
+	"log"
 	"math"
 	"os"
 	"path/filepath"
@@ -15,8 +16,35 @@ import (
 	"home-podcast/internal/models"
 )
 
+// Options tunes metadata extraction.
+type Options struct {
+	// AccurateMP3 decodes every MP3 frame to measure duration instead of
+	// trusting Xing/Info/VBRI headers or constant-bitrate arithmetic.
+	AccurateMP3 bool
+
+	// Debug receives diagnostic messages, such as which method measured an
+	// MP3 duration. Nil disables them.
+	Debug *log.Logger
+}
+
+func (o Options) debugf(format string, args ...any) {
+	if o.Debug != nil {
+		o.Debug.Printf(format, args...)
+	}
+}
+
 // BuildEpisode constructs a metadata snapshot for the given audio file path.
-func BuildEpisode(path string, root string) (models.Episode, error) {
+// Fields from a sidecar file next to the audio (see FindSidecar) override
+// the embedded tags, and a chapters file (see FindChaptersFile) replaces the
+// embedded chapters. A companion file that cannot be used yields a
+// *SidecarError together with the episode built without it.
+func BuildEpisode(path string, root string, opts Options) (models.Episode, error) {
+	return BuildEpisodeIn(path, root, ReadDirectory(filepath.Dir(path)), opts)
+}
+
+// BuildEpisodeIn is BuildEpisode for an audio file in dir, whose listing is
+// used to find the companion files.
+func BuildEpisodeIn(path string, root string, dir *Directory, opts Options) (models.Episode, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return models.Episode{}, err
@@ -28,57 +56,121 @@ func BuildEpisode(path string, root string) (models.Episode, error) {
 	}
 	relative = filepath.ToSlash(relative)
 
-	title, artist, album := readTags(path)
+	tags := readTags(path)
+	title := tags.title
 	if title == "" {
 		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 	}
 
 	var durationPtr *float64
-	var bitratePtr *int
+	var bitratePtr, sampleRatePtr, channelsPtr *int
+	var codec string
 
-	if strings.EqualFold(filepath.Ext(path), ".mp3") {
-		dur, err := computeMP3Duration(path)
-		if err == nil && dur > 0 {
-			duration := dur
+	if stream, err := probeStream(path, opts); err == nil {
+		codec = stream.codec
+		if stream.duration > 0 {
+			duration := stream.duration
 			durationPtr = &duration
 
-			bitrate := int(math.Round((float64(info.Size()) * 8) / duration / 1000))
+			bitrate := stream.bitrateKbps
+			if bitrate <= 0 {
+				bitrate = int(math.Round((float64(info.Size()) * 8) / duration / 1000))
+			}
 			if bitrate > 0 {
 				bitratePtr = &bitrate
 			}
 		}
+		if stream.sampleRate > 0 {
+			sampleRate := stream.sampleRate
+			sampleRatePtr = &sampleRate
+		}
+		if stream.channels > 0 {
+			channels := stream.channels
+			channelsPtr = &channels
+		}
 	}
 
-	return models.Episode{
+	episode := models.Episode{
 		ID:              relative,
 		Filename:        filepath.Base(path),
 		RelativePath:    relative,
 		Title:           title,
-		Artist:          artist,
-		Album:           album,
+		Artist:          tags.artist,
+		Album:           tags.album,
 		DurationSeconds: durationPtr,
 		BitrateKbps:     bitratePtr,
+		SampleRateHz:    sampleRatePtr,
+		Channels:        channelsPtr,
+		Codec:           codec,
 		FilesizeBytes:   info.Size(),
 		ModifiedAt:      info.ModTime().UTC().Round(time.Second),
-	}, nil
+		Description:     tags.comment,
+	}
+	if tags.track > 0 {
+		track := tags.track
+		episode.EpisodeNumber = &track
+	}
+
+	if chapters, err := readChapters(path); err == nil {
+		episode.Chapters = chapters
+	}
+
+	var companionErr error
+	if chaptersPath, _ := dir.ChaptersFile(path); chaptersPath != "" {
+		chapters, err := ReadChaptersFile(chaptersPath)
+		if err != nil {
+			companionErr = &SidecarError{Path: chaptersPath, Err: err}
+		} else {
+			episode.Chapters = chapters
+		}
+	}
+
+	if sidecarPath, _ := dir.Sidecar(path); sidecarPath != "" {
+		sidecar, err := ReadSidecar(sidecarPath)
+		merged := episode
+		if err == nil {
+			err = sidecar.apply(&merged, path, root)
+		}
+		if err != nil {
+			return episode, &SidecarError{Path: sidecarPath, Err: err}
+		}
+		episode = merged
+	}
+
+	return episode, companionErr
 }
 
-func readTags(path string) (string, *string, *string) {
+// tagInfo holds the embedded tag fields used for an episode.
+type tagInfo struct {
+	title   string
+	artist  *string
+	album   *string
+	comment string
+	// track is the track number, which podcast encoders use for the
+	// episode number.
+	track int
+}
+
+func readTags(path string) tagInfo {
 	f, err := os.Open(path)
 	if err != nil {
-		return "", nil, nil
+		return tagInfo{}
 	}
 	defer f.Close()
 
 	meta, err := tag.ReadFrom(f)
 	if err != nil {
-		return "", nil, nil
+		return tagInfo{}
 	}
 
-	title := strings.TrimSpace(meta.Title())
-	artist := optionalString(meta.Artist())
-	album := optionalString(meta.Album())
-	return title, artist, album
+	track, _ := meta.Track()
+	return tagInfo{
+		title:   strings.TrimSpace(meta.Title()),
+		artist:  optionalString(meta.Artist()),
+		album:   optionalString(meta.Album()),
+		comment: strings.TrimSpace(meta.Comment()),
+		track:   track,
+	}
 }
 
 func optionalString(value string) *string {
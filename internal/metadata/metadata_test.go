@@ -19,7 +19,7 @@ func TestBuildEpisodeWithFallbackMetadata(t *testing.T) {
 		t.Fatalf("write file: %v", err)
 	}
 
-	episode, err := BuildEpisode(path, root)
+	episode, err := BuildEpisode(path, root, Options{})
 	if err != nil {
 		t.Fatalf("BuildEpisode: %v", err)
 	}
@@ -55,7 +55,7 @@ func TestBuildEpisodeWithInvalidMP3(t *testing.T) {
 		t.Fatalf("write file: %v", err)
 	}
 
-	episode, err := BuildEpisode(path, root)
+	episode, err := BuildEpisode(path, root, Options{})
 	if err != nil {
 		t.Fatalf("BuildEpisode unexpected error: %v", err)
 	}
@@ -69,8 +69,8 @@ func TestBuildEpisodeWithInvalidMP3(t *testing.T) {
 }
 
 func TestReadTagsAndOptionalString(t *testing.T) {
-	title, artist, album := readTags("/no/such/file.wav")
-	if title != "" || artist != nil || album != nil {
+	tags := readTags("/no/such/file.wav")
+	if tags.title != "" || tags.artist != nil || tags.album != nil || tags.comment != "" || tags.track != 0 {
 		t.Fatalf("expected empty metadata on failure")
 	}
 
@@ -106,7 +106,7 @@ func TestComputeMP3DurationErrors(t *testing.T) {
 
 func TestBuildEpisodeNonexistentFile(t *testing.T) {
 	root := t.TempDir()
-	_, err := BuildEpisode(filepath.Join(root, "missing.wav"), root)
+	_, err := BuildEpisode(filepath.Join(root, "missing.wav"), root, Options{})
 	if err == nil {
 		t.Fatalf("expected error for nonexistent file")
 	}
@@ -120,7 +120,7 @@ func TestBuildEpisodeNonMP3HasNoDuration(t *testing.T) {
 			t.Fatalf("write %s: %v", ext, err)
 		}
 
-		ep, err := BuildEpisode(path, root)
+		ep, err := BuildEpisode(path, root, Options{})
 		if err != nil {
 			t.Fatalf("BuildEpisode(%s): %v", ext, err)
 		}
@@ -140,7 +140,7 @@ func TestBuildEpisodeFilenameFallbackTitle(t *testing.T) {
 		t.Fatalf("write file: %v", err)
 	}
 
-	ep, err := BuildEpisode(path, root)
+	ep, err := BuildEpisode(path, root, Options{})
 	if err != nil {
 		t.Fatalf("BuildEpisode: %v", err)
 	}
@@ -157,7 +157,7 @@ func TestBuildEpisodeFilesizeAndFilename(t *testing.T) {
 		t.Fatalf("write file: %v", err)
 	}
 
-	ep, err := BuildEpisode(path, root)
+	ep, err := BuildEpisode(path, root, Options{})
 	if err != nil {
 		t.Fatalf("BuildEpisode: %v", err)
 	}
@@ -171,3 +171,23 @@ func TestBuildEpisodeFilesizeAndFilename(t *testing.T) {
 		t.Fatalf("expected relative path 'clip.wav', got %q", ep.RelativePath)
 	}
 }
+
+func TestBuildEpisodeUsesCommentAndTrackTags(t *testing.T) {
+	tag := id3v23Tag(
+		id3v23Frame("TIT2", []byte{0}, []byte("Tagged")),
+		id3v23Frame("TRCK", []byte{0}, []byte("12/40")),
+		id3v23Frame("COMM", []byte{0}, []byte("eng"), []byte{0}, []byte("Notes from the tag.")),
+	)
+	path := writeFixture(t, "tagged.mp3", concat(tag, repeatFrames(mp3FrameBytes(9, nil), 4)))
+
+	episode, err := BuildEpisode(path, filepath.Dir(path), Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	if episode.Description != "Notes from the tag." {
+		t.Fatalf("expected comment as description, got %q", episode.Description)
+	}
+	if episode.EpisodeNumber == nil || *episode.EpisodeNumber != 12 {
+		t.Fatalf("expected track number as episode number, got %v", episode.EpisodeNumber)
+	}
+}
@@ -0,0 +1,279 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+const (
+	// mp3SyncSearch bounds how far past any ID3v2 tag the first frame is
+	// looked for.
+	mp3SyncSearch = 64 << 10
+	// mp3CBRProbeFrames is how many leading frames must share a bitrate
+	// before the file is treated as constant bitrate.
+	mp3CBRProbeFrames = 4
+	id3v1Size         = 128
+)
+
+const (
+	mp3Version1  = 1
+	mp3Version2  = 2
+	mp3Version25 = 25
+)
+
+var mp3Bitrates = map[[2]int][16]int{
+	{mp3Version1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{mp3Version1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{mp3Version1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{mp3Version2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{mp3Version2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{mp3Version2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mp3SampleRates = map[int][3]int{
+	mp3Version1:  {44100, 48000, 32000},
+	mp3Version2:  {22050, 24000, 16000},
+	mp3Version25: {11025, 12000, 8000},
+}
+
+// mp3Frame is a decoded MPEG audio frame header.
+type mp3Frame struct {
+	version    int
+	layer      int
+	bitrate    int // kbps
+	sampleRate int
+	padding    int
+	mono       bool
+}
+
+// parseMP3Frame decodes the four header bytes in b.
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+
+	var frame mp3Frame
+	switch b[1] >> 3 & 0x03 {
+	case 0:
+		frame.version = mp3Version25
+	case 2:
+		frame.version = mp3Version2
+	case 3:
+		frame.version = mp3Version1
+	default:
+		return mp3Frame{}, false
+	}
+
+	frame.layer = 4 - int(b[1]>>1&0x03)
+	if frame.layer == 4 {
+		return mp3Frame{}, false
+	}
+
+	tableVersion := frame.version
+	if tableVersion == mp3Version25 {
+		tableVersion = mp3Version2
+	}
+	bitrateIndex := int(b[2] >> 4)
+	if bitrateIndex == 0 || bitrateIndex == 15 {
+		// Free-format streams cannot be measured from the header alone.
+		return mp3Frame{}, false
+	}
+	frame.bitrate = mp3Bitrates[[2]int{tableVersion, frame.layer}][bitrateIndex]
+
+	rateIndex := int(b[2] >> 2 & 0x03)
+	if rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+	frame.sampleRate = mp3SampleRates[frame.version][rateIndex]
+	frame.padding = int(b[2] >> 1 & 0x01)
+	frame.mono = b[3]>>6 == 0x03
+	return frame, true
+}
+
+func (f mp3Frame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != mp3Version1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+func (f mp3Frame) length() int {
+	if f.layer == 1 {
+		return (12*f.bitrate*1000/f.sampleRate + f.padding) * 4
+	}
+	return f.samples()/8*f.bitrate*1000/f.sampleRate + f.padding
+}
+
+// sideInfoSize is the size of the Layer III side information that precedes
+// a Xing/Info header inside the first frame.
+func (f mp3Frame) sideInfoSize() int {
+	switch {
+	case f.version == mp3Version1 && f.mono:
+		return 17
+	case f.version == mp3Version1:
+		return 32
+	case f.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// firstMP3Frame finds the first frame after any ID3v2 tag whose successor
+// is also a valid frame, which rules out stray sync patterns.
+func firstMP3Frame(f *os.File, size int64) (int64, mp3Frame, bool) {
+	start := id3v2Size(f)
+	buf := make([]byte, min(mp3SyncSearch, max(size-start, 0)))
+	if len(buf) < 4 || readFull(f, buf, start) != nil {
+		return 0, mp3Frame{}, false
+	}
+
+	for i := 0; i+4 <= len(buf); i++ {
+		frame, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+		next := start + int64(i) + int64(frame.length())
+		if next+4 > size {
+			continue
+		}
+		var header [4]byte
+		if readFull(f, header[:], next) != nil {
+			continue
+		}
+		if _, ok := parseMP3Frame(header[:]); ok {
+			return start + int64(i), frame, true
+		}
+	}
+	return 0, mp3Frame{}, false
+}
+
+// mp3HeaderDuration reads the Xing/Info or VBRI header stored in the first
+// frame. It returns the duration and the name of the header used.
+func mp3HeaderDuration(f *os.File, off int64, frame mp3Frame) (float64, string, bool) {
+	buf := make([]byte, min(frame.length(), 512))
+	if readFull(f, buf, off) != nil {
+		return 0, "", false
+	}
+
+	if pos := 4 + frame.sideInfoSize(); pos+8 <= len(buf) {
+		if tag := string(buf[pos : pos+4]); tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(buf[pos+4:])
+			pos += 8
+			if flags&0x01 == 0 || pos+4 > len(buf) {
+				return 0, "", false
+			}
+			frames := int64(binary.BigEndian.Uint32(buf[pos:]))
+			pos += 4
+			if flags&0x02 != 0 {
+				pos += 4
+			}
+			if flags&0x04 != 0 {
+				pos += 100
+			}
+			if flags&0x08 != 0 {
+				pos += 4
+			}
+
+			samples := frames * int64(frame.samples())
+			// The LAME extension records encoder delay and padding, which
+			// are not part of the programme audio.
+			if pos+24 <= len(buf) {
+				switch string(buf[pos : pos+4]) {
+				case "LAME", "Lavf", "Lavc":
+					delay := int64(buf[pos+21])<<4 | int64(buf[pos+22])>>4
+					padding := int64(buf[pos+22]&0x0f)<<8 | int64(buf[pos+23])
+					if trimmed := samples - delay - padding; trimmed > 0 {
+						samples = trimmed
+					}
+				}
+			}
+			return float64(samples) / float64(frame.sampleRate), tag, frames > 0
+		}
+	}
+
+	if pos := 4 + 32; pos+18 <= len(buf) && string(buf[pos:pos+4]) == "VBRI" {
+		frames := int64(binary.BigEndian.Uint32(buf[pos+14:]))
+		return float64(frames*int64(frame.samples())) / float64(frame.sampleRate), "VBRI", frames > 0
+	}
+
+	return 0, "", false
+}
+
+// mp3CBRDuration assumes a constant bitrate when the leading frames agree
+// and derives the duration from the size of the audio data.
+func mp3CBRDuration(f *os.File, size, off int64, first mp3Frame) (float64, bool) {
+	end := size
+	var tag [3]byte
+	if size >= id3v1Size && readFull(f, tag[:], size-id3v1Size) == nil && string(tag[:]) == "TAG" {
+		end -= id3v1Size
+	}
+
+	pos := off
+	frame := first
+	for i := 0; i < mp3CBRProbeFrames; i++ {
+		if frame.bitrate != first.bitrate || frame.sampleRate != first.sampleRate {
+			return 0, false
+		}
+		pos += int64(frame.length())
+		if i == mp3CBRProbeFrames-1 {
+			break
+		}
+		var header [4]byte
+		if pos+4 > end || readFull(f, header[:], pos) != nil {
+			return 0, false
+		}
+		var ok bool
+		if frame, ok = parseMP3Frame(header[:]); !ok {
+			return 0, false
+		}
+	}
+
+	return float64(end-off) * 8 / float64(first.bitrate*1000), end > off
+}
+
+// parseMP3 measures an MP3 file. Unless opts.AccurateMP3 is set it trusts a
+// Xing/Info or VBRI header, then constant-bitrate arithmetic, and decodes
+// every frame only when neither applies.
+func parseMP3(f *os.File, size int64, opts Options) (streamInfo, error) {
+	info := streamInfo{codec: "mp3"}
+
+	off, frame, found := firstMP3Frame(f, size)
+	if found {
+		info.sampleRate = frame.sampleRate
+		info.channels = 2
+		if frame.mono {
+			info.channels = 1
+		}
+	}
+
+	if found && !opts.AccurateMP3 {
+		if duration, method, ok := mp3HeaderDuration(f, off, frame); ok {
+			opts.debugf("mp3 duration for %s from %s header: %.3fs", f.Name(), method, duration)
+			info.duration = duration
+			return info, nil
+		}
+		if duration, ok := mp3CBRDuration(f, size, off, frame); ok {
+			opts.debugf("mp3 duration for %s from constant bitrate: %.3fs", f.Name(), duration)
+			info.duration = duration
+			info.bitrateKbps = frame.bitrate
+			return info, nil
+		}
+	}
+
+	duration, err := computeMP3Duration(f.Name())
+	if err != nil {
+		return streamInfo{}, err
+	}
+	if opts.AccurateMP3 {
+		opts.debugf("mp3 duration for %s from full decode (accurate mode): %.3fs", f.Name(), duration)
+	} else {
+		opts.debugf("mp3 duration for %s from full decode: %.3fs", f.Name(), duration)
+	}
+	info.duration = duration
+	return info, nil
+}
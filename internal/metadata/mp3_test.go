@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"strings"
+	"testing"
+)
+
+// mp3FrameBytes builds an MPEG-1 Layer III frame at 44.1 kHz stereo with the
+// given bitrate index, optionally carrying payload right after the side info.
+func mp3FrameBytes(bitrateIndex byte, payload []byte) []byte {
+	header := []byte{0xff, 0xfb, bitrateIndex<<4 | 0<<2, 0x00}
+	frame, _ := parseMP3Frame(header)
+	buf := make([]byte, frame.length())
+	copy(buf, header)
+	copy(buf[4+frame.sideInfoSize():], payload)
+	return buf
+}
+
+func repeatFrames(frame []byte, n int) []byte {
+	return bytes.Repeat(frame, n)
+}
+
+func probeMP3(t *testing.T, data []byte, opts Options) (streamInfo, string) {
+	t.Helper()
+	var debug strings.Builder
+	opts.Debug = log.New(&debug, "", 0)
+	path := writeFixture(t, "clip.mp3", data)
+	info, err := probeStream(path, opts)
+	if err != nil {
+		t.Fatalf("probeStream: %v", err)
+	}
+	return info, debug.String()
+}
+
+func TestParseMP3Frame(t *testing.T) {
+	frame, ok := parseMP3Frame([]byte{0xff, 0xfb, 0x90, 0x00})
+	if !ok {
+		t.Fatalf("expected valid frame header")
+	}
+	if frame.bitrate != 128 || frame.sampleRate != 44100 || frame.length() != 417 || frame.samples() != 1152 {
+		t.Fatalf("unexpected frame %+v (length %d)", frame, frame.length())
+	}
+
+	for _, header := range [][]byte{{0xff, 0xfb, 0xf0, 0x00}, {0xff, 0xfb, 0x0c, 0x00}, {0xff, 0xe9, 0x90, 0x00}, {0x00, 0x00, 0x00, 0x00}} {
+		if _, ok := parseMP3Frame(header); ok {
+			t.Fatalf("expected header % x to be rejected", header)
+		}
+	}
+}
+
+func TestMP3DurationFromXingWithLAMEPadding(t *testing.T) {
+	xing := []byte("Xing\x00\x00\x00\x01\x00\x00\x03\xe8") // frames flag, 1000 frames
+	lame := make([]byte, 24)
+	copy(lame, "LAME3.100")
+	lame[21], lame[22], lame[23] = 0x24, 0x03, 0xe8 // delay 576, padding 1000
+
+	data := append(mp3FrameBytes(9, append(xing, lame...)), repeatFrames(mp3FrameBytes(5, nil), 3)...)
+	data = append(data, repeatFrames(mp3FrameBytes(11, nil), 3)...)
+
+	info, debug := probeMP3(t, data, Options{})
+	want := float64(1000*1152-576-1000) / 44100
+	if math.Abs(info.duration-want) > 1e-9 {
+		t.Fatalf("duration: got %f want %f", info.duration, want)
+	}
+	if !strings.Contains(debug, "Xing header") {
+		t.Fatalf("expected debug log to name the Xing header, got %q", debug)
+	}
+	if info.sampleRate != 44100 || info.channels != 2 || info.codec != "mp3" {
+		t.Fatalf("unexpected stream details %+v", info)
+	}
+}
+
+func TestMP3DurationFromVBRI(t *testing.T) {
+	vbri := []byte("VBRI\x00\x01\x00\x00\x00\x4b\x00\x00\x00\x00\x00\x00\x01\xf4") // 500 frames
+	frame := mp3FrameBytes(9, nil)
+	copy(frame[36:], vbri)
+	data := append(frame, repeatFrames(mp3FrameBytes(9, nil), 3)...)
+
+	info, debug := probeMP3(t, data, Options{})
+	if want := float64(500*1152) / 44100; math.Abs(info.duration-want) > 1e-9 {
+		t.Fatalf("duration: got %f want %f", info.duration, want)
+	}
+	if !strings.Contains(debug, "VBRI header") {
+		t.Fatalf("expected debug log to name the VBRI header, got %q", debug)
+	}
+}
+
+func TestMP3DurationFromConstantBitrate(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	data := append(id3, repeatFrames(mp3FrameBytes(9, nil), 100)...)
+	data = append(data, append([]byte("TAG"), make([]byte, id3v1Size-3)...)...)
+
+	info, debug := probeMP3(t, data, Options{})
+	if want := float64(100*417*8) / 128000; math.Abs(info.duration-want) > 1e-9 {
+		t.Fatalf("duration: got %f want %f", info.duration, want)
+	}
+	if info.bitrateKbps != 128 {
+		t.Fatalf("expected header bitrate, got %d", info.bitrateKbps)
+	}
+	if !strings.Contains(debug, "constant bitrate") {
+		t.Fatalf("expected debug log to name the CBR method, got %q", debug)
+	}
+}
+
+func TestMP3DurationFallsBackToDecode(t *testing.T) {
+	var data []byte
+	for i := range 40 {
+		data = append(data, mp3FrameBytes(byte(9+i%3), nil)...)
+	}
+
+	info, debug := probeMP3(t, data, Options{})
+	if want := float64(40*1152) / 44100; math.Abs(info.duration-want) > 0.001 {
+		t.Fatalf("duration: got %f want %f", info.duration, want)
+	}
+	if !strings.Contains(debug, "full decode:") {
+		t.Fatalf("expected VBR without header to be decoded, got %q", debug)
+	}
+
+	cbr := repeatFrames(mp3FrameBytes(9, nil), 20)
+	info, debug = probeMP3(t, cbr, Options{AccurateMP3: true})
+	if want := float64(20*1152) / 44100; math.Abs(info.duration-want) > 0.001 {
+		t.Fatalf("accurate duration: got %f want %f", info.duration, want)
+	}
+	if !strings.Contains(debug, "accurate mode") {
+		t.Fatalf("expected accurate mode to decode, got %q", debug)
+	}
+}
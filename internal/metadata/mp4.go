@@ -0,0 +1,203 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+)
+
+// mp4Box is a box header found while walking an ISO base media file.
+type mp4Box struct {
+	kind  string
+	start int64 // offset of the payload
+	end   int64 // offset just past the box
+}
+
+// mp4Boxes lists the child boxes stored between start and end.
+func mp4Boxes(f *os.File, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for off := start; off+8 <= end; {
+		var header [16]byte
+		if err := readFull(f, header[:8], off); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		box := mp4Box{kind: string(header[4:8]), start: off + 8}
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if err := readFull(f, header[8:16], off+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.start += 8
+		}
+		if size < box.start-off || off+size > end {
+			return nil, errUnrecognised
+		}
+		box.end = off + size
+		boxes = append(boxes, box)
+		off = box.end
+	}
+	return boxes, nil
+}
+
+// mp4Child returns the first child of kind, if any.
+func mp4Child(f *os.File, parent mp4Box, kind string) (mp4Box, bool) {
+	boxes, err := mp4Boxes(f, parent.start, parent.end)
+	if err != nil {
+		return mp4Box{}, false
+	}
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// mp4Payload reads up to limit bytes of the box payload.
+func mp4Payload(f *os.File, box mp4Box, limit int64) ([]byte, error) {
+	buf := make([]byte, min(box.end-box.start, limit))
+	if err := readFull(f, buf, box.start); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// mp4Duration decodes the timescale and duration of an mvhd or mdhd box.
+func mp4Duration(f *os.File, box mp4Box) (timescale uint32, duration uint64, ok bool) {
+	payload, err := mp4Payload(f, box, 32)
+	if err != nil || len(payload) < 20 {
+		return 0, 0, false
+	}
+	if payload[0] == 1 {
+		if len(payload) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(payload[20:24]), binary.BigEndian.Uint64(payload[24:32]), true
+	}
+	return binary.BigEndian.Uint32(payload[12:16]), uint64(binary.BigEndian.Uint32(payload[16:20])), true
+}
+
+// parseMP4 reads the movie header (mvhd) and, for the first sound track, the
+// media header (mdhd) and sample description (stsd) of an MP4/M4A file.
+func parseMP4(f *os.File, size int64) (streamInfo, error) {
+	top, err := mp4Boxes(f, 0, size)
+	if err != nil || len(top) == 0 || top[0].kind != "ftyp" {
+		return streamInfo{}, errUnrecognised
+	}
+
+	var moov mp4Box
+	found := false
+	for _, box := range top {
+		if box.kind == "moov" {
+			moov, found = box, true
+			break
+		}
+	}
+	if !found {
+		return streamInfo{}, errUnrecognised
+	}
+
+	var info streamInfo
+	if mvhd, ok := mp4Child(f, moov, "mvhd"); ok {
+		if timescale, duration, ok := mp4Duration(f, mvhd); ok && timescale > 0 {
+			info.duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	traks, err := mp4Boxes(f, moov.start, moov.end)
+	if err != nil {
+		return streamInfo{}, err
+	}
+	for _, trak := range traks {
+		if trak.kind != "trak" {
+			continue
+		}
+		if track, ok := mp4SoundTrack(f, trak); ok {
+			if track.duration > 0 {
+				info.duration = track.duration
+			}
+			info.sampleRate = track.sampleRate
+			info.channels = track.channels
+			info.codec = track.codec
+			break
+		}
+	}
+
+	if info.duration <= 0 {
+		return streamInfo{}, errUnrecognised
+	}
+	return info, nil
+}
+
+// mp4SoundTrack extracts stream details from trak when it is an audio track.
+func mp4SoundTrack(f *os.File, trak mp4Box) (streamInfo, bool) {
+	mdia, ok := mp4Child(f, trak, "mdia")
+	if !ok {
+		return streamInfo{}, false
+	}
+	hdlr, ok := mp4Child(f, mdia, "hdlr")
+	if !ok {
+		return streamInfo{}, false
+	}
+	handler, err := mp4Payload(f, hdlr, 12)
+	if err != nil || len(handler) < 12 || string(handler[8:12]) != "soun" {
+		return streamInfo{}, false
+	}
+
+	var info streamInfo
+	if mdhd, ok := mp4Child(f, mdia, "mdhd"); ok {
+		if timescale, duration, ok := mp4Duration(f, mdhd); ok && timescale > 0 {
+			info.duration = float64(duration) / float64(timescale)
+			info.sampleRate = int(timescale)
+		}
+	}
+
+	minf, ok := mp4Child(f, mdia, "minf")
+	if !ok {
+		return info, true
+	}
+	stbl, ok := mp4Child(f, minf, "stbl")
+	if !ok {
+		return info, true
+	}
+	stsd, ok := mp4Child(f, stbl, "stsd")
+	if !ok {
+		return info, true
+	}
+
+	// Full box header (4), entry count (4), then the first sample entry:
+	// size (4), format (4), reserved (6), data reference index (2), version
+	// (2), revision (2), vendor (4), channels (2), sample size (2),
+	// compression id (2), packet size (2) and a 16.16 sample rate (4).
+	entry, err := mp4Payload(f, stsd, 44)
+	if err != nil || len(entry) < 44 {
+		return info, true
+	}
+	info.codec = mp4Codec(string(entry[12:16]))
+	info.channels = int(binary.BigEndian.Uint16(entry[32:34]))
+	if rate := int(binary.BigEndian.Uint32(entry[40:44]) >> 16); rate > 0 {
+		info.sampleRate = rate
+	}
+	return info, true
+}
+
+func mp4Codec(format string) string {
+	switch format {
+	case "mp4a":
+		return "aac"
+	case "alac":
+		return "alac"
+	case "Opus":
+		return "opus"
+	case "fLaC":
+		return "flac"
+	case ".mp3":
+		return "mp3"
+	default:
+		return strings.ToLower(strings.TrimSpace(format))
+	}
+}
@@ -0,0 +1,327 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"home-podcast/internal/models"
+)
+
+// maxMP4TableBytes caps how much of a sample table box is read for a
+// chapter track.
+const maxMP4TableBytes = 1 << 20
+
+// readMP4Chapters returns the chapters of an MP4 file. A QuickTime chapter
+// track (a text track referenced by the sound track's tref/chap box) takes
+// precedence over a Nero chpl box in moov/udta.
+func readMP4Chapters(f *os.File, size int64) ([]models.Chapter, error) {
+	top, err := mp4Boxes(f, 0, size)
+	if err != nil || len(top) == 0 || top[0].kind != "ftyp" {
+		return nil, errUnrecognised
+	}
+	var moov mp4Box
+	found := false
+	for _, box := range top {
+		if box.kind == "moov" {
+			moov, found = box, true
+			break
+		}
+	}
+	if !found {
+		return nil, errUnrecognised
+	}
+
+	children, err := mp4Boxes(f, moov.start, moov.end)
+	if err != nil {
+		return nil, err
+	}
+	traks := make(map[uint32]mp4Box)
+	var chapterTracks []uint32
+	for _, box := range children {
+		if box.kind != "trak" {
+			continue
+		}
+		if id, ok := mp4TrackID(f, box); ok {
+			traks[id] = box
+		}
+		if tref, ok := mp4Child(f, box, "tref"); ok {
+			if chap, ok := mp4Child(f, tref, "chap"); ok {
+				ids, err := mp4Payload(f, chap, 64)
+				if err == nil {
+					for i := 0; i+4 <= len(ids); i += 4 {
+						chapterTracks = append(chapterTracks, binary.BigEndian.Uint32(ids[i:]))
+					}
+				}
+			}
+		}
+	}
+
+	for _, id := range chapterTracks {
+		if trak, ok := traks[id]; ok {
+			if chapters := mp4TextTrackChapters(f, trak); len(chapters) > 0 {
+				return chapters, nil
+			}
+		}
+	}
+
+	if udta, ok := mp4Child(f, moov, "udta"); ok {
+		if chpl, ok := mp4Child(f, udta, "chpl"); ok {
+			return mp4NeroChapters(f, chpl), nil
+		}
+	}
+	return nil, nil
+}
+
+// mp4TrackID reads the track ID from the tkhd box of trak.
+func mp4TrackID(f *os.File, trak mp4Box) (uint32, bool) {
+	tkhd, ok := mp4Child(f, trak, "tkhd")
+	if !ok {
+		return 0, false
+	}
+	payload, err := mp4Payload(f, tkhd, 24)
+	if err != nil || len(payload) < 16 {
+		return 0, false
+	}
+	if payload[0] == 1 {
+		if len(payload) < 24 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(payload[20:24]), true
+	}
+	return binary.BigEndian.Uint32(payload[12:16]), true
+}
+
+// mp4NeroChapters decodes a chpl box: version and flags, four reserved bytes
+// in version 1, a chapter count, then per chapter a start time in 100 ns
+// units and a length-prefixed UTF-8 title.
+func mp4NeroChapters(f *os.File, chpl mp4Box) []models.Chapter {
+	payload, err := mp4Payload(f, chpl, maxMP4TableBytes)
+	if err != nil || len(payload) < 5 {
+		return nil
+	}
+	pos := 4
+	if payload[0] == 1 {
+		pos += 4
+	}
+	if pos >= len(payload) {
+		return nil
+	}
+	count := int(payload[pos])
+	pos++
+
+	var chapters []models.Chapter
+	for range count {
+		if pos+9 > len(payload) {
+			break
+		}
+		start := binary.BigEndian.Uint64(payload[pos:])
+		length := int(payload[pos+8])
+		pos += 9
+		if pos+length > len(payload) {
+			break
+		}
+		chapters = append(chapters, models.Chapter{
+			StartSeconds: float64(start) / 1e7,
+			Title:        strings.TrimSpace(string(payload[pos : pos+length])),
+		})
+		pos += length
+	}
+	sortChapters(chapters)
+	fillChapterEnds(chapters)
+	return chapters
+}
+
+// mp4TextTrackChapters reads a QuickTime chapter track: each text sample is
+// one chapter title, timed by the track's sample table.
+func mp4TextTrackChapters(f *os.File, trak mp4Box) []models.Chapter {
+	mdia, ok := mp4Child(f, trak, "mdia")
+	if !ok {
+		return nil
+	}
+	mdhd, ok := mp4Child(f, mdia, "mdhd")
+	if !ok {
+		return nil
+	}
+	timescale, _, ok := mp4Duration(f, mdhd)
+	if !ok || timescale == 0 {
+		return nil
+	}
+	minf, ok := mp4Child(f, mdia, "minf")
+	if !ok {
+		return nil
+	}
+	stbl, ok := mp4Child(f, minf, "stbl")
+	if !ok {
+		return nil
+	}
+
+	durations := mp4SampleDurations(f, stbl)
+	offsets := mp4SampleOffsets(f, stbl)
+	count := min(len(durations), len(offsets), maxChapters)
+
+	chapters := make([]models.Chapter, 0, count)
+	var elapsed uint64
+	for i := range count {
+		start := float64(elapsed) / float64(timescale)
+		elapsed += uint64(durations[i])
+		end := float64(elapsed) / float64(timescale)
+		chapters = append(chapters, models.Chapter{
+			StartSeconds: start,
+			EndSeconds:   &end,
+			Title:        mp4TextSample(f, offsets[i]),
+		})
+	}
+	return chapters
+}
+
+// mp4SampleDurations expands the stts box into one duration per sample.
+func mp4SampleDurations(f *os.File, stbl mp4Box) []uint32 {
+	stts, ok := mp4Child(f, stbl, "stts")
+	if !ok {
+		return nil
+	}
+	payload, err := mp4Payload(f, stts, maxMP4TableBytes)
+	if err != nil || len(payload) < 8 {
+		return nil
+	}
+	entries := int(binary.BigEndian.Uint32(payload[4:8]))
+	var durations []uint32
+	for i := range entries {
+		pos := 8 + i*8
+		if pos+8 > len(payload) {
+			break
+		}
+		count := int(binary.BigEndian.Uint32(payload[pos:]))
+		delta := binary.BigEndian.Uint32(payload[pos+4:])
+		for range min(count, maxChapters-len(durations)) {
+			durations = append(durations, delta)
+		}
+	}
+	return durations
+}
+
+// mp4SampleOffsets computes the file offset of every sample from the stsz,
+// stsc and stco/co64 boxes.
+func mp4SampleOffsets(f *os.File, stbl mp4Box) []int64 {
+	sizes := mp4SampleSizes(f, stbl)
+	chunks := mp4ChunkOffsets(f, stbl)
+	stsc, ok := mp4Child(f, stbl, "stsc")
+	if !ok || len(sizes) == 0 || len(chunks) == 0 {
+		return nil
+	}
+	payload, err := mp4Payload(f, stsc, maxMP4TableBytes)
+	if err != nil || len(payload) < 8 {
+		return nil
+	}
+	type run struct{ firstChunk, samplesPerChunk int }
+	var runs []run
+	for i := range int(binary.BigEndian.Uint32(payload[4:8])) {
+		pos := 8 + i*12
+		if pos+12 > len(payload) {
+			break
+		}
+		runs = append(runs, run{
+			firstChunk:      int(binary.BigEndian.Uint32(payload[pos:])),
+			samplesPerChunk: int(binary.BigEndian.Uint32(payload[pos+4:])),
+		})
+	}
+
+	var offsets []int64
+	sample := 0
+	for chunk := 1; chunk <= len(chunks) && sample < len(sizes); chunk++ {
+		perChunk := 0
+		for _, r := range runs {
+			if r.firstChunk <= chunk {
+				perChunk = r.samplesPerChunk
+			}
+		}
+		offset := chunks[chunk-1]
+		for range perChunk {
+			if sample >= len(sizes) {
+				break
+			}
+			offsets = append(offsets, offset)
+			offset += int64(sizes[sample])
+			sample++
+		}
+	}
+	return offsets
+}
+
+func mp4SampleSizes(f *os.File, stbl mp4Box) []uint32 {
+	stsz, ok := mp4Child(f, stbl, "stsz")
+	if !ok {
+		return nil
+	}
+	payload, err := mp4Payload(f, stsz, maxMP4TableBytes)
+	if err != nil || len(payload) < 12 {
+		return nil
+	}
+	fixed := binary.BigEndian.Uint32(payload[4:8])
+	count := min(int(binary.BigEndian.Uint32(payload[8:12])), maxChapters)
+	sizes := make([]uint32, 0, count)
+	for i := range count {
+		if fixed != 0 {
+			sizes = append(sizes, fixed)
+			continue
+		}
+		pos := 12 + i*4
+		if pos+4 > len(payload) {
+			break
+		}
+		sizes = append(sizes, binary.BigEndian.Uint32(payload[pos:]))
+	}
+	return sizes
+}
+
+func mp4ChunkOffsets(f *os.File, stbl mp4Box) []int64 {
+	width := 4
+	box, ok := mp4Child(f, stbl, "stco")
+	if !ok {
+		if box, ok = mp4Child(f, stbl, "co64"); !ok {
+			return nil
+		}
+		width = 8
+	}
+	payload, err := mp4Payload(f, box, maxMP4TableBytes)
+	if err != nil || len(payload) < 8 {
+		return nil
+	}
+	count := min(int(binary.BigEndian.Uint32(payload[4:8])), maxChapters)
+	offsets := make([]int64, 0, count)
+	for i := range count {
+		pos := 8 + i*width
+		if pos+width > len(payload) {
+			break
+		}
+		if width == 8 {
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(payload[pos:])))
+		} else {
+			offsets = append(offsets, int64(binary.BigEndian.Uint32(payload[pos:])))
+		}
+	}
+	return offsets
+}
+
+// mp4TextSample reads a QuickTime text sample: a 16-bit length followed by
+// UTF-8 text, or UTF-16 when it starts with a byte order mark.
+func mp4TextSample(f *os.File, offset int64) string {
+	var prefix [2]byte
+	if err := readFull(f, prefix[:], offset); err != nil {
+		return ""
+	}
+	text := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if err := readFull(f, text, offset+2); err != nil {
+		return ""
+	}
+	if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+		units := make([]uint16, 0, len(text)/2)
+		for i := 2; i+1 < len(text); i += 2 {
+			units = append(units, binary.BigEndian.Uint16(text[i:]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(units)))
+	}
+	return strings.TrimSpace(string(text))
+}
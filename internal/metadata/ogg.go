@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+const (
+	oggPageHeaderSize = 27
+	// oggTailWindow is how much of the end of the file is searched for the
+	// final page; it doubles until a page of the stream is found.
+	oggTailWindow = 64 << 10
+	// opusRate is the fixed granule rate of Opus streams.
+	opusRate = 48000
+)
+
+var oggCapture = []byte("OggS")
+
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+}
+
+func readOggPage(f *os.File, off int64) (oggPage, int64, error) {
+	var header [oggPageHeaderSize]byte
+	if err := readFull(f, header[:], off); err != nil {
+		return oggPage{}, 0, err
+	}
+	if !bytes.Equal(header[0:4], oggCapture) || header[4] != 0 {
+		return oggPage{}, 0, errUnrecognised
+	}
+	page := oggPage{
+		granule:  int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:   binary.LittleEndian.Uint32(header[14:18]),
+		segments: make([]byte, header[26]),
+	}
+	if err := readFull(f, page.segments, off+oggPageHeaderSize); err != nil {
+		return oggPage{}, 0, err
+	}
+	return page, off + oggPageHeaderSize + int64(len(page.segments)), nil
+}
+
+// parseOgg identifies the first logical stream from its Vorbis or Opus
+// identification header and derives the duration from the granule position
+// of the stream's last page.
+func parseOgg(f *os.File, size int64) (streamInfo, error) {
+	page, body, err := readOggPage(f, 0)
+	if err != nil {
+		return streamInfo{}, err
+	}
+
+	var packetLen int64
+	for _, seg := range page.segments {
+		packetLen += int64(seg)
+		if seg < 255 {
+			break
+		}
+	}
+	packet := make([]byte, min(packetLen, 64))
+	if err := readFull(f, packet, body); err != nil {
+		return streamInfo{}, err
+	}
+
+	var (
+		info    streamInfo
+		rate    int
+		preSkip int64
+	)
+	switch {
+	case len(packet) >= 30 && packet[0] == 0x01 && string(packet[1:7]) == "vorbis":
+		info.codec = "vorbis"
+		info.channels = int(packet[11])
+		info.sampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		rate = info.sampleRate
+	case len(packet) >= 19 && string(packet[0:8]) == "OpusHead":
+		info.codec = "opus"
+		info.channels = int(packet[9])
+		info.sampleRate = opusRate
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+		rate = opusRate
+	default:
+		return streamInfo{}, errUnrecognised
+	}
+	if rate == 0 {
+		return streamInfo{}, errUnrecognised
+	}
+
+	granule, err := lastOggGranule(f, size, page.serial)
+	if err != nil {
+		return streamInfo{}, err
+	}
+	if samples := granule - preSkip; samples > 0 {
+		info.duration = float64(samples) / float64(rate)
+	}
+	return info, nil
+}
+
+// lastOggGranule returns the granule position of the last complete page of
+// the logical stream serial, scanning backwards from the end of the file.
+func lastOggGranule(f *os.File, size int64, serial uint32) (int64, error) {
+	for window := int64(oggTailWindow); ; window *= 2 {
+		start := max(size-window, 0)
+		buf := make([]byte, size-start)
+		if err := readFull(f, buf, start); err != nil {
+			return 0, err
+		}
+
+		for i := bytes.LastIndex(buf, oggCapture); i >= 0; i = bytes.LastIndex(buf[:i], oggCapture) {
+			page, _, err := readOggPage(f, start+int64(i))
+			if err != nil || page.serial != serial || page.granule < 0 {
+				continue
+			}
+			return page.granule, nil
+		}
+
+		if start == 0 {
+			return 0, errUnrecognised
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"home-podcast/internal/models"
+)
+
+// SidecarExtensions lists the companion file extensions checked next to an
+// audio file, in order of precedence.
+var SidecarExtensions = []string{".yaml", ".yml", ".json"}
+
+// EpisodeTypes lists the accepted values of the episode_type field, as
+// defined for itunes:episodeType.
+var EpisodeTypes = []string{"full", "trailer", "bonus"}
+
+// sidecarDateLayouts are the accepted formats for the published field.
+var sidecarDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// Sidecar holds the episode metadata that can be supplied in a companion
+// file. Every field is optional; set fields take precedence over embedded
+// tags.
+type Sidecar struct {
+	Title       string        `yaml:"title" json:"title"`
+	Description string        `yaml:"description" json:"description"`
+	Published   string        `yaml:"published" json:"published"`
+	Season      *int          `yaml:"season" json:"season"`
+	Episode     *int          `yaml:"episode" json:"episode"`
+	Explicit    *bool         `yaml:"explicit" json:"explicit"`
+	EpisodeType string        `yaml:"episode_type" json:"episode_type"`
+	Artwork     string        `yaml:"artwork" json:"artwork"`
+	Links       []models.Link `yaml:"links" json:"links"`
+	// Persons credits hosts and guests (podcast:person).
+	Persons []models.Person `yaml:"persons" json:"persons"`
+	// AlternateEnclosures lists other encodings of the episode
+	// (podcast:alternateEnclosure).
+	AlternateEnclosures []SidecarEnclosure `yaml:"alternate_enclosures" json:"alternate_enclosures"`
+}
+
+// SidecarEnclosure names an alternate rendition of an episode by path,
+// relative to the audio file, or by URL.
+type SidecarEnclosure struct {
+	Path        string `yaml:"path" json:"path"`
+	URL         string `yaml:"url" json:"url"`
+	Type        string `yaml:"type" json:"type"`
+	Title       string `yaml:"title" json:"title"`
+	BitrateKbps int    `yaml:"bitrate_kbps" json:"bitrate_kbps"`
+}
+
+// SidecarError reports a companion file that exists but could not be used.
+// BuildEpisode still returns the episode built from embedded tags alongside it.
+type SidecarError struct {
+	Path string
+	Err  error
+}
+
+func (e *SidecarError) Error() string {
+	return fmt.Sprintf("sidecar %s: %v", e.Path, e.Err)
+}
+
+func (e *SidecarError) Unwrap() error {
+	return e.Err
+}
+
+// IsSidecar reports whether path has a sidecar extension.
+func IsSidecar(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, candidate := range SidecarExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// FindSidecar returns the companion file for the audio file at path, or an
+// empty path when there is none. When several exist the first extension in
+// SidecarExtensions wins.
+func FindSidecar(path string) (string, os.FileInfo) {
+	return ReadDirectory(filepath.Dir(path)).Sidecar(path)
+}
+
+// Sidecar is FindSidecar for an audio file in d.
+func (d *Directory) Sidecar(path string) (string, os.FileInfo) {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, ext := range SidecarExtensions {
+		if candidate, info := d.file(stem + ext); candidate != "" {
+			return candidate, info
+		}
+	}
+	return "", nil
+}
+
+// ReadSidecar decodes the companion file at path. JSON files are decoded
+// strictly; YAML files may use any YAML syntax.
+func ReadSidecar(path string) (Sidecar, error) {
+	var sidecar Sidecar
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sidecar, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&sidecar)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&sidecar)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return Sidecar{}, err
+	}
+
+	for i, link := range sidecar.Links {
+		if strings.TrimSpace(link.URL) == "" {
+			return Sidecar{}, fmt.Errorf("link %d has no url", i+1)
+		}
+	}
+	for i, person := range sidecar.Persons {
+		if strings.TrimSpace(person.Name) == "" {
+			return Sidecar{}, fmt.Errorf("person %d has no name", i+1)
+		}
+	}
+	for i, enclosure := range sidecar.AlternateEnclosures {
+		if (strings.TrimSpace(enclosure.Path) == "") == (strings.TrimSpace(enclosure.URL) == "") {
+			return Sidecar{}, fmt.Errorf("alternate enclosure %d needs either a path or a url", i+1)
+		}
+	}
+	return sidecar, nil
+}
+
+// apply merges the sidecar over episode. audioPath and root locate relative
+// artwork and enclosure paths, which are stored relative to root.
+func (s Sidecar) apply(episode *models.Episode, audioPath, root string) error {
+	if title := strings.TrimSpace(s.Title); title != "" {
+		episode.Title = title
+	}
+	if description := strings.TrimSpace(s.Description); description != "" {
+		episode.Description = description
+	}
+	if published := strings.TrimSpace(s.Published); published != "" {
+		parsed, err := parseSidecarDate(published)
+		if err != nil {
+			return err
+		}
+		episode.PublishedAt = &parsed
+	}
+	if s.Season != nil {
+		season := *s.Season
+		episode.Season = &season
+	}
+	if s.Episode != nil {
+		number := *s.Episode
+		episode.EpisodeNumber = &number
+	}
+	if s.Explicit != nil {
+		explicit := *s.Explicit
+		episode.Explicit = &explicit
+	}
+	if episodeType := strings.ToLower(strings.TrimSpace(s.EpisodeType)); episodeType != "" {
+		if !slices.Contains(EpisodeTypes, episodeType) {
+			return fmt.Errorf("unknown episode_type %q", s.EpisodeType)
+		}
+		episode.EpisodeType = episodeType
+	}
+	if artwork := strings.TrimSpace(s.Artwork); artwork != "" {
+		episode.Artwork = resolvePath(artwork, audioPath, root)
+	}
+	if len(s.Persons) > 0 {
+		episode.Persons = nil
+		for _, person := range s.Persons {
+			episode.Persons = append(episode.Persons, models.Person{
+				Name:  strings.TrimSpace(person.Name),
+				Role:  strings.ToLower(strings.TrimSpace(person.Role)),
+				Group: strings.ToLower(strings.TrimSpace(person.Group)),
+				Image: strings.TrimSpace(person.Image),
+				URL:   strings.TrimSpace(person.URL),
+			})
+		}
+	}
+	if len(s.AlternateEnclosures) > 0 {
+		episode.AlternateEnclosures = nil
+		for _, entry := range s.AlternateEnclosures {
+			enclosure, err := entry.resolve(audioPath, root)
+			if err != nil {
+				return err
+			}
+			episode.AlternateEnclosures = append(episode.AlternateEnclosures, enclosure)
+		}
+	}
+	if len(s.Links) > 0 {
+		episode.Links = append([]models.Link(nil), s.Links...)
+	}
+	return nil
+}
+
+func parseSidecarDate(value string) (time.Time, error) {
+	for _, layout := range sidecarDateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised published date %q", value)
+}
+
+// resolve describes the enclosure, checking that a referenced file exists
+// inside root.
+func (e SidecarEnclosure) resolve(audioPath, root string) (models.AlternateEnclosure, error) {
+	enclosure := models.AlternateEnclosure{
+		URL:         strings.TrimSpace(e.URL),
+		Type:        strings.TrimSpace(e.Type),
+		Title:       strings.TrimSpace(e.Title),
+		BitrateKbps: e.BitrateKbps,
+	}
+	if path := strings.TrimSpace(e.Path); path != "" {
+		enclosure.Path = resolvePath(path, audioPath, root)
+		if strings.Contains(path, "://") || !filepath.IsLocal(filepath.FromSlash(enclosure.Path)) {
+			return models.AlternateEnclosure{}, fmt.Errorf("alternate enclosure %q is outside the audio directory", path)
+		}
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(enclosure.Path)))
+		if err != nil {
+			return models.AlternateEnclosure{}, fmt.Errorf("alternate enclosure: %w", err)
+		}
+		enclosure.Length = info.Size()
+	}
+	return enclosure, nil
+}
+
+// resolvePath keeps URLs as they are and turns file paths, which are
+// relative to the audio file, into slash-separated paths relative to root.
+func resolvePath(value, audioPath, root string) string {
+	if strings.Contains(value, "://") {
+		return value
+	}
+
+	path := filepath.FromSlash(value)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(audioPath), path)
+	}
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(value)
+	}
+	return filepath.ToSlash(relative)
+}
@@ -0,0 +1,169 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestBuildEpisodeMergesYAMLSidecar(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "show")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	audio := filepath.Join(dir, "ep1.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	sidecar := `title: Pilot
+description: The very first one.
+published: 2024-03-01
+season: 1
+episode: 1
+explicit: false
+episode_type: Bonus
+artwork: ../art/cover.jpg
+links:
+  - title: Show notes
+    url: https://example.com/pilot
+`
+	if err := os.WriteFile(filepath.Join(dir, "ep1.yaml"), []byte(sidecar), 0o644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+
+	episode, err := BuildEpisode(audio, root, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+
+	if episode.Title != "Pilot" || episode.Description != "The very first one." {
+		t.Fatalf("unexpected title/description: %q / %q", episode.Title, episode.Description)
+	}
+	if episode.PublishedAt == nil || !episode.PublishedAt.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected publish date %v", episode.PublishedAt)
+	}
+	if episode.Season == nil || *episode.Season != 1 || episode.EpisodeNumber == nil || *episode.EpisodeNumber != 1 {
+		t.Fatalf("unexpected season/episode %v/%v", episode.Season, episode.EpisodeNumber)
+	}
+	if episode.Explicit == nil || *episode.Explicit {
+		t.Fatalf("expected explicit=false, got %v", episode.Explicit)
+	}
+	if episode.EpisodeType != "bonus" {
+		t.Fatalf("expected normalised episode type, got %q", episode.EpisodeType)
+	}
+	if episode.Artwork != "art/cover.jpg" {
+		t.Fatalf("expected artwork relative to root, got %q", episode.Artwork)
+	}
+	if len(episode.Links) != 1 || episode.Links[0].URL != "https://example.com/pilot" {
+		t.Fatalf("unexpected links %+v", episode.Links)
+	}
+}
+
+func TestBuildEpisodeJSONSidecarAndPrecedence(t *testing.T) {
+	root := t.TempDir()
+	audio := filepath.Join(root, "ep.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "ep.json"), []byte(`{"title":"From JSON","artwork":"https://cdn.example/a.png"}`), 0o644); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+
+	episode, err := BuildEpisode(audio, root, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	if episode.Title != "From JSON" || episode.Artwork != "https://cdn.example/a.png" {
+		t.Fatalf("unexpected episode %+v", episode)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "ep.yml"), []byte("title: From YAML\n"), 0o644); err != nil {
+		t.Fatalf("write yml: %v", err)
+	}
+	episode, err = BuildEpisode(audio, root, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	if episode.Title != "From YAML" {
+		t.Fatalf("expected YAML sidecar to take precedence, got %q", episode.Title)
+	}
+}
+
+func TestBuildEpisodeInvalidSidecarFallsBackToTags(t *testing.T) {
+	root := t.TempDir()
+	audio := filepath.Join(root, "broken.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "broken.yaml"), []byte("title: Nope\npublished: last tuesday\n"), 0o644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+
+	episode, err := BuildEpisode(audio, root, Options{})
+	var sidecarErr *SidecarError
+	if !errors.As(err, &sidecarErr) {
+		t.Fatalf("expected SidecarError, got %v", err)
+	}
+	if episode.Title != "broken" || episode.PublishedAt != nil {
+		t.Fatalf("expected episode from tags only, got %+v", episode)
+	}
+}
+
+func TestBuildEpisodeSidecarPersonsAndAlternateEnclosures(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "show")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	audio := filepath.Join(dir, "ep1.mp3")
+	for path, content := range map[string]string{audio: "audio", filepath.Join(dir, "ep1.opus"): "smaller"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	sidecar := `{
+  "persons": [{"name": "Jane", "role": "Host", "url": "https://example.com/jane"}],
+  "alternate_enclosures": [
+    {"path": "ep1.opus", "title": "Opus", "bitrate_kbps": 48},
+    {"url": "https://cdn.example.com/ep1.flac", "type": "audio/flac"}
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "ep1.json"), []byte(sidecar), 0o644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+
+	episode, err := BuildEpisode(audio, root, Options{})
+	if err != nil {
+		t.Fatalf("BuildEpisode: %v", err)
+	}
+	if len(episode.Persons) != 1 || episode.Persons[0] != (models.Person{Name: "Jane", Role: "host", URL: "https://example.com/jane"}) {
+		t.Fatalf("unexpected persons %+v", episode.Persons)
+	}
+	want := []models.AlternateEnclosure{
+		{Path: "show/ep1.opus", Length: 7, BitrateKbps: 48, Title: "Opus"},
+		{URL: "https://cdn.example.com/ep1.flac", Type: "audio/flac"},
+	}
+	if len(episode.AlternateEnclosures) != 2 || episode.AlternateEnclosures[0] != want[0] || episode.AlternateEnclosures[1] != want[1] {
+		t.Fatalf("unexpected alternate enclosures %+v", episode.AlternateEnclosures)
+	}
+
+	for _, invalid := range []string{
+		`{"alternate_enclosures": [{"path": "ep1.opus", "url": "https://example.com/x"}]}`,
+		`{"alternate_enclosures": [{"path": "../../outside.mp3"}]}`,
+		`{"alternate_enclosures": [{"path": "missing.opus"}]}`,
+		`{"persons": [{"role": "guest"}]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "ep1.json"), []byte(invalid), 0o644); err != nil {
+			t.Fatalf("write sidecar: %v", err)
+		}
+		var sidecarErr *SidecarError
+		if _, err := BuildEpisode(audio, root, Options{}); !errors.As(err, &sidecarErr) {
+			t.Fatalf("expected SidecarError for %s, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatIEEEFloat  = 0x0003
+	wavFormatALaw       = 0x0006
+	wavFormatMuLaw      = 0x0007
+	wavFormatMP3        = 0x0055
+	wavFormatExtensible = 0xfffe
+)
+
+// parseWAV reads the RIFF "fmt " and "data" chunks of a WAVE file.
+func parseWAV(f *os.File, size int64) (streamInfo, error) {
+	var header [12]byte
+	if err := readFull(f, header[:], 0); err != nil {
+		return streamInfo{}, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return streamInfo{}, errUnrecognised
+	}
+
+	var (
+		info     streamInfo
+		byteRate uint32
+		dataSize int64
+		haveFmt  bool
+		haveData bool
+	)
+
+	for off := int64(12); off+8 <= size && !(haveFmt && haveData); {
+		var chunk [8]byte
+		if err := readFull(f, chunk[:], off); err != nil {
+			return streamInfo{}, err
+		}
+		id := string(chunk[0:4])
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		body := off + 8
+
+		switch id {
+		case "fmt ":
+			if length < 16 {
+				return streamInfo{}, errUnrecognised
+			}
+			var fmtChunk [40]byte
+			n := min(length, int64(len(fmtChunk)))
+			if err := readFull(f, fmtChunk[:n], body); err != nil {
+				return streamInfo{}, err
+			}
+			format := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			info.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			info.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			if format == wavFormatExtensible && n >= 26 {
+				// The first two bytes of the sub-format GUID carry the real format.
+				format = binary.LittleEndian.Uint16(fmtChunk[24:26])
+			}
+			info.codec = wavCodec(format)
+			haveFmt = true
+		case "data":
+			// Streaming writers leave the size unset; use what is on disk.
+			if length == 0 || length == 0xffffffff || body+length > size {
+				length = size - body
+			}
+			dataSize = length
+			haveData = true
+		}
+
+		off = body + length + length&1
+	}
+
+	if !haveFmt || !haveData || byteRate == 0 {
+		return streamInfo{}, errUnrecognised
+	}
+
+	info.duration = float64(dataSize) / float64(byteRate)
+	info.bitrateKbps = int(byteRate * 8 / 1000)
+	return info, nil
+}
+
+func wavCodec(format uint16) string {
+	switch format {
+	case wavFormatPCM:
+		return "pcm"
+	case wavFormatIEEEFloat:
+		return "pcm_float"
+	case wavFormatALaw:
+		return "alaw"
+	case wavFormatMuLaw:
+		return "mulaw"
+	case wavFormatMP3:
+		return "mp3"
+	default:
+		return fmt.Sprintf("wav_0x%04x", format)
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+// ChangeType classifies how an episode differs between two library snapshots.
+type ChangeType string
+
+const (
+	// ChangeAdded marks an episode that appeared in the library.
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved marks an episode that disappeared from the library.
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified marks an episode whose metadata changed.
+	ChangeModified ChangeType = "modified"
+)
+
+// EpisodeChange describes a single episode difference. Old is nil for added
+// episodes and New is nil for removed ones.
+type EpisodeChange struct {
+	Type ChangeType `json:"type"`
+	Old  *Episode   `json:"old,omitempty"`
+	New  *Episode   `json:"new,omitempty"`
+}
+
+// ChangeSet groups the differences produced by one library refresh. The
+// generation increases by one for every change set the library produces.
+type ChangeSet struct {
+	Generation uint64          `json:"generation"`
+	Changes    []EpisodeChange `json:"changes"`
+}
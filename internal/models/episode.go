@@ -4,14 +4,80 @@ import "time"
 
 // Episode represents the metadata exposed for a single audio file.
 type Episode struct {
-	ID              string    `json:"id"`
-	Filename        string    `json:"filename"`
-	RelativePath    string    `json:"relative_path"`
-	Title           string    `json:"title"`
-	Artist          *string   `json:"artist,omitempty"`
-	Album           *string   `json:"album,omitempty"`
-	DurationSeconds *float64  `json:"duration_seconds,omitempty"`
-	BitrateKbps     *int      `json:"bitrate_kbps,omitempty"`
-	FilesizeBytes   int64     `json:"filesize_bytes"`
-	ModifiedAt      time.Time `json:"modified_at"`
+	ID              string     `json:"id"`
+	GUID            string     `json:"guid"`
+	Filename        string     `json:"filename"`
+	RelativePath    string     `json:"relative_path"`
+	Title           string     `json:"title"`
+	Artist          *string    `json:"artist,omitempty"`
+	Album           *string    `json:"album,omitempty"`
+	DurationSeconds *float64   `json:"duration_seconds,omitempty"`
+	BitrateKbps     *int       `json:"bitrate_kbps,omitempty"`
+	SampleRateHz    *int       `json:"sample_rate_hz,omitempty"`
+	Channels        *int       `json:"channels,omitempty"`
+	Codec           string     `json:"codec,omitempty"`
+	FilesizeBytes   int64      `json:"filesize_bytes"`
+	ModifiedAt      time.Time  `json:"modified_at"`
+	Description     string     `json:"description,omitempty"`
+	PublishedAt     *time.Time `json:"published_at,omitempty"`
+	Season          *int       `json:"season,omitempty"`
+	EpisodeNumber   *int       `json:"episode_number,omitempty"`
+	Explicit        *bool      `json:"explicit,omitempty"`
+	// EpisodeType is "full", "trailer" or "bonus" when set by a sidecar.
+	EpisodeType string `json:"episode_type,omitempty"`
+	// Artwork is either an absolute URL or a path relative to the audio root.
+	Artwork string `json:"artwork,omitempty"`
+	// ArtworkID identifies the cached cover image served from /artwork/.
+	ArtworkID string    `json:"artwork_id,omitempty"`
+	Links     []Link    `json:"links,omitempty"`
+	Chapters  []Chapter `json:"chapters,omitempty"`
+	// Transcripts lists the subtitle files stored next to the audio.
+	Transcripts []Transcript `json:"transcripts,omitempty"`
+	Persons     []Person     `json:"persons,omitempty"`
+	// AlternateEnclosures lists other encodings of the same episode.
+	AlternateEnclosures []AlternateEnclosure `json:"alternate_enclosures,omitempty"`
+}
+
+// Person credits someone who took part in an episode.
+type Person struct {
+	Name  string `json:"name"`
+	Role  string `json:"role,omitempty"`
+	Group string `json:"group,omitempty"`
+	Image string `json:"image,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// AlternateEnclosure is another rendition of an episode's audio, either a
+// file in the library or an external URL.
+type AlternateEnclosure struct {
+	// Path is relative to the audio root, using forward slashes.
+	Path        string `json:"path,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Length      int64  `json:"length,omitempty"`
+	BitrateKbps int    `json:"bitrate_kbps,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// Transcript is a subtitle file belonging to an episode.
+type Transcript struct {
+	// Path is relative to the audio root, using forward slashes.
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Language string `json:"language,omitempty"`
+}
+
+// Chapter marks a titled section of an episode.
+type Chapter struct {
+	StartSeconds float64  `json:"start_seconds"`
+	EndSeconds   *float64 `json:"end_seconds,omitempty"`
+	Title        string   `json:"title"`
+	URL          string   `json:"url,omitempty"`
+	Image        string   `json:"image,omitempty"`
+}
+
+// Link is a related web page attached to an episode.
+type Link struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/models"
+)
+
+// ArtworkSource is implemented by episode providers that cache cover art. It
+// backs the /artwork/ endpoint; unknown identifiers yield an error matching
+// fs.ErrNotExist.
+type ArtworkSource interface {
+	OpenArtwork(id string) (io.ReadSeekCloser, time.Time, error)
+}
+
+// artworkCacheControl lets clients keep artwork indefinitely: identifiers
+// are content hashes, so changed artwork always gets a new URL.
+const artworkCacheControl = "private, max-age=31536000, immutable"
+
+func (h *serverHandler) handleArtwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireLinkedAccess(w, r, auth.ScopeRead) {
+		return
+	}
+
+	source, ok := h.lib.(ArtworkSource)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/artwork/")
+	content, modTime, err := source.OpenArtwork(id)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			h.logger.Printf("failed to open artwork %s: %v", id, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Cache-Control", artworkCacheControl)
+	w.Header().Set("ETag", `"`+id+`"`)
+	// ServeContent sniffs the image type from the content.
+	http.ServeContent(w, r, "", modTime, content)
+}
+
+// episodeArtworkURL returns the URL of an episode's cover image: the cached
+// artwork endpoint when the library extracted one, or the URL given in the
+// episode's sidecar. It returns an empty string when there is no artwork.
+func episodeArtworkURL(ep models.Episode, resourceURL func(path string) string) string {
+	if ep.ArtworkID != "" {
+		return resourceURL("/artwork/" + ep.ArtworkID)
+	}
+	if strings.HasPrefix(ep.Artwork, "https://") || strings.HasPrefix(ep.Artwork, "http://") {
+		return ep.Artwork
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+type fakeArtworkLibrary struct {
+	fakeLibrary
+	images map[string][]byte
+}
+
+func (f *fakeArtworkLibrary) OpenArtwork(id string) (io.ReadSeekCloser, time.Time, error) {
+	data, ok := f.images[id]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("artwork %w", fs.ErrNotExist)
+	}
+	return nopCloser{bytes.NewReader(data)}, time.Unix(1700000000, 0), nil
+}
+
+const testArtworkID = "0123456789abcdef0123456789abcdef"
+
+// pngHeader is enough of a PNG signature for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestArtworkEndpoint(t *testing.T) {
+	lib := &fakeArtworkLibrary{images: map[string][]byte{testArtworkID: pngHeader}}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(lib, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/artwork/"+testArtworkID, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/artwork/"+testArtworkID+"?token=secret", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if rec.Header().Get("Cache-Control") != artworkCacheControl || rec.Header().Get("ETag") != `"`+testArtworkID+`"` {
+		t.Fatalf("missing caching headers: %v", rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/artwork/"+testArtworkID+"?token=secret", nil)
+	req.Header.Set("If-None-Match", `"`+testArtworkID+`"`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching ETag, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/artwork/ffffffffffffffffffffffffffffffff?token=secret", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown artwork, got %d", rec.Code)
+	}
+}
+
+func TestFeedReferencesArtwork(t *testing.T) {
+	episodes := []models.Episode{
+		{ID: "new.mp3", RelativePath: "new.mp3", Filename: "new.mp3", ArtworkID: testArtworkID, ModifiedAt: time.Unix(1700000000, 0)},
+		{ID: "old.mp3", RelativePath: "old.mp3", Filename: "old.mp3", Artwork: "https://cdn.example/old.png", ModifiedAt: time.Unix(1600000000, 0)},
+		{ID: "bare.mp3", RelativePath: "bare.mp3", Filename: "bare.mp3", ModifiedAt: time.Unix(1500000000, 0)},
+	}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/feed?token=secret", nil)
+	req.Host = "feed.example"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	type image struct {
+		Href string `xml:"href,attr"`
+	}
+	var payload struct {
+		Channel struct {
+			Image image `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+			Items []struct {
+				Image image `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+
+	want := "https://feed.example/artwork/" + testArtworkID + "?token=secret"
+	if payload.Channel.Image.Href != want {
+		t.Fatalf("unexpected channel image %q", payload.Channel.Image.Href)
+	}
+	items := payload.Channel.Items
+	if len(items) != 3 || items[0].Image.Href != want || items[1].Image.Href != "https://cdn.example/old.png" || items[2].Image.Href != "" {
+		t.Fatalf("unexpected item images %+v", items)
+	}
+}
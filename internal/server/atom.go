@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"home-podcast/internal/uuid"
+)
+
+// renderAtom serialises f as Atom 1.0. Enclosures, including alternate
+// renditions, become enclosure links; podcast details without an Atom
+// equivalent use the same iTunes and Podcasting 2.0 elements as the RSS feed.
+func renderAtom(f feed) ([]byte, error) {
+	atom := atomFeed{
+		NS:        "http://www.w3.org/2005/Atom",
+		ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		PodcastNS: "https://podcastindex.org/namespace/1.0",
+		Lang:      f.Language,
+		ID:        atomFeedID(f),
+		Title:     f.Title,
+		Subtitle:  f.Description,
+		Updated:   f.Updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.SelfURL},
+			{Rel: "alternate", Href: f.Link},
+		},
+		Generator:      "home-podcast",
+		Logo:           f.Image,
+		Rights:         f.Copyright,
+		ITunesExplicit: formatExplicit(f.Explicit),
+		ITunesType:     f.Type,
+		PodcastGUID:    f.GUID,
+		PodcastMedium:  f.Medium,
+	}
+
+	f.Pages.each(func(rel, href string) {
+		atom.Links = append(atom.Links, atomLink{Rel: rel, Type: "application/atom+xml", Href: href})
+	})
+	if f.Author != "" {
+		atom.Authors = []atomPerson{{Name: f.Author}}
+	}
+	if f.Image != "" {
+		atom.ITunesImage = &rssITunesImage{Href: f.Image}
+	}
+	for _, category := range f.Categories {
+		atom.Categories = append(atom.Categories, atomCategory{Term: category.Name})
+		if category.Subcategory != "" {
+			atom.Categories = append(atom.Categories, atomCategory{Term: category.Subcategory})
+		}
+	}
+	if f.Locked != nil {
+		atom.PodcastLocked = &rssPodcastLocked{Owner: f.OwnerEmail, Value: "no"}
+		if *f.Locked {
+			atom.PodcastLocked.Value = "yes"
+		}
+	}
+	for _, person := range f.Persons {
+		atom.PodcastPersons = append(atom.PodcastPersons, rssPodcastPerson(person))
+	}
+
+	for _, item := range f.Items {
+		updated := item.Modified
+		if updated.IsZero() {
+			updated = item.Published
+		}
+		if updated.IsZero() {
+			updated = f.Updated
+		}
+
+		entry := atomEntry{
+			ID:                atomEntryID(f, item),
+			Title:             item.Title,
+			Updated:           updated.UTC().Format(time.RFC3339),
+			Summary:           item.Description,
+			Links:             []atomLink{{Rel: "alternate", Href: item.Link}},
+			ITunesEpisode:     item.Episode,
+			ITunesSeason:      item.Season,
+			ITunesEpisodeType: item.EpisodeType,
+			ITunesExplicit:    formatExplicit(item.Explicit),
+			PodcastSeason:     item.Season,
+			PodcastEpisode:    item.Episode,
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Authors = []atomPerson{{Name: item.Author}}
+		}
+		for _, enclosure := range append([]feedEnclosure{item.Enclosure}, item.Alternates...) {
+			link := atomLink{Rel: "enclosure", Type: enclosure.Type, Href: enclosure.URL, Title: enclosure.Title}
+			if enclosure.Length > 0 {
+				link.Length = strconv.FormatInt(enclosure.Length, 10)
+			}
+			entry.Links = append(entry.Links, link)
+		}
+		if item.DurationSeconds != nil {
+			entry.ITunesDuration = formatDuration(*item.DurationSeconds)
+		}
+		if item.Image != "" {
+			entry.ITunesImage = &rssITunesImage{Href: item.Image}
+		}
+		if item.ChaptersURL != "" {
+			entry.PodcastChapters = &rssPodcastChapters{URL: item.ChaptersURL, Type: chaptersContentType}
+		}
+		for _, transcript := range item.Transcripts {
+			entry.PodcastTranscripts = append(entry.PodcastTranscripts, rssPodcastTranscript(transcript))
+		}
+		for _, person := range item.Persons {
+			entry.PodcastPersons = append(entry.PodcastPersons, rssPodcastPerson(person))
+		}
+
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	output, err := xml.MarshalIndent(atom, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), output...), nil
+}
+
+// atomFeedID names the feed by its podcast:guid, which never changes, and
+// falls back to the feed address when no GUID could be derived.
+func atomFeedID(f feed) string {
+	if f.GUID == "" {
+		return f.SelfURL
+	}
+	return "urn:uuid:" + f.GUID
+}
+
+// atomEntryID turns an episode GUID into the URI Atom requires. UUIDs are
+// used as they are; older path-based GUIDs are mapped to a name-based UUID
+// within the feed GUID so they stay stable as well.
+func atomEntryID(f feed, item feedItem) string {
+	if uuid.Valid(item.GUID) {
+		return "urn:uuid:" + item.GUID
+	}
+	if id, err := uuid.NewV5(f.GUID, item.GUID); err == nil {
+		return "urn:uuid:" + id
+	}
+	return item.Link
+}
+
+type atomFeed struct {
+	XMLName        xml.Name           `xml:"feed"`
+	NS             string             `xml:"xmlns,attr"`
+	ITunesNS       string             `xml:"xmlns:itunes,attr"`
+	PodcastNS      string             `xml:"xmlns:podcast,attr"`
+	Lang           string             `xml:"xml:lang,attr,omitempty"`
+	ID             string             `xml:"id"`
+	Title          string             `xml:"title"`
+	Subtitle       string             `xml:"subtitle,omitempty"`
+	Updated        string             `xml:"updated"`
+	Links          []atomLink         `xml:"link"`
+	Authors        []atomPerson       `xml:"author"`
+	Categories     []atomCategory     `xml:"category"`
+	Generator      string             `xml:"generator"`
+	Logo           string             `xml:"logo,omitempty"`
+	Rights         string             `xml:"rights,omitempty"`
+	ITunesImage    *rssITunesImage    `xml:"itunes:image"`
+	ITunesExplicit string             `xml:"itunes:explicit,omitempty"`
+	ITunesType     string             `xml:"itunes:type,omitempty"`
+	PodcastGUID    string             `xml:"podcast:guid,omitempty"`
+	PodcastLocked  *rssPodcastLocked  `xml:"podcast:locked"`
+	PodcastMedium  string             `xml:"podcast:medium,omitempty"`
+	PodcastPersons []rssPersonElement `xml:"podcast:person"`
+	Entries        []atomEntry        `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID                 string                 `xml:"id"`
+	Title              string                 `xml:"title"`
+	Updated            string                 `xml:"updated"`
+	Published          string                 `xml:"published,omitempty"`
+	Authors            []atomPerson           `xml:"author"`
+	Summary            string                 `xml:"summary,omitempty"`
+	Links              []atomLink             `xml:"link"`
+	ITunesDuration     string                 `xml:"itunes:duration,omitempty"`
+	ITunesImage        *rssITunesImage        `xml:"itunes:image"`
+	ITunesEpisode      *int                   `xml:"itunes:episode,omitempty"`
+	ITunesSeason       *int                   `xml:"itunes:season,omitempty"`
+	ITunesEpisodeType  string                 `xml:"itunes:episodeType,omitempty"`
+	ITunesExplicit     string                 `xml:"itunes:explicit,omitempty"`
+	PodcastChapters    *rssPodcastChapters    `xml:"podcast:chapters"`
+	PodcastTranscripts []rssPodcastTranscript `xml:"podcast:transcript"`
+	PodcastSeason      *int                   `xml:"podcast:season,omitempty"`
+	PodcastEpisode     *int                   `xml:"podcast:episode,omitempty"`
+	PodcastPersons     []rssPersonElement     `xml:"podcast:person"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Title  string `xml:"title,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
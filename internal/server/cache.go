@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GenerationSource is implemented by episode providers that number the
+// revisions of their episode list. Rendered feeds and episode lists are then
+// cached per generation, so polling clients are answered without rebuilding
+// anything until the library changes.
+type GenerationSource interface {
+	Generation() uint64
+}
+
+// maxCachedDocuments bounds the documents kept for one version. Every
+// format, token and host combination renders its own copy.
+const maxCachedDocuments = 64
+
+// documentCacheControl keeps token-bearing documents out of shared caches and
+// has clients revalidate them, which the ETag makes cheap.
+const documentCacheControl = "private, no-cache"
+
+// renderedDocument is a response body with its validators.
+type renderedDocument struct {
+	body    []byte
+	etag    string
+	modTime time.Time
+}
+
+func newRenderedDocument(body []byte, modTime time.Time) *renderedDocument {
+	sum := sha256.Sum256(body)
+	return &renderedDocument{
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		modTime: modTime,
+	}
+}
+
+// cacheVersion identifies what cached documents were rendered from: a
+// library generation and, for feeds with signed URLs, the signing epoch.
+type cacheVersion struct {
+	generation uint64
+	epoch      string
+}
+
+// documentCache holds the documents rendered for the current version.
+// Moving to a new library generation or signing epoch drops them all.
+type documentCache struct {
+	mu      sync.Mutex
+	version cacheVersion
+	// modTime is when the current version was first seen, which serves as
+	// Last-Modified for every document rendered from it.
+	modTime time.Time
+	entries map[string]*renderedDocument
+}
+
+// get returns the document stored under key for version, calling render to
+// produce it on a miss. Rendering happens outside the lock so concurrent
+// requests for other documents are not held up.
+func (c *documentCache) get(version cacheVersion, key string, render func() ([]byte, error)) (*renderedDocument, error) {
+	c.mu.Lock()
+	if c.entries == nil || version != c.version {
+		c.version = version
+		// Last-Modified must advance with every version, even within the
+		// second, or If-Modified-Since would keep stale signed URLs alive.
+		modTime := time.Now().UTC().Truncate(time.Second)
+		if !modTime.After(c.modTime) {
+			modTime = c.modTime.Add(time.Second)
+		}
+		c.modTime = modTime
+		c.entries = make(map[string]*renderedDocument)
+	}
+	if doc, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		return doc, nil
+	}
+	modTime := c.modTime
+	c.mu.Unlock()
+
+	body, err := render()
+	if err != nil {
+		return nil, err
+	}
+	doc := newRenderedDocument(body, modTime)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version == c.version {
+		if len(c.entries) >= maxCachedDocuments {
+			c.entries = make(map[string]*renderedDocument)
+		}
+		c.entries[key] = doc
+	}
+	return doc, nil
+}
+
+// renderDocument returns the document for key, from the cache when the
+// episode provider reports generations. Other providers render on every
+// request; their documents still carry an ETag but no Last-Modified. Cached
+// documents are dropped when the signing epoch moves on, since feeds from an
+// earlier epoch carry URLs that expire sooner.
+func (h *serverHandler) renderDocument(key string, render func() ([]byte, error)) (*renderedDocument, error) {
+	source, ok := h.lib.(GenerationSource)
+	if !ok {
+		body, err := render()
+		if err != nil {
+			return nil, err
+		}
+		return newRenderedDocument(body, time.Time{}), nil
+	}
+	return h.documents.get(cacheVersion{generation: source.Generation(), epoch: h.signingEpoch()}, key, render)
+}
+
+// serveDocument writes doc, answering If-None-Match and If-Modified-Since
+// with 304 Not Modified.
+func serveDocument(w http.ResponseWriter, r *http.Request, contentType string, doc *renderedDocument) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", documentCacheControl)
+	w.Header().Set("ETag", doc.etag)
+	http.ServeContent(w, r, "", doc.modTime, bytes.NewReader(doc.body))
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+type fakeGenerationLibrary struct {
+	episodes   []models.Episode
+	generation uint64
+	lists      int
+}
+
+func (f *fakeGenerationLibrary) ListEpisodes() []models.Episode {
+	f.lists++
+	return f.episodes
+}
+
+func (f *fakeGenerationLibrary) Generation() uint64 {
+	return f.generation
+}
+
+func TestFeedConditionalRequests(t *testing.T) {
+	lib := &fakeGenerationLibrary{
+		generation: 1,
+		episodes: []models.Episode{
+			{ID: "one.mp3", RelativePath: "one.mp3", Filename: "one.mp3", Title: "One", ModifiedAt: time.Unix(1700000000, 0)},
+		},
+	}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}, "other": {}}}
+	handler := New(lib, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "feed.example"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/feed?token=secret", nil)
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("expected 200 with validators, got %d etag %q last-modified %q", first.Code, etag, lastModified)
+	}
+	if cc := first.Header().Get("Cache-Control"); cc != documentCacheControl {
+		t.Fatalf("unexpected Cache-Control %q", cc)
+	}
+
+	second := get("/feed?token=secret", nil)
+	if second.Header().Get("ETag") != etag || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected identical cached feed")
+	}
+	if lib.lists != 1 {
+		t.Fatalf("expected the feed to be rendered once, listed episodes %d times", lib.lists)
+	}
+
+	notModified := get("/feed?token=secret", http.Header{"If-None-Match": {etag}})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Fatalf("expected 304 for matching ETag, got %d with %d bytes", notModified.Code, notModified.Body.Len())
+	}
+	if notModified.Header().Get("ETag") != etag {
+		t.Fatalf("expected ETag on 304 response")
+	}
+	if rec := get("/feed?token=secret", http.Header{"If-Modified-Since": {lastModified}}); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for If-Modified-Since, got %d", rec.Code)
+	}
+	if rec := get("/feed?token=secret", http.Header{"If-None-Match": {`"stale"`}, "If-Modified-Since": {lastModified}}); rec.Code != http.StatusOK {
+		t.Fatalf("expected If-None-Match to take precedence, got %d", rec.Code)
+	}
+
+	other := get("/feed?token=other", http.Header{"If-None-Match": {etag}})
+	if other.Code != http.StatusOK || other.Header().Get("ETag") == etag {
+		t.Fatalf("expected a separate document per token, got %d", other.Code)
+	}
+	if atom := get("/feed.atom?token=secret", http.Header{"If-None-Match": {etag}}); atom.Code != http.StatusOK {
+		t.Fatalf("expected a separate document per format, got %d", atom.Code)
+	}
+	if lib.lists != 3 {
+		t.Fatalf("expected one render per token and format, listed episodes %d times", lib.lists)
+	}
+
+	lib.generation++
+	lib.episodes = append(lib.episodes, models.Episode{ID: "two.mp3", RelativePath: "two.mp3", Filename: "two.mp3", Title: "Two", ModifiedAt: time.Unix(1700000100, 0)})
+	changed := get("/feed?token=secret", http.Header{"If-None-Match": {etag}})
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Fatalf("expected a fresh feed after the library changed, got %d", changed.Code)
+	}
+	if lib.lists != 4 {
+		t.Fatalf("expected the cache to be invalidated, listed episodes %d times", lib.lists)
+	}
+}
+
+func TestEpisodesConditionalRequests(t *testing.T) {
+	lib := &fakeGenerationLibrary{generation: 7, episodes: []models.Episode{{ID: "one.mp3", RelativePath: "one.mp3", Title: "One"}}}
+	handler := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/episodes", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/episodes", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/episodes", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+		t.Fatalf("unexpected HEAD response %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+	if lib.lists != 1 {
+		t.Fatalf("expected episodes to be encoded once, listed %d times", lib.lists)
+	}
+}
+
+func TestConditionalRequestsWithoutGenerations(t *testing.T) {
+	handler := New(&fakeLibrary{episodes: []models.Episode{{ID: "one.mp3", RelativePath: "one.mp3"}}}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") != "" {
+		t.Fatalf("expected a content ETag and no Last-Modified, got %v", rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
+
+func TestDocumentCacheFollowsSigningEpoch(t *testing.T) {
+	var cache documentCache
+	renders := 0
+	render := func() ([]byte, error) {
+		renders++
+		return []byte(strconv.Itoa(renders)), nil
+	}
+
+	first, _ := cache.get(cacheVersion{generation: 1, epoch: "100"}, "feed", render)
+	if again, _ := cache.get(cacheVersion{generation: 1, epoch: "100"}, "feed", render); again != first || renders != 1 {
+		t.Fatalf("expected the document to be cached within an epoch, rendered %d times", renders)
+	}
+	cache.get(cacheVersion{generation: 1, epoch: "100"}, "other", render)
+
+	next, _ := cache.get(cacheVersion{generation: 1, epoch: "200"}, "feed", render)
+	if next == first || renders != 3 {
+		t.Fatalf("expected a new epoch to render the document again, rendered %d times", renders)
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("expected documents from the earlier epoch to be dropped, got %d", len(cache.entries))
+	}
+	if !next.modTime.After(first.modTime) {
+		t.Fatalf("expected Last-Modified to advance with the epoch, got %v then %v", first.modTime, next.modTime)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Header.Set("If-Modified-Since", first.modTime.Format(http.TimeFormat))
+	rec := httptest.NewRecorder()
+	serveDocument(rec, req, "application/rss+xml", next)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a client holding the earlier epoch's feed to get the new one, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	pathpkg "path"
+	"strings"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/models"
+)
+
+// chaptersContentType is the media type of Podcasting 2.0 JSON chapters.
+const chaptersContentType = "application/json+chapters"
+
+// chaptersVersion is the Podcasting 2.0 JSON chapters format version served.
+const chaptersVersion = "1.2.0"
+
+type chaptersDocument struct {
+	Version  string         `json:"version"`
+	Chapters []chapterEntry `json:"chapters"`
+}
+
+type chapterEntry struct {
+	StartTime float64  `json:"startTime"`
+	EndTime   *float64 `json:"endTime,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Img       string   `json:"img,omitempty"`
+}
+
+// handleChapters serves the chapters of one episode at
+// /chapters/<relative path>.json.
+func (h *serverHandler) handleChapters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireLinkedAccess(w, r, auth.ScopeRead) {
+		return
+	}
+
+	rel := strings.TrimPrefix(r.URL.Path, "/chapters/")
+	rel, ok := strings.CutSuffix(rel, ".json")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	rel = strings.TrimPrefix(pathpkg.Clean("/"+rel), "/")
+
+	episode, ok := h.episodeIndex().lookup(rel)
+	if !ok || len(episode.Chapters) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	doc := chaptersDocument{Version: chaptersVersion, Chapters: make([]chapterEntry, 0, len(episode.Chapters))}
+	for _, chapter := range episode.Chapters {
+		doc.Chapters = append(doc.Chapters, chapterEntry{
+			StartTime: chapter.StartSeconds,
+			EndTime:   chapter.EndSeconds,
+			Title:     chapter.Title,
+			URL:       chapter.URL,
+			Img:       chapter.Image,
+		})
+	}
+
+	w.Header().Set("Content-Type", chaptersContentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		h.logger.Printf("failed to encode chapters for %s: %v", rel, err)
+	}
+}
+
+// episodeChaptersURL returns the URL of an episode's chapters document, or an
+// empty string when it has no chapters.
+func episodeChaptersURL(ep models.Episode, resourceURL func(path string) string) string {
+	if len(ep.Chapters) == 0 {
+		return ""
+	}
+	return resourceURL(pathpkg.Join("/chapters", ep.RelativePath) + ".json")
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestChaptersEndpointAndFeedLink(t *testing.T) {
+	end := 30.0
+	episodes := []models.Episode{
+		{
+			ID: "shows/talk.mp3", RelativePath: "shows/talk.mp3", Filename: "talk.mp3", ModifiedAt: time.Unix(1700000000, 0),
+			Chapters: []models.Chapter{
+				{StartSeconds: 0, EndSeconds: &end, Title: "Intro"},
+				{StartSeconds: 30, Title: "Main", URL: "https://example.com", Image: "https://example.com/main.png"},
+			},
+		},
+		{ID: "plain.mp3", RelativePath: "plain.mp3", Filename: "plain.mp3", ModifiedAt: time.Unix(1600000000, 0)},
+	}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/chapters/shows/talk.mp3.json", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/chapters/shows/talk.mp3.json?token=secret", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != chaptersContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var doc struct {
+		Version  string `json:"version"`
+		Chapters []struct {
+			StartTime float64  `json:"startTime"`
+			EndTime   *float64 `json:"endTime"`
+			Title     string   `json:"title"`
+			URL       string   `json:"url"`
+			Img       string   `json:"img"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode chapters: %v", err)
+	}
+	if doc.Version != "1.2.0" || len(doc.Chapters) != 2 {
+		t.Fatalf("unexpected chapters document %+v", doc)
+	}
+	if c := doc.Chapters[0]; c.StartTime != 0 || c.EndTime == nil || *c.EndTime != 30 || c.Title != "Intro" {
+		t.Fatalf("unexpected first chapter %+v", c)
+	}
+	if c := doc.Chapters[1]; c.StartTime != 30 || c.EndTime != nil || c.URL != "https://example.com" || c.Img != "https://example.com/main.png" {
+		t.Fatalf("unexpected second chapter %+v", c)
+	}
+
+	for _, path := range []string{"/chapters/plain.mp3.json", "/chapters/missing.mp3.json", "/chapters/shows/talk.mp3"} {
+		req = httptest.NewRequest(http.MethodGet, path+"?token=secret", nil)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, rec.Code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed?token=secret", nil)
+	req.Host = "feed.example"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var payload struct {
+		Channel struct {
+			Items []struct {
+				Chapters *struct {
+					URL  string `xml:"url,attr"`
+					Type string `xml:"type,attr"`
+				} `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+	items := payload.Channel.Items
+	if len(items) != 2 || items[0].Chapters == nil || items[1].Chapters != nil {
+		t.Fatalf("unexpected chapters links %+v", items)
+	}
+	if want := "https://feed.example/chapters/shows/talk.mp3.json?token=secret"; items[0].Chapters.URL != want || items[0].Chapters.Type != chaptersContentType {
+		t.Fatalf("unexpected chapters link %+v", items[0].Chapters)
+	}
+}
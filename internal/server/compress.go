@@ -0,0 +1,204 @@
+package server
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// uncompressedPrefixes lists the paths whose responses are never
+// compressed: audio and artwork are already compressed and served with range
+// support, and the event stream must reach clients as soon as it is flushed.
+var uncompressedPrefixes = []string{"/audio/", "/artwork/", "/events"}
+
+// minCompressSize is the smallest response worth compressing when its length
+// is known up front.
+const minCompressSize = 1024
+
+// gzipETagSuffix marks the ETag of a gzip-encoded representation, which must
+// differ from the identity representation's.
+const gzipETagSuffix = "-gzip"
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return gz
+	},
+}
+
+// compressResponses gzip-encodes text responses for clients that accept it.
+// Handlers keep producing identity responses and ETags: the gzip variant's
+// ETag gets a suffix on the way out, which is stripped from If-None-Match on
+// the way in so conditional requests keep matching.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range uncompressedPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w}
+		if match := r.Header.Get("If-None-Match"); strings.Contains(match, gzipETagSuffix+`"`) {
+			r = r.Clone(r.Context())
+			r.Header.Set("If-None-Match", strings.ReplaceAll(match, gzipETagSuffix+`"`, `"`))
+			cw.strippedETag = true
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides at WriteHeader time whether the response is worth
+// compressing and, if so, routes the body through a pooled gzip writer.
+type compressWriter struct {
+	http.ResponseWriter
+	gz           *gzip.Writer
+	wroteHeader  bool
+	strippedETag bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	switch {
+	case code == http.StatusNotModified && w.strippedETag:
+		// The client holds the gzip variant; confirm it under its own ETag.
+		if etag := header.Get("ETag"); etag != "" {
+			header.Set("ETag", gzipETag(etag))
+		}
+	case code == http.StatusOK && w.compressible(header):
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		header.Set("Content-Encoding", "gzip")
+		if etag := header.Get("ETag"); etag != "" {
+			header.Set("ETag", gzipETag(etag))
+		}
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush pushes buffered compressed data to the client.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < minCompressSize {
+		return false
+	}
+	return compressibleType(header.Get("Content-Type"))
+}
+
+func (w *compressWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	_ = w.gz.Close()
+	w.gz.Reset(nil)
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+}
+
+// compressibleType reports whether a response of contentType is text that
+// gzip shrinks noticeably.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasPrefix(mediaType, "application/json"):
+		return true
+	}
+	switch mediaType {
+	case "application/xml", "application/javascript", "application/x-subrip":
+		return true
+	}
+	return false
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip. An
+// explicit gzip entry wins over the * wildcard.
+func acceptsGzip(acceptEncoding string) bool {
+	accepted, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					parsed = 0
+				}
+				quality = parsed
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			accepted = max(accepted, quality)
+		case "*":
+			wildcard = max(wildcard, quality)
+		}
+	}
+	if accepted >= 0 {
+		return accepted > 0
+	}
+	return wildcard > 0
+}
+
+// gzipETag derives the ETag of the gzip representation from a strong ETag.
+// Weak ETags already allow for encoding differences and are kept as they are.
+func gzipETag(etag string) string {
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 2 {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + gzipETagSuffix + `"`
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestFeedCompression(t *testing.T) {
+	lib := &fakeGenerationLibrary{generation: 1}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("episode-%02d.mp3", i)
+		lib.episodes = append(lib.episodes, models.Episode{ID: name, RelativePath: name, Filename: name, Title: name, ModifiedAt: time.Unix(1700000000+int64(i), 0)})
+	}
+	var logs bytes.Buffer
+	handler := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(&logs, "", 0))
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		req.Host = "feed.example"
+		req.Header = header
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plain := get(http.Header{})
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected identity response without Accept-Encoding")
+	}
+	if !slices.Contains(plain.Header().Values("Vary"), "Accept-Encoding") {
+		t.Fatalf("expected Vary: Accept-Encoding, got %v", plain.Header().Values("Vary"))
+	}
+
+	logs.Reset()
+	compressed := get(http.Header{"Accept-Encoding": {"br;q=1.0, gzip;q=0.8, *;q=0.1"}})
+	if compressed.Code != http.StatusOK || compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got %d %v", compressed.Code, compressed.Header())
+	}
+	if compressed.Header().Get("Content-Length") != "" || compressed.Header().Get("Accept-Ranges") != "" {
+		t.Fatalf("expected identity length and ranges to be dropped, got %v", compressed.Header())
+	}
+	etag := compressed.Header().Get("ETag")
+	if want := strings.TrimSuffix(plain.Header().Get("ETag"), `"`) + `-gzip"`; etag != want {
+		t.Fatalf("expected gzip ETag %q, got %q", want, etag)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Fatalf("decompressed feed differs from identity feed")
+	}
+	if compressed.Body.Len() >= len(body) {
+		t.Fatalf("expected compression to shrink the feed: %d >= %d", compressed.Body.Len(), len(body))
+	}
+	if want := fmt.Sprintf("(%dB)", compressed.Body.Len()); !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected request log to report compressed size %s, got %q", want, logs.String())
+	}
+
+	notModified := get(http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {etag}})
+	if notModified.Code != http.StatusNotModified || notModified.Header().Get("ETag") != etag || notModified.Body.Len() != 0 {
+		t.Fatalf("expected 304 for gzip ETag, got %d %v", notModified.Code, notModified.Header())
+	}
+
+	if rec := get(http.Header{"Accept-Encoding": {"gzip;q=0, deflate"}}); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected gzip;q=0 to disable compression")
+	}
+}
+
+func TestCompressionSkipsAudio(t *testing.T) {
+	audioDir := t.TempDir()
+	content := bytes.Repeat([]byte("ID3 frame padding "), 200)
+	if err := os.WriteFile(filepath.Join(audioDir, "clip.mp3"), content, 0o644); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	handler := New(&fakeLibrary{}, nil, audioDir, nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/audio/clip.mp3", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-9")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected uncompressed partial content, got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Body.String() != string(content[:10]) {
+		t.Fatalf("unexpected range body %q", rec.Body.String())
+	}
+	if slices.Contains(rec.Header().Values("Vary"), "Accept-Encoding") {
+		t.Fatalf("expected no Vary: Accept-Encoding on audio")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"GZIP, deflate":       true,
+		"x-gzip":              true,
+		"deflate, br":         false,
+		"gzip;q=0":            false,
+		"*":                   true,
+		"*;q=0":               false,
+		"gzip;q=0, *":         false,
+		"identity, *;q=0.5":   true,
+		"br, gzip; q=0.001":   true,
+		"gzip;q=bogus, *;q=1": false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestCompressibleType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"application/rss+xml; charset=utf-8":   true,
+		"application/feed+json; charset=utf-8": true,
+		"application/json":                     true,
+		"application/json+chapters":            true,
+		"text/vtt; charset=utf-8":              true,
+		"text/event-stream":                    false,
+		"audio/mpeg":                           false,
+		"image/jpeg":                           false,
+		"":                                     false,
+	} {
+		if got := compressibleType(contentType); got != want {
+			t.Errorf("compressibleType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package server
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	pathpkg "path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"home-podcast/internal/models"
+)
+
+// episodeResource is the JSON form of an episode served by /episodes. URLs
+// lists where the episode and everything belonging to it can be fetched.
+type episodeResource struct {
+	models.Episode
+	URLs episodeURLs `json:"urls"`
+}
+
+// episodeURLs holds root-relative addresses, so they neither depend on the
+// host the request used nor carry the caller's token.
+type episodeURLs struct {
+	Self        string   `json:"self"`
+	Audio       string   `json:"audio"`
+	Artwork     string   `json:"artwork,omitempty"`
+	Chapters    string   `json:"chapters,omitempty"`
+	Transcripts []string `json:"transcripts,omitempty"`
+}
+
+func newEpisodeResource(ep models.Episode) episodeResource {
+	id := episodeResourceID(ep)
+	resource := episodeResource{
+		Episode: ep,
+		URLs: episodeURLs{
+			Self:  resourcePath("/episodes/" + id),
+			Audio: resourcePath(pathpkg.Join("/audio", ep.RelativePath)),
+		},
+	}
+	resource.ID = id
+	if ep.ArtworkID != "" {
+		resource.URLs.Artwork = resourcePath("/artwork/" + ep.ArtworkID)
+	}
+	if len(ep.Chapters) > 0 {
+		resource.URLs.Chapters = resourcePath(pathpkg.Join("/chapters", ep.RelativePath) + ".json")
+	}
+	for _, transcript := range ep.Transcripts {
+		resource.URLs.Transcripts = append(resource.URLs.Transcripts, resourcePath(pathpkg.Join("/transcripts", transcript.Path)))
+	}
+	return resource
+}
+
+// episodeResourceID is the id /episodes reports and /episodes/<id> accepts:
+// the episode's GUID in unpadded base64url. It follows the GUID across
+// renames and survives slashes and any characters a path-based GUID holds.
+func episodeResourceID(ep models.Episode) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(episodeGUID(ep)))
+}
+
+// resourcePath escapes a root-relative path for use as a URL.
+func resourcePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// episodeQuery is the parsed form of the /episodes query parameters. The
+// zero value matches every episode in library order.
+type episodeQuery struct {
+	terms       []string
+	dir         string
+	extensions  []string
+	from, to    time.Time
+	minDuration *float64
+	maxDuration *float64
+	sort        string
+	descending  bool
+	limit       int
+	cursor      *episodeCursor
+}
+
+// defaultEpisodeSort keeps the order /episodes has always used.
+const defaultEpisodeSort = "relative_path"
+
+// episodeSortKeys maps the sortable fields, named as in the JSON output, to
+// their sort keys. Text fields compare without regard to case, except the
+// relative path, which keeps the library's own order.
+var episodeSortKeys = map[string]func(models.Episode) sortKey{
+	"id":               func(ep models.Episode) sortKey { return sortKey{Set: true, Str: episodeResourceID(ep)} },
+	"guid":             func(ep models.Episode) sortKey { return stringKey(ep.GUID) },
+	"filename":         func(ep models.Episode) sortKey { return stringKey(ep.Filename) },
+	"relative_path":    func(ep models.Episode) sortKey { return sortKey{Set: true, Str: ep.RelativePath} },
+	"title":            func(ep models.Episode) sortKey { return stringKey(ep.Title) },
+	"artist":           func(ep models.Episode) sortKey { return optionalStringKey(ep.Artist) },
+	"album":            func(ep models.Episode) sortKey { return optionalStringKey(ep.Album) },
+	"codec":            func(ep models.Episode) sortKey { return stringKey(ep.Codec) },
+	"episode_type":     func(ep models.Episode) sortKey { return stringKey(ep.EpisodeType) },
+	"duration_seconds": func(ep models.Episode) sortKey { return optionalNumberKey(ep.DurationSeconds) },
+	"bitrate_kbps":     func(ep models.Episode) sortKey { return optionalIntKey(ep.BitrateKbps) },
+	"sample_rate_hz":   func(ep models.Episode) sortKey { return optionalIntKey(ep.SampleRateHz) },
+	"channels":         func(ep models.Episode) sortKey { return optionalIntKey(ep.Channels) },
+	"season":           func(ep models.Episode) sortKey { return optionalIntKey(ep.Season) },
+	"episode_number":   func(ep models.Episode) sortKey { return optionalIntKey(ep.EpisodeNumber) },
+	"filesize_bytes":   func(ep models.Episode) sortKey { return sortKey{Set: true, Num: float64(ep.FilesizeBytes)} },
+	"modified_at":      func(ep models.Episode) sortKey { return timeKey(ep.ModifiedAt) },
+	"published_at":     func(ep models.Episode) sortKey { return timeKey(episodePublished(ep)) },
+}
+
+// sortKey is the value an episode is ordered by. Episodes lacking the field
+// sort after all others in either direction.
+type sortKey struct {
+	Set bool    `json:"s,omitempty"`
+	Num float64 `json:"n,omitempty"`
+	Str string  `json:"t,omitempty"`
+}
+
+func stringKey(s string) sortKey {
+	return sortKey{Set: s != "", Str: strings.ToLower(s)}
+}
+
+func optionalStringKey(s *string) sortKey {
+	if s == nil {
+		return sortKey{}
+	}
+	return stringKey(*s)
+}
+
+func optionalIntKey(n *int) sortKey {
+	if n == nil {
+		return sortKey{}
+	}
+	return sortKey{Set: true, Num: float64(*n)}
+}
+
+func optionalNumberKey(n *float64) sortKey {
+	if n == nil {
+		return sortKey{}
+	}
+	return sortKey{Set: true, Num: *n}
+}
+
+func timeKey(t time.Time) sortKey {
+	if t.IsZero() {
+		return sortKey{}
+	}
+	return sortKey{Set: true, Num: float64(t.UnixMilli())}
+}
+
+func compareSortKeys(a, b sortKey, descending bool) int {
+	switch {
+	case a.Set != b.Set:
+		if a.Set {
+			return -1
+		}
+		return 1
+	case !a.Set:
+		return 0
+	}
+	c := cmp.Compare(a.Num, b.Num)
+	if c == 0 {
+		c = strings.Compare(a.Str, b.Str)
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// episodeCursor marks the last episode of a page. It carries the sort key
+// rather than a position so pages stay consistent while the library changes.
+type episodeCursor struct {
+	Sort       string  `json:"f"`
+	Descending bool    `json:"d,omitempty"`
+	Key        sortKey `json:"k"`
+	Path       string  `json:"p"`
+}
+
+func (c episodeCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeEpisodeCursor(value string) (*episodeCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor episodeCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// parseEpisodeQuery reads the search, filter, sort and paging parameters of
+// /episodes.
+func parseEpisodeQuery(query url.Values) (episodeQuery, error) {
+	q := episodeQuery{
+		terms: searchTerms(query.Get("q")),
+		sort:  defaultEpisodeSort,
+	}
+
+	if dir := strings.Trim(query.Get("dir"), "/"); dir != "" {
+		q.dir = pathpkg.Clean(dir)
+	}
+	for _, value := range query["ext"] {
+		for _, ext := range strings.Split(value, ",") {
+			if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+				q.extensions = append(q.extensions, ext)
+			}
+		}
+	}
+
+	var err error
+	if q.from, err = parseQueryTime(query.Get("from"), false); err != nil {
+		return episodeQuery{}, fmt.Errorf("invalid from: %w", err)
+	}
+	if q.to, err = parseQueryTime(query.Get("to"), true); err != nil {
+		return episodeQuery{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if q.minDuration, err = parseQueryDuration(query.Get("min_duration")); err != nil {
+		return episodeQuery{}, fmt.Errorf("invalid min_duration: %w", err)
+	}
+	if q.maxDuration, err = parseQueryDuration(query.Get("max_duration")); err != nil {
+		return episodeQuery{}, fmt.Errorf("invalid max_duration: %w", err)
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if _, ok := episodeSortKeys[value]; !ok {
+			return episodeQuery{}, fmt.Errorf("unknown sort field %q", value)
+		}
+		q.sort = value
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.descending = true
+	default:
+		return episodeQuery{}, fmt.Errorf("invalid order %q", order)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return episodeQuery{}, fmt.Errorf("invalid limit %q", value)
+		}
+		q.limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeEpisodeCursor(value)
+		if err != nil {
+			return episodeQuery{}, errors.New("invalid cursor")
+		}
+		if cursor.Sort != q.sort || cursor.Descending != q.descending {
+			return episodeQuery{}, errors.New("cursor belongs to a different sort order")
+		}
+		q.cursor = cursor
+	}
+
+	return q, nil
+}
+
+// parseQueryTime accepts RFC 3339 timestamps and plain dates. A plain date
+// used as an upper bound includes the whole day.
+func parseQueryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an RFC 3339 time", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func parseQueryDuration(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return nil, fmt.Errorf("%q is not a number of seconds", value)
+	}
+	return &seconds, nil
+}
+
+// matches reports whether ep passes every filter besides the text search,
+// which the index answers.
+func (q episodeQuery) matches(ep models.Episode) bool {
+	if q.dir != "" && !strings.HasPrefix(ep.RelativePath, q.dir+"/") {
+		return false
+	}
+	if len(q.extensions) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(pathpkg.Ext(ep.Filename), "."))
+		if !slices.Contains(q.extensions, ext) {
+			return false
+		}
+	}
+	if !q.from.IsZero() || !q.to.IsZero() {
+		published := episodePublished(ep)
+		if !q.from.IsZero() && published.Before(q.from) {
+			return false
+		}
+		if !q.to.IsZero() && published.After(q.to) {
+			return false
+		}
+	}
+	if q.minDuration != nil || q.maxDuration != nil {
+		if ep.DurationSeconds == nil {
+			return false
+		}
+		if q.minDuration != nil && *ep.DurationSeconds < *q.minDuration {
+			return false
+		}
+		if q.maxDuration != nil && *ep.DurationSeconds > *q.maxDuration {
+			return false
+		}
+	}
+	return true
+}
+
+// episodeResult is one page of matching episodes.
+type episodeResult struct {
+	episodes []episodeResource
+	total    int
+	next     string
+}
+
+// episodeIndex is an inverted index over the title, artist, album and
+// filename of one library snapshot. Search terms match words by prefix, and
+// every term must match.
+type episodeIndex struct {
+	generation uint64
+	episodes   []models.Episode
+	byPath     map[string]int
+	byID       map[string]int
+	// transcripts maps the relative path of every listed transcript to it.
+	transcripts map[string]models.Transcript
+	words       []string
+	postings    map[string][]int
+}
+
+func newEpisodeIndex(generation uint64, episodes []models.Episode) *episodeIndex {
+	idx := &episodeIndex{
+		generation:  generation,
+		episodes:    episodes,
+		byPath:      make(map[string]int, len(episodes)),
+		byID:        make(map[string]int, len(episodes)),
+		transcripts: make(map[string]models.Transcript),
+		postings:    make(map[string][]int),
+	}
+	for i, ep := range episodes {
+		idx.byPath[ep.RelativePath] = i
+		idx.byID[episodeResourceID(ep)] = i
+		for _, transcript := range ep.Transcripts {
+			if _, ok := idx.transcripts[transcript.Path]; !ok {
+				idx.transcripts[transcript.Path] = transcript
+			}
+		}
+		fields := []string{ep.Title, ep.Filename}
+		if ep.Artist != nil {
+			fields = append(fields, *ep.Artist)
+		}
+		if ep.Album != nil {
+			fields = append(fields, *ep.Album)
+		}
+		for _, word := range searchTerms(strings.Join(fields, " ")) {
+			postings := idx.postings[word]
+			if len(postings) > 0 && postings[len(postings)-1] == i {
+				continue
+			}
+			idx.postings[word] = append(postings, i)
+		}
+	}
+	for word := range idx.postings {
+		idx.words = append(idx.words, word)
+	}
+	sort.Strings(idx.words)
+	return idx
+}
+
+// lookup returns the episode stored at the relative path rel.
+func (idx *episodeIndex) lookup(rel string) (models.Episode, bool) {
+	i, ok := idx.byPath[rel]
+	if !ok {
+		return models.Episode{}, false
+	}
+	return idx.episodes[i], true
+}
+
+// lookupID returns the episode whose episodeResourceID is id.
+func (idx *episodeIndex) lookupID(id string) (models.Episode, bool) {
+	i, ok := idx.byID[id]
+	if !ok {
+		return models.Episode{}, false
+	}
+	return idx.episodes[i], true
+}
+
+// lookupTranscript returns the transcript listed at the relative path rel.
+func (idx *episodeIndex) lookupTranscript(rel string) (models.Transcript, bool) {
+	transcript, ok := idx.transcripts[rel]
+	return transcript, ok
+}
+
+// searchTerms splits text into lower-case words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// search returns the positions of the episodes matching every term, in
+// ascending order. No terms match everything.
+func (idx *episodeIndex) search(terms []string) []int {
+	if len(terms) == 0 {
+		all := make([]int, len(idx.episodes))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	var result []int
+	for n, term := range terms {
+		var hits []int
+		for i := sort.SearchStrings(idx.words, term); i < len(idx.words) && strings.HasPrefix(idx.words[i], term); i++ {
+			hits = append(hits, idx.postings[idx.words[i]]...)
+		}
+		slices.Sort(hits)
+		hits = slices.Compact(hits)
+		if n == 0 {
+			result = hits
+		} else {
+			result = intersectSorted(result, hits)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+func intersectSorted(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// query applies q to the indexed episodes.
+func (idx *episodeIndex) query(q episodeQuery) episodeResult {
+	keyOf := episodeSortKeys[q.sort]
+
+	type candidate struct {
+		ep  models.Episode
+		key sortKey
+	}
+	var candidates []candidate
+	for _, i := range idx.search(q.terms) {
+		if ep := idx.episodes[i]; q.matches(ep) {
+			candidates = append(candidates, candidate{ep: ep, key: keyOf(ep)})
+		}
+	}
+	compare := func(key sortKey, path string, c candidate) int {
+		if n := compareSortKeys(key, c.key, q.descending); n != 0 {
+			return n
+		}
+		return strings.Compare(path, c.ep.RelativePath)
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return compare(a.key, a.ep.RelativePath, b)
+	})
+
+	result := episodeResult{total: len(candidates)}
+	if q.cursor != nil {
+		start := sort.Search(len(candidates), func(i int) bool {
+			return compare(q.cursor.Key, q.cursor.Path, candidates[i]) < 0
+		})
+		candidates = candidates[start:]
+	}
+	if q.limit > 0 && len(candidates) > q.limit {
+		candidates = candidates[:q.limit]
+		last := candidates[len(candidates)-1]
+		result.next = episodeCursor{Sort: q.sort, Descending: q.descending, Key: last.key, Path: last.ep.RelativePath}.encode()
+	}
+
+	result.episodes = make([]episodeResource, 0, len(candidates))
+	for _, c := range candidates {
+		result.episodes = append(result.episodes, newEpisodeResource(c.ep))
+	}
+	return result
+}
+
+// episodeIndexCache holds the search index of the current library
+// generation, so it is rebuilt once per library refresh rather than per
+// request.
+type episodeIndexCache struct {
+	mu    sync.Mutex
+	index *episodeIndex
+}
+
+// episodeIndex returns the search index for the current episodes. Providers
+// without generations get a fresh index on every call.
+func (h *serverHandler) episodeIndex() *episodeIndex {
+	source, ok := h.lib.(GenerationSource)
+	if !ok {
+		return newEpisodeIndex(0, h.lib.ListEpisodes())
+	}
+
+	generation := source.Generation()
+	h.index.mu.Lock()
+	defer h.index.mu.Unlock()
+	if h.index.index == nil || h.index.index.generation != generation {
+		h.index.index = newEpisodeIndex(generation, h.lib.ListEpisodes())
+	}
+	return h.index.index
+}
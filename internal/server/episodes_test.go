@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func queryEpisodesLibrary() []models.Episode {
+	artist := "Ada Lovelace"
+	album := "Engines"
+	short, long := 300.0, 3600.0
+	published := time.Date(2024, 5, 2, 18, 0, 0, 0, time.UTC)
+	return []models.Episode{
+		{ID: "news/monday.mp3", RelativePath: "news/monday.mp3", Filename: "monday.mp3", Title: "Monday Briefing", DurationSeconds: &short, FilesizeBytes: 300, ModifiedAt: time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)},
+		{ID: "news/tuesday.m4a", RelativePath: "news/tuesday.m4a", Filename: "tuesday.m4a", Title: "Tuesday Briefing", DurationSeconds: &short, FilesizeBytes: 200, ModifiedAt: time.Date(2024, 5, 7, 7, 0, 0, 0, time.UTC)},
+		{ID: "talks/engines.mp3", RelativePath: "talks/engines.mp3", Filename: "engines.mp3", Title: "Analytical Engines", Artist: &artist, Album: &album, DurationSeconds: &long, FilesizeBytes: 900, ModifiedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), PublishedAt: &published},
+		{ID: "misc.ogg", RelativePath: "misc.ogg", Filename: "misc.ogg", Title: "Odds and ends", FilesizeBytes: 100, ModifiedAt: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func getEpisodes(t *testing.T, handler http.Handler, query string) (*httptest.ResponseRecorder, []string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/episodes"+query, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec, nil
+	}
+	var episodes []models.Episode
+	if err := json.Unmarshal(rec.Body.Bytes(), &episodes); err != nil {
+		t.Fatalf("decode %s: %v", query, err)
+	}
+	paths := []string{}
+	for _, ep := range episodes {
+		paths = append(paths, ep.RelativePath)
+	}
+	return rec, paths
+}
+
+func TestEpisodesQuery(t *testing.T) {
+	handler := New(&fakeGenerationLibrary{episodes: queryEpisodesLibrary(), generation: 1}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"misc.ogg", "news/monday.mp3", "news/tuesday.m4a", "talks/engines.mp3"}},
+		{"?q=briefing", []string{"news/monday.mp3", "news/tuesday.m4a"}},
+		{"?q=BRIEF+tues", []string{"news/tuesday.m4a"}},
+		{"?q=lovelace", []string{"talks/engines.mp3"}},
+		{"?q=engines", []string{"talks/engines.mp3"}},
+		{"?q=m4a", []string{"news/tuesday.m4a"}},
+		{"?q=briefing+engines", []string{}},
+		{"?dir=news", []string{"news/monday.mp3", "news/tuesday.m4a"}},
+		{"?dir=/news/", []string{"news/monday.mp3", "news/tuesday.m4a"}},
+		{"?dir=new", []string{}},
+		{"?ext=.MP3,ogg", []string{"misc.ogg", "news/monday.mp3", "talks/engines.mp3"}},
+		{"?ext=m4a&ext=ogg", []string{"misc.ogg", "news/tuesday.m4a"}},
+		{"?from=2024-05-07", []string{"news/tuesday.m4a"}},
+		{"?to=2024-05-02", []string{"misc.ogg", "talks/engines.mp3"}},
+		{"?from=2024-05-02T19:00:00Z&to=2024-05-06T07:00:00Z", []string{"news/monday.mp3"}},
+		{"?min_duration=600", []string{"talks/engines.mp3"}},
+		{"?max_duration=600", []string{"news/monday.mp3", "news/tuesday.m4a"}},
+		{"?sort=filesize_bytes", []string{"misc.ogg", "news/tuesday.m4a", "news/monday.mp3", "talks/engines.mp3"}},
+		{"?sort=modified_at&order=desc", []string{"talks/engines.mp3", "news/tuesday.m4a", "news/monday.mp3", "misc.ogg"}},
+		{"?sort=published_at", []string{"misc.ogg", "talks/engines.mp3", "news/monday.mp3", "news/tuesday.m4a"}},
+		{"?sort=title", []string{"talks/engines.mp3", "news/monday.mp3", "misc.ogg", "news/tuesday.m4a"}},
+		{"?sort=artist&order=desc", []string{"talks/engines.mp3", "misc.ogg", "news/monday.mp3", "news/tuesday.m4a"}},
+		{"?sort=duration_seconds&order=desc&dir=news", []string{"news/monday.mp3", "news/tuesday.m4a"}},
+	}
+	for _, tc := range cases {
+		rec, ids := getEpisodes(t, handler, tc.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.query, rec.Code, rec.Body.String())
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Fatalf("%s: got %v want %v", tc.query, ids, tc.want)
+		}
+		if total := rec.Header().Get("X-Total-Count"); total != strconv.Itoa(len(tc.want)) {
+			t.Fatalf("%s: unexpected X-Total-Count %q", tc.query, total)
+		}
+	}
+
+	for _, query := range []string{"?sort=colour", "?order=up", "?limit=0", "?from=yesterday", "?min_duration=-1", "?cursor=!!", "?cursor=bm90IGpzb24"} {
+		if rec, _ := getEpisodes(t, handler, query); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestEpisodesCursorPagination(t *testing.T) {
+	lib := &fakeGenerationLibrary{episodes: queryEpisodesLibrary(), generation: 1}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(lib, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	var seen []string
+	query := "?token=secret&sort=modified_at&order=desc&limit=3"
+	for pages := 0; ; pages++ {
+		rec, ids := getEpisodes(t, handler, query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", query, rec.Code)
+		}
+		if want := strconv.Itoa(len(lib.episodes)); rec.Header().Get("X-Total-Count") != want {
+			t.Fatalf("expected total of %s matches, got %q", want, rec.Header().Get("X-Total-Count"))
+		}
+		seen = append(seen, ids...)
+		link := rec.Header().Get("Link")
+		if link == "" {
+			if rec.Header().Get("X-Next-Cursor") != "" {
+				t.Fatalf("expected no cursor on the last page")
+			}
+			break
+		}
+		if pages > 2 {
+			t.Fatalf("pagination did not terminate")
+		}
+		if !strings.HasPrefix(link, "</episodes?") || !strings.HasSuffix(link, `>; rel="next"`) || !strings.Contains(link, "token=secret") {
+			t.Fatalf("unexpected Link header %q", link)
+		}
+		if !strings.Contains(link, "cursor="+rec.Header().Get("X-Next-Cursor")) {
+			t.Fatalf("expected Link to carry X-Next-Cursor, got %q", link)
+		}
+		query = strings.TrimSuffix(strings.TrimPrefix(link, "</episodes"), `>; rel="next"`)
+
+		if pages == 0 {
+			// Episodes added after the first page must not shift the ones
+			// still to come.
+			lib.episodes = append([]models.Episode{{ID: "new.mp3", RelativePath: "new.mp3", Filename: "new.mp3", ModifiedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}, lib.episodes...)
+			lib.generation++
+		}
+	}
+	if want := []string{"talks/engines.mp3", "news/tuesday.m4a", "news/monday.mp3", "misc.ogg"}; !slices.Equal(seen, want) {
+		t.Fatalf("got %v want %v", seen, want)
+	}
+
+	rec, _ := getEpisodes(t, handler, "?token=secret&limit=1&cursor="+episodeCursor{Sort: "title", Key: sortKey{Set: true}}.encode())
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected cursor for another sort order to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestEpisodeIndexRebuildsPerGeneration(t *testing.T) {
+	lib := &fakeGenerationLibrary{episodes: queryEpisodesLibrary(), generation: 1}
+	handler := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	if _, ids := getEpisodes(t, handler, "?q=pilot"); len(ids) != 0 {
+		t.Fatalf("expected no match before the refresh, got %v", ids)
+	}
+	lib.episodes = append(lib.episodes, models.Episode{
+		ID: "pilot.mp3", RelativePath: "pilot.mp3", Filename: "pilot.mp3", Title: "Pilot",
+		Transcripts: []models.Transcript{{Path: "pilot.vtt", Type: "text/vtt"}},
+	})
+	if _, ids := getEpisodes(t, handler, "?q=pilot"); len(ids) != 0 {
+		t.Fatalf("expected the index to be reused within a generation, got %v", ids)
+	}
+	if _, ok := handler.h.episodeIndex().lookupTranscript("pilot.vtt"); ok {
+		t.Fatalf("expected the transcript to stay unknown within a generation")
+	}
+	lib.generation++
+	if _, ids := getEpisodes(t, handler, "?q=pilot"); !slices.Equal(ids, []string{"pilot.mp3"}) {
+		t.Fatalf("expected the index to be rebuilt after a refresh, got %v", ids)
+	}
+	if transcript, ok := handler.h.episodeIndex().lookupTranscript("pilot.vtt"); !ok || transcript.Type != "text/vtt" {
+		t.Fatalf("expected the rebuilt index to list the transcript, got %+v %v", transcript, ok)
+	}
+}
+
+func TestEpisodeResource(t *testing.T) {
+	episodes := []models.Episode{
+		{
+			ID: "Sendungen/Ärger & Öl?.mp3", GUID: "4f9d2c1e-8a7b-4c3d-9e2f-1a2b3c4d5e6f", RelativePath: "Sendungen/Ärger & Öl?.mp3", Filename: "Ärger & Öl?.mp3", Title: "Ärger",
+			ArtworkID: "abc123", Chapters: []models.Chapter{{Title: "Intro"}},
+			Transcripts: []models.Transcript{{Path: "Sendungen/Ärger & Öl?.vtt", Type: "text/vtt"}},
+			Persons:     []models.Person{{Name: "Grace", Role: "host"}},
+		},
+		{ID: "plain.mp3", RelativePath: "plain.mp3", Filename: "plain.mp3", Title: "Plain"},
+	}
+	lib := &fakeGenerationLibrary{episodes: episodes, generation: 1}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(lib, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header = header
+		req.Header.Set("X-Podcast-Token", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	list := get("/episodes", http.Header{})
+	var resources []episodeResource
+	if err := json.Unmarshal(list.Body.Bytes(), &resources); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	self := resources[0].URLs.Self
+	if strings.ContainsAny(strings.TrimPrefix(self, "/episodes/"), "/?%&=+") {
+		t.Fatalf("expected a URL-safe ID, got %q", self)
+	}
+	if self != "/episodes/"+resources[0].ID {
+		t.Fatalf("expected the id %q to name the self URL %q", resources[0].ID, self)
+	}
+
+	rec := get(self, http.Header{})
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("expected 200 JSON, got %d %v", rec.Code, rec.Header())
+	}
+	var resource episodeResource
+	if err := json.Unmarshal(rec.Body.Bytes(), &resource); err != nil {
+		t.Fatalf("decode episode: %v", err)
+	}
+	if resource.RelativePath != episodes[0].RelativePath || len(resource.Persons) != 1 || len(resource.Chapters) != 1 {
+		t.Fatalf("expected full episode metadata, got %+v", resource.Episode)
+	}
+	want := episodeURLs{
+		Self:        self,
+		Audio:       "/audio/Sendungen/%C3%84rger%20&%20%C3%96l%3F.mp3",
+		Artwork:     "/artwork/abc123",
+		Chapters:    "/chapters/Sendungen/%C3%84rger%20&%20%C3%96l%3F.mp3.json",
+		Transcripts: []string{"/transcripts/Sendungen/%C3%84rger%20&%20%C3%96l%3F.vtt"},
+	}
+	if resource.URLs.Self != want.Self || resource.URLs.Audio != want.Audio || resource.URLs.Artwork != want.Artwork ||
+		resource.URLs.Chapters != want.Chapters || !slices.Equal(resource.URLs.Transcripts, want.Transcripts) {
+		t.Fatalf("unexpected URLs %+v", resource.URLs)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected an ETag")
+	}
+	if rec := get(self, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	lib.episodes[0].RelativePath = "Archiv/Ärger.mp3"
+	lib.generation++
+	if rec := get(self, http.Header{}); rec.Code != http.StatusOK {
+		t.Fatalf("expected the ID to survive a rename, got %d", rec.Code)
+	}
+
+	for _, path := range []string{
+		"/episodes/" + base64.RawURLEncoding.EncodeToString([]byte("missing.mp3")),
+		"/episodes/" + base64.RawURLEncoding.EncodeToString([]byte("Sendungen/Ärger & Öl?.mp3")),
+		"/episodes/not*base64",
+		"/episodes/",
+	} {
+		if rec := get(path, http.Header{}); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, self, nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/models"
+)
+
+// ChangeSource is implemented by episode providers that can stream library
+// changes. It backs the /events endpoint.
+type ChangeSource interface {
+	Subscribe(buffer int) (uint64, <-chan models.ChangeSet)
+	Unsubscribe(id uint64)
+	ChangesSince(generation uint64) ([]models.ChangeSet, bool)
+	Generation() uint64
+}
+
+const (
+	defaultHeartbeatInterval = 15 * time.Second
+	eventSubscriberBuffer    = 32
+	eventRetryMillis         = 5000
+)
+
+func (h *serverHandler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := h.requireToken(w, r, auth.ScopeRead); !ok {
+		return
+	}
+
+	source, ok := h.lib.(ChangeSource)
+	if !ok {
+		http.Error(w, "live updates unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server-wide write timeout by design.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Printf("events: unable to clear write deadline: %v", err)
+	}
+
+	id, changes := source.Subscribe(eventSubscriberBuffer)
+	defer source.Unsubscribe(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, rc: rc, instance: h.instance}
+	stream.retry(eventRetryMillis)
+
+	last, resume, sameInstance := lastEventID(r, h.instance)
+	if resume && !sameInstance {
+		last = source.Generation()
+		stream.reset(last)
+	} else if resume {
+		sets, ok := source.ChangesSince(last)
+		if !ok {
+			last = source.Generation()
+			stream.reset(last)
+		}
+		for _, set := range sets {
+			stream.changeSet(set)
+			last = set.Generation
+		}
+	} else {
+		last = source.Generation()
+		stream.ready(last)
+	}
+
+	if err := stream.flush(); err != nil {
+		return
+	}
+
+	interval := h.heartbeat
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case set, ok := <-changes:
+			if !ok {
+				return
+			}
+			if set.Generation <= last {
+				continue
+			}
+			if set.Generation > last+1 {
+				// The subscription dropped change sets while we were slow;
+				// the client must reload rather than apply a partial diff.
+				stream.reset(set.Generation)
+			} else {
+				stream.changeSet(set)
+			}
+			last = set.Generation
+		case <-heartbeat.C:
+			stream.comment("heartbeat")
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+
+		if err := stream.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// lastEventID returns the generation a reconnecting client last saw, taken
+// from the Last-Event-ID header or the lastEventId query parameter for
+// clients that cannot set headers. Event ids are "<instance>-<generation>"
+// because generations restart with the process; the third result reports
+// whether the id was issued by this instance.
+func lastEventID(r *http.Request, instance string) (uint64, bool, bool) {
+	value := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if value == "" {
+		value = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+	}
+	if value == "" {
+		return 0, false, false
+	}
+
+	prefix, genText, found := strings.Cut(value, "-")
+	if !found {
+		return 0, true, false
+	}
+	generation, err := strconv.ParseUint(genText, 10, 64)
+	if err != nil {
+		return 0, true, false
+	}
+	return generation, true, prefix == instance
+}
+
+// eventStream writes text/event-stream frames and remembers the first error
+// so the handler can stop once the client goes away.
+type eventStream struct {
+	w        io.Writer
+	rc       *http.ResponseController
+	instance string
+	err      error
+}
+
+func (s *eventStream) retry(ms int) {
+	s.printf("retry: %d\n\n", ms)
+}
+
+func (s *eventStream) comment(text string) {
+	s.printf(": %s\n\n", text)
+}
+
+func (s *eventStream) ready(generation uint64) {
+	s.event("ready", generation, true, map[string]uint64{"generation": generation})
+}
+
+func (s *eventStream) reset(generation uint64) {
+	s.event("reset", generation, true, map[string]uint64{"generation": generation})
+}
+
+// changePayload is the JSON form of one episode change. Episodes appear as
+// /episodes lists them, so their id and urls.self name the same resource.
+type changePayload struct {
+	Generation uint64            `json:"generation"`
+	Type       models.ChangeType `json:"type"`
+	Old        *episodeResource  `json:"old,omitempty"`
+	New        *episodeResource  `json:"new,omitempty"`
+}
+
+// changeSet emits one event per episode change, named after the change type.
+// Only the final event carries the id so that a client interrupted midway
+// resumes from the previous generation and replays the whole set.
+func (s *eventStream) changeSet(set models.ChangeSet) {
+	for i, change := range set.Changes {
+		payload := changePayload{Generation: set.Generation, Type: change.Type}
+		if change.Old != nil {
+			old := newEpisodeResource(*change.Old)
+			payload.Old = &old
+		}
+		if change.New != nil {
+			next := newEpisodeResource(*change.New)
+			payload.New = &next
+		}
+		s.event(string(change.Type), set.Generation, i == len(set.Changes)-1, payload)
+	}
+}
+
+func (s *eventStream) event(name string, id uint64, withID bool, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.printf("event: %s\n", name)
+	if withID {
+		s.printf("id: %s-%d\n", s.instance, id)
+	}
+	s.printf("data: %s\n\n", data)
+}
+
+func (s *eventStream) printf(format string, args ...any) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = fmt.Fprintf(s.w, format, args...)
+}
+
+func (s *eventStream) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.err = err
+	}
+	return s.err
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+type fakeChangeLibrary struct {
+	fakeLibrary
+
+	mu         sync.Mutex
+	subs       map[uint64]chan models.ChangeSet
+	nextID     uint64
+	generation uint64
+	history    []models.ChangeSet
+}
+
+func newFakeChangeLibrary() *fakeChangeLibrary {
+	return &fakeChangeLibrary{subs: make(map[uint64]chan models.ChangeSet)}
+}
+
+func (f *fakeChangeLibrary) Subscribe(buffer int) (uint64, <-chan models.ChangeSet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	ch := make(chan models.ChangeSet, buffer)
+	f.subs[f.nextID] = ch
+	return f.nextID, ch
+}
+
+func (f *fakeChangeLibrary) Unsubscribe(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.subs[id]; ok {
+		delete(f.subs, id)
+		close(ch)
+	}
+}
+
+func (f *fakeChangeLibrary) ChangesSince(generation uint64) ([]models.ChangeSet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if generation > f.generation {
+		return nil, false
+	}
+	var sets []models.ChangeSet
+	for _, set := range f.history {
+		if set.Generation > generation {
+			sets = append(sets, set)
+		}
+	}
+	return sets, true
+}
+
+func (f *fakeChangeLibrary) Generation() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.generation
+}
+
+func (f *fakeChangeLibrary) subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs)
+}
+
+func (f *fakeChangeLibrary) emit(changes ...models.EpisodeChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.generation++
+	set := models.ChangeSet{Generation: f.generation, Changes: changes}
+	f.history = append(f.history, set)
+	for _, ch := range f.subs {
+		ch <- set
+	}
+}
+
+type sseEvent struct {
+	name string
+	id   string
+	data string
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev.name != "" || ev.data != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEventStream(t *testing.T, srv *httptest.Server, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func waitForSubscribers(t *testing.T, lib *fakeChangeLibrary, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if lib.subscribers() == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d subscribers", want)
+}
+
+func TestEventsEndpointStreamsChanges(t *testing.T) {
+	lib := newFakeChangeLibrary()
+	handler := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	_, reader := openEventStream(t, srv, "")
+	ready := readEvent(t, reader)
+	if ready.name != "ready" || !strings.HasSuffix(ready.id, "-0") {
+		t.Fatalf("expected ready event at generation 0, got %+v", ready)
+	}
+
+	waitForSubscribers(t, lib, 1)
+	added := models.Episode{ID: "new.mp3", RelativePath: "new.mp3", Title: "New"}
+	old := models.Episode{ID: "old.mp3", RelativePath: "old.mp3", Title: "Old"}
+	lib.emit(
+		models.EpisodeChange{Type: models.ChangeAdded, New: &added},
+		models.EpisodeChange{Type: models.ChangeRemoved, Old: &old},
+	)
+
+	first := readEvent(t, reader)
+	if first.name != "added" || first.id != "" || !strings.Contains(first.data, `"title":"New"`) {
+		t.Fatalf("unexpected first event %+v", first)
+	}
+	id := episodeResourceID(added)
+	if !strings.Contains(first.data, `"id":"`+id+`"`) || !strings.Contains(first.data, `"self":"/episodes/`+id+`"`) {
+		t.Fatalf("expected the /episodes id and self link in the payload, got %s", first.data)
+	}
+	second := readEvent(t, reader)
+	if second.name != "removed" || !strings.HasSuffix(second.id, "-1") {
+		t.Fatalf("expected removal event carrying the set id, got %+v", second)
+	}
+}
+
+func TestEventsEndpointResumesFromLastEventID(t *testing.T) {
+	lib := newFakeChangeLibrary()
+	h := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	first := models.Episode{ID: "a.mp3", RelativePath: "a.mp3"}
+	second := models.Episode{ID: "b.mp3", RelativePath: "b.mp3"}
+	lib.emit(models.EpisodeChange{Type: models.ChangeAdded, New: &first})
+	lib.emit(models.EpisodeChange{Type: models.ChangeAdded, New: &second})
+
+	_, reader := openEventStream(t, srv, fmt.Sprintf("%s-1", h.h.instance))
+	ev := readEvent(t, reader)
+	if ev.name != "added" || !strings.Contains(ev.data, "b.mp3") || !strings.HasSuffix(ev.id, "-2") {
+		t.Fatalf("expected replay of generation 2, got %+v", ev)
+	}
+
+	_, reader = openEventStream(t, srv, "stale-1")
+	ev = readEvent(t, reader)
+	if ev.name != "reset" || !strings.HasSuffix(ev.id, "-2") {
+		t.Fatalf("expected reset for id from another instance, got %+v", ev)
+	}
+}
+
+func TestEventsEndpointHeartbeatAndShutdown(t *testing.T) {
+	lib := newFakeChangeLibrary()
+	h := New(lib, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+	h.h.heartbeat = 10 * time.Millisecond
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	_, reader := openEventStream(t, srv, "")
+	readEvent(t, reader)
+
+	line, err := reader.ReadString('\n')
+	for err == nil && line == "\n" {
+		line, err = reader.ReadString('\n')
+	}
+	if err != nil || line != ": heartbeat\n" {
+		t.Fatalf("expected heartbeat comment, got %q (%v)", line, err)
+	}
+
+	h.Close()
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("expected stream to end cleanly, got %v", err)
+	}
+	waitForSubscribers(t, lib, 0)
+}
+
+func TestEventsEndpointRequiresTokenAndSupport(t *testing.T) {
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(newFakeChangeLibrary(), validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	handler = New(&fakeLibrary{}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+	req = httptest.NewRequest(http.MethodGet, "/events", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without change support, got %d", rec.Code)
+	}
+}
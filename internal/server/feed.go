@@ -0,0 +1,475 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+// feed is the format-neutral view of the podcast shared by the RSS, Atom and
+// JSON Feed renderers, so every format publishes the same episodes, URLs and
+// metadata.
+type feed struct {
+	Title       string
+	Description string
+	Language    string
+	Author      string
+	Copyright   string
+	// Link is the show's website; SelfURL is the address the feed was
+	// requested at.
+	Link       string
+	SelfURL    string
+	Image      string
+	Categories []FeedCategory
+	Explicit   *bool
+	OwnerName  string
+	OwnerEmail string
+	Type       string
+	GUID       string
+	Locked     *bool
+	Medium     string
+	Persons    []models.Person
+	Updated    time.Time
+	Pages      feedLinks
+	Items      []feedItem
+	// NewFeedURL is set when the subscriber's token has been replaced and
+	// the feed now lives at an address carrying the new one.
+	NewFeedURL string
+}
+
+// feedLinks are the RFC 5005 paging links of one feed page, plus an archive
+// link to the complete feed. They are all empty when the feed fits on a
+// single page.
+type feedLinks struct {
+	First   string
+	Prev    string
+	Next    string
+	Last    string
+	Archive string
+}
+
+// each calls fn with the relation and address of every link that is set, in
+// document order.
+func (l feedLinks) each(fn func(rel, href string)) {
+	for _, link := range [][2]string{
+		{"first", l.First},
+		{"prev", l.Prev},
+		{"next", l.Next},
+		{"last", l.Last},
+		{"archive", l.Archive},
+	} {
+		if link[1] != "" {
+			fn(link[0], link[1])
+		}
+	}
+}
+
+// feedPage selects part of the episode list, newest first. A zero size
+// selects every episode.
+type feedPage struct {
+	number int
+	size   int
+}
+
+// allPages is the page parameter value requesting the complete feed.
+const allPages = "all"
+
+// errFeedPageNotFound reports a page number past the end of the feed.
+var errFeedPageNotFound = errors.New("feed page out of range")
+
+// parseFeedPage reads the limit and page query parameters. The page size
+// defaults to maxItems.
+func parseFeedPage(query url.Values, maxItems int) (feedPage, error) {
+	page := feedPage{number: 1, size: maxItems}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return feedPage{}, fmt.Errorf("invalid limit %q", value)
+		}
+		page.size = limit
+	}
+	switch value := query.Get("page"); value {
+	case "":
+	case allPages:
+		page.size = 0
+	default:
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return feedPage{}, fmt.Errorf("invalid page %q", value)
+		}
+		page.number = number
+	}
+	return page, nil
+}
+
+// pageURL returns self pointing at another page, keeping the other query
+// parameters such as the token and limit.
+func pageURL(self *url.URL, page string) string {
+	u := *self
+	query := u.Query()
+	query.Set("page", page)
+	if page == allPages {
+		query.Del("limit")
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type feedItem struct {
+	GUID  string
+	Title string
+	Link  string
+	// Description is always set, falling back to the artist, album and
+	// filename; Summary is the episode's own description only.
+	Description     string
+	Summary         string
+	Published       time.Time
+	Modified        time.Time
+	Author          string
+	Image           string
+	Enclosure       feedEnclosure
+	Alternates      []feedEnclosure
+	DurationSeconds *float64
+	ChaptersURL     string
+	Transcripts     []feedTranscript
+	Season          *int
+	Episode         *int
+	EpisodeType     string
+	Explicit        *bool
+	Persons         []models.Person
+}
+
+type feedEnclosure struct {
+	URL         string
+	Type        string
+	Length      int64
+	BitrateKbps int
+	Title       string
+}
+
+type feedTranscript struct {
+	URL      string
+	Type     string
+	Language string
+}
+
+// feedFormat describes one of the feed serialisations.
+type feedFormat struct {
+	name        string
+	contentType string
+	// mediaTypes are the Accept header values that select the format.
+	mediaTypes []string
+	render     func(feed) ([]byte, error)
+}
+
+var (
+	rssFormat = feedFormat{
+		name:        "RSS",
+		contentType: "application/rss+xml; charset=utf-8",
+		mediaTypes:  []string{"application/rss+xml", "application/xml", "text/xml"},
+		render:      renderRSS,
+	}
+	atomFormat = feedFormat{
+		name:        "Atom",
+		contentType: "application/atom+xml; charset=utf-8",
+		mediaTypes:  []string{"application/atom+xml"},
+		render:      renderAtom,
+	}
+	jsonFeedFormat = feedFormat{
+		name:        "JSON",
+		contentType: "application/feed+json; charset=utf-8",
+		mediaTypes:  []string{"application/feed+json", "application/json"},
+		render:      renderJSONFeed,
+	}
+)
+
+// feedFormats lists the formats in order of preference when an Accept
+// header rates several of them equally.
+var feedFormats = []feedFormat{rssFormat, atomFormat, jsonFeedFormat}
+
+// negotiateFeedFormat picks the format the Accept header rates highest.
+// Podcast apps often send no or unrelated Accept values, so anything that
+// matches no format yields RSS rather than 406 Not Acceptable.
+func negotiateFeedFormat(accept string) feedFormat {
+	best, bestQuality := feedFormats[0], 0.0
+	for _, format := range feedFormats {
+		if quality := acceptQuality(accept, format.mediaTypes); quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the weight accept gives to any of mediaTypes, taken
+// from the most specific matching media range as RFC 9110 prescribes.
+func acceptQuality(accept string, mediaTypes []string) float64 {
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		weight := 1.0
+		if value, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		for _, mediaType := range mediaTypes {
+			rank := rangeSpecificity(mediaRange, mediaType)
+			if rank < 0 {
+				continue
+			}
+			if rank > specificity || (rank == specificity && weight > quality) {
+				quality, specificity = weight, rank
+			}
+		}
+	}
+	return quality
+}
+
+// rangeSpecificity reports how closely mediaRange matches mediaType: 2 for
+// an exact match, 1 for type/*, 0 for */* and -1 when it does not match.
+func rangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// buildFeed assembles one page of the feed for episodes, newest first, with
+// every URL pointing at base and carrying token. self is the requested feed
+// address, from which the paging links are derived.
+func (h *serverHandler) buildFeed(base, self *url.URL, episodes []models.Episode, sub subscriber, page feedPage) (feed, error) {
+	channelLink := *base
+	channelLink.Path = ""
+	channelLink.RawQuery = ""
+
+	sorted := make([]models.Episode, len(episodes))
+	copy(sorted, episodes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iTime := episodePublished(sorted[i])
+		jTime := episodePublished(sorted[j])
+		if iTime.Equal(jTime) {
+			return sorted[i].ID > sorted[j].ID
+		}
+		return iTime.After(jTime)
+	})
+
+	lastBuild := time.Time{}
+	for _, ep := range sorted {
+		if !ep.ModifiedAt.IsZero() && (lastBuild.IsZero() || ep.ModifiedAt.After(lastBuild)) {
+			lastBuild = ep.ModifiedAt.UTC()
+		}
+	}
+	if lastBuild.IsZero() {
+		lastBuild = time.Now().UTC()
+	}
+
+	f := feed{
+		Title:       h.feed.Title,
+		Description: h.feed.Description,
+		Language:    h.feed.Language,
+		Author:      h.feed.Author,
+		Copyright:   h.feed.Copyright,
+		Link:        channelLink.String(),
+		SelfURL:     self.String(),
+		Image:       h.feed.Image,
+		Categories:  h.feed.Categories,
+		Explicit:    h.feed.Explicit,
+		OwnerName:   h.feed.OwnerName,
+		OwnerEmail:  h.feed.OwnerEmail,
+		Type:        h.feed.Type,
+		Locked:      h.feed.Locked,
+		Medium:      h.feed.Medium,
+		Updated:     lastBuild,
+	}
+	if h.feed.Link != "" {
+		f.Link = h.feed.Link
+	}
+	for _, person := range h.feed.Persons {
+		f.Persons = append(f.Persons, models.Person(person))
+	}
+
+	canonicalFeed := strings.TrimRight(h.feed.PublicURL, "/") + "/feed"
+	if h.feed.PublicURL == "" {
+		canonicalFeed = channelLink.String() + "/feed"
+	}
+	f.GUID = h.guid.resolve(canonicalFeed)
+
+	resourceURL := h.resourceURLs(base, sub)
+	if f.Image == "" {
+		// Without configured artwork the channel shows the latest cover.
+		for _, ep := range sorted {
+			if artwork := episodeArtworkURL(ep, resourceURL); artwork != "" {
+				f.Image = artwork
+				break
+			}
+		}
+	}
+
+	items := sorted
+	if page.size > 0 {
+		last := max(1, (len(sorted)+page.size-1)/page.size)
+		if page.number > last {
+			return feed{}, errFeedPageNotFound
+		}
+		start := (page.number - 1) * page.size
+		items = sorted[start:min(start+page.size, len(sorted))]
+		if last > 1 {
+			f.Pages = feedLinks{
+				First:   pageURL(self, "1"),
+				Last:    pageURL(self, strconv.Itoa(last)),
+				Archive: pageURL(self, allPages),
+			}
+			if page.number > 1 {
+				f.Pages.Prev = pageURL(self, strconv.Itoa(page.number-1))
+			}
+			if page.number < last {
+				f.Pages.Next = pageURL(self, strconv.Itoa(page.number+1))
+			}
+		}
+	} else if page.number > 1 {
+		return feed{}, errFeedPageNotFound
+	}
+
+	for _, ep := range items {
+		enclosureURL := resourceURL(pathpkg.Join("audio", ep.RelativePath))
+
+		item := feedItem{
+			GUID:        episodeGUID(ep),
+			Title:       ep.Title,
+			Link:        enclosureURL,
+			Description: episodeDescription(ep),
+			Summary:     ep.Description,
+			Published:   episodePublished(ep),
+			Modified:    ep.ModifiedAt,
+			Enclosure: feedEnclosure{
+				URL:    enclosureURL,
+				Type:   mimeTypeForFilename(ep.Filename),
+				Length: ep.FilesizeBytes,
+			},
+			DurationSeconds: ep.DurationSeconds,
+			ChaptersURL:     episodeChaptersURL(ep, resourceURL),
+			Season:          ep.Season,
+			Episode:         ep.EpisodeNumber,
+			EpisodeType:     ep.EpisodeType,
+			Explicit:        ep.Explicit,
+			Persons:         ep.Persons,
+		}
+		if len(ep.Links) > 0 {
+			item.Link = ep.Links[0].URL
+		}
+		if ep.BitrateKbps != nil {
+			item.Enclosure.BitrateKbps = *ep.BitrateKbps
+		}
+		if ep.Artist != nil {
+			item.Author = *ep.Artist
+		} else {
+			item.Author = h.feed.Author
+		}
+
+		item.Image = episodeArtworkURL(ep, resourceURL)
+
+		for _, alternate := range ep.AlternateEnclosures {
+			item.Alternates = append(item.Alternates, alternateEnclosure(alternate, resourceURL))
+		}
+		for _, transcript := range ep.Transcripts {
+			item.Transcripts = append(item.Transcripts, feedTranscript{
+				URL:      transcriptURL(transcript, resourceURL),
+				Type:     transcript.Type,
+				Language: transcript.Language,
+			})
+		}
+
+		f.Items = append(f.Items, item)
+	}
+
+	return f, nil
+}
+
+// alternateEnclosure describes another rendition of an episode, pointing
+// files inside the library at the audio endpoint through audioURL.
+func alternateEnclosure(alternate models.AlternateEnclosure, audioURL func(path string) string) feedEnclosure {
+	source := alternate.URL
+	name := alternate.URL
+	if alternate.Path != "" {
+		source = audioURL(pathpkg.Join("audio", alternate.Path))
+		name = alternate.Path
+	}
+	if parsed, err := url.Parse(name); err == nil {
+		name = parsed.Path
+	}
+	mimeType := alternate.Type
+	if mimeType == "" {
+		mimeType = mimeTypeForFilename(name)
+	}
+	return feedEnclosure{
+		URL:         source,
+		Type:        mimeType,
+		Length:      alternate.Length,
+		BitrateKbps: alternate.BitrateKbps,
+		Title:       alternate.Title,
+	}
+}
+
+// subscriber is whom a feed is rendered for: the token it was requested
+// with, if any, and the ID of that token when the validator can look tokens
+// up by ID. Feeds requested through a signed address have only the ID.
+type subscriber struct {
+	token string
+	id    string
+}
+
+// subscriberFor looks up the ID of token, which stays empty unless the
+// validator can later resolve it in signed URLs.
+func (h *serverHandler) subscriberFor(token string) subscriber {
+	sub := subscriber{token: token}
+	if validator, ok := h.validator.(SignedURLValidator); ok && token != "" {
+		if identity, ok := validator.Identify(token); ok {
+			sub.id = identity.ID
+		}
+	}
+	return sub
+}
+
+// signs reports whether links in sub's feeds are signed rather than
+// carrying the token. That takes a signing key and a token ID, which is what
+// lets revoking the token invalidate the URLs.
+func (h *serverHandler) signs(sub subscriber) bool {
+	return h.signer != nil && sub.id != ""
+}
+
+// resourceURLs returns the function building the URLs of the audio,
+// artwork, chapters and transcripts in sub's feed: signed when h.signs(sub),
+// otherwise carrying sub's token as before.
+func (h *serverHandler) resourceURLs(base *url.URL, sub subscriber) func(path string) string {
+	if !h.signs(sub) {
+		return func(path string) string {
+			return publicURL(base, path, sub.token)
+		}
+	}
+
+	expires := h.signer.expiry(time.Now())
+	return func(path string) string {
+		u, err := url.Parse(publicURL(base, path, ""))
+		if err != nil {
+			return publicURL(base, path, sub.token)
+		}
+		u.RawQuery = h.signer.sign(u.Path, sub.id, expires)
+		return u.String()
+	}
+}
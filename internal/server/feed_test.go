@@ -0,0 +1,433 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func feedFormatEpisodes() []models.Episode {
+	duration := 90.0
+	season := 2
+	return []models.Episode{
+		{
+			ID: "shows/pilot.mp3", GUID: "5f0c6a34-7d1e-4d8a-9b0e-2f4f1c9d8e71", RelativePath: "shows/pilot.mp3", Filename: "pilot.mp3",
+			Title: "Pilot", Description: "The first one.", FilesizeBytes: 1234, DurationSeconds: &duration, Season: &season,
+			ModifiedAt:          time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+			Chapters:            []models.Chapter{{Title: "Intro"}},
+			Transcripts:         []models.Transcript{{Path: "shows/pilot.vtt", Type: "text/vtt"}},
+			AlternateEnclosures: []models.AlternateEnclosure{{URL: "https://cdn.example.com/pilot.opus"}},
+		},
+		{
+			ID: "shows/legacy.mp3", RelativePath: "shows/legacy.mp3", Filename: "legacy.mp3", Title: "Legacy",
+			FilesizeBytes: 10, ModifiedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	meta := testFeedMetadata()
+	meta.Copyright = "© Test"
+	handler := New(&fakeLibrary{episodes: feedFormatEpisodes()}, validator, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.atom?token=secret", nil)
+	req.Host = "feed.example"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	type link struct {
+		Rel    string `xml:"rel,attr"`
+		Type   string `xml:"type,attr"`
+		Href   string `xml:"href,attr"`
+		Length string `xml:"length,attr"`
+	}
+	var payload struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"http://www.w3.org/2005/Atom id"`
+		Title   string   `xml:"http://www.w3.org/2005/Atom title"`
+		Rights  string   `xml:"http://www.w3.org/2005/Atom rights"`
+		Links   []link   `xml:"http://www.w3.org/2005/Atom link"`
+		Entries []struct {
+			ID       string `xml:"http://www.w3.org/2005/Atom id"`
+			Title    string `xml:"http://www.w3.org/2005/Atom title"`
+			Summary  string `xml:"http://www.w3.org/2005/Atom summary"`
+			Updated  string `xml:"http://www.w3.org/2005/Atom updated"`
+			Links    []link `xml:"http://www.w3.org/2005/Atom link"`
+			Duration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+			Season   string `xml:"https://podcastindex.org/namespace/1.0 season"`
+			Chapters struct {
+				URL string `xml:"url,attr"`
+			} `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+			Transcript struct {
+				URL string `xml:"url,attr"`
+			} `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+		} `xml:"http://www.w3.org/2005/Atom entry"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal atom: %v\n%s", err, rec.Body.String())
+	}
+
+	if payload.Title != "Test Feed" || payload.Rights != "© Test" || !strings.HasPrefix(payload.ID, "urn:uuid:") {
+		t.Fatalf("unexpected feed header %+v", payload)
+	}
+	if len(payload.Links) == 0 || payload.Links[0] != (link{Rel: "self", Type: "application/atom+xml", Href: "http://feed.example/feed.atom?token=secret"}) {
+		t.Fatalf("unexpected feed links %+v", payload.Links)
+	}
+	if len(payload.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(payload.Entries))
+	}
+
+	pilot := payload.Entries[0]
+	if pilot.ID != "urn:uuid:5f0c6a34-7d1e-4d8a-9b0e-2f4f1c9d8e71" || pilot.Title != "Pilot" || pilot.Summary != "The first one." {
+		t.Fatalf("unexpected entry %+v", pilot)
+	}
+	if pilot.Updated != "2024-03-01T08:00:00Z" || pilot.Duration != "00:01:30" || pilot.Season != "2" {
+		t.Fatalf("unexpected entry details %+v", pilot)
+	}
+	wantLinks := []link{
+		{Rel: "alternate", Href: "https://feed.example/audio/shows/pilot.mp3?token=secret"},
+		{Rel: "enclosure", Type: "audio/mpeg", Href: "https://feed.example/audio/shows/pilot.mp3?token=secret", Length: "1234"},
+		{Rel: "enclosure", Type: "audio/opus", Href: "https://cdn.example.com/pilot.opus"},
+	}
+	if len(pilot.Links) != len(wantLinks) {
+		t.Fatalf("unexpected entry links %+v", pilot.Links)
+	}
+	for i, want := range wantLinks {
+		got := pilot.Links[i]
+		if want.Type == "audio/opus" && got.Type == "audio/ogg" {
+			want.Type = got.Type
+		}
+		if got != want {
+			t.Fatalf("link %d: got %+v want %+v", i, got, want)
+		}
+	}
+	if pilot.Chapters.URL != "https://feed.example/chapters/shows/pilot.mp3.json?token=secret" ||
+		pilot.Transcript.URL != "https://feed.example/transcripts/shows/pilot.vtt?token=secret" {
+		t.Fatalf("unexpected chapters/transcript %+v", pilot)
+	}
+
+	legacy := payload.Entries[1]
+	if !strings.HasPrefix(legacy.ID, "urn:uuid:") || legacy.ID == payload.ID {
+		t.Fatalf("expected derived UUID for path GUID, got %q", legacy.ID)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	explicit := false
+	meta := testFeedMetadata()
+	meta.Explicit = &explicit
+	meta.Categories = []FeedCategory{{Name: "Technology"}}
+	handler := New(&fakeLibrary{episodes: feedFormatEpisodes()}, nil, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.json", nil)
+	req.Host = "feed.example"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/feed+json") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	var payload struct {
+		Version string `json:"version"`
+		Title   string `json:"title"`
+		FeedURL string `json:"feed_url"`
+		Authors []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+		Podcast struct {
+			GUID       string `json:"guid"`
+			Explicit   *bool  `json:"explicit"`
+			Categories []struct {
+				Name string `json:"name"`
+			} `json:"categories"`
+		} `json:"_podcast"`
+		Items []struct {
+			ID          string `json:"id"`
+			URL         string `json:"url"`
+			ContentText string `json:"content_text"`
+			Attachments []struct {
+				URL      string   `json:"url"`
+				MIMEType string   `json:"mime_type"`
+				Title    string   `json:"title"`
+				Size     int64    `json:"size_in_bytes"`
+				Duration *float64 `json:"duration_in_seconds"`
+			} `json:"attachments"`
+			Podcast struct {
+				Season   *int `json:"season"`
+				Chapters *struct {
+					URL string `json:"url"`
+				} `json:"chapters"`
+				Transcripts []struct {
+					URL  string `json:"url"`
+					Type string `json:"type"`
+				} `json:"transcripts"`
+			} `json:"_podcast"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal json feed: %v", err)
+	}
+
+	if payload.Version != jsonFeedVersion || payload.Title != "Test Feed" || payload.FeedURL != "http://feed.example/feed.json" {
+		t.Fatalf("unexpected feed header %+v", payload)
+	}
+	if len(payload.Authors) != 1 || payload.Authors[0].Name != "Test Author" {
+		t.Fatalf("unexpected authors %+v", payload.Authors)
+	}
+	if payload.Podcast.GUID == "" || payload.Podcast.Explicit == nil || *payload.Podcast.Explicit ||
+		len(payload.Podcast.Categories) != 1 || payload.Podcast.Categories[0].Name != "Technology" {
+		t.Fatalf("unexpected podcast extension %+v", payload.Podcast)
+	}
+	if len(payload.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(payload.Items))
+	}
+
+	pilot := payload.Items[0]
+	if pilot.ID != "5f0c6a34-7d1e-4d8a-9b0e-2f4f1c9d8e71" || pilot.ContentText != "The first one." {
+		t.Fatalf("unexpected item %+v", pilot)
+	}
+	if len(pilot.Attachments) != 2 {
+		t.Fatalf("expected primary and alternate attachments, got %+v", pilot.Attachments)
+	}
+	primary := pilot.Attachments[0]
+	if primary.URL != "https://feed.example/audio/shows/pilot.mp3" || primary.MIMEType != "audio/mpeg" || primary.Size != 1234 ||
+		primary.Duration == nil || *primary.Duration != 90 || primary.Title != "Pilot" || pilot.Attachments[1].Title != "Pilot" {
+		t.Fatalf("unexpected attachments %+v", pilot.Attachments)
+	}
+	if pilot.Podcast.Season == nil || *pilot.Podcast.Season != 2 || pilot.Podcast.Chapters == nil ||
+		len(pilot.Podcast.Transcripts) != 1 || pilot.Podcast.Transcripts[0].Type != "text/vtt" {
+		t.Fatalf("unexpected item extension %+v", pilot.Podcast)
+	}
+	if legacy := payload.Items[1]; len(legacy.Attachments) != 1 || legacy.Attachments[0].Title != "" {
+		t.Fatalf("expected untitled single attachment, got %+v", legacy.Attachments)
+	}
+}
+
+func TestFeedContentNegotiation(t *testing.T) {
+	handler := New(&fakeLibrary{episodes: feedFormatEpisodes()}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	cases := []struct {
+		path   string
+		accept string
+		want   string
+	}{
+		{"/feed", "", "application/rss+xml"},
+		{"/feed", "text/html,application/xhtml+xml", "application/rss+xml"},
+		{"/feed", "application/atom+xml", "application/atom+xml"},
+		{"/feed", "application/feed+json", "application/feed+json"},
+		{"/feed", "application/json", "application/feed+json"},
+		{"/feed", "application/rss+xml;q=0.5, application/atom+xml;q=0.9", "application/atom+xml"},
+		{"/feed", "application/atom+xml, */*;q=0.1", "application/atom+xml"},
+		{"/feed", "*/*", "application/rss+xml"},
+		{"/feed", "application/*;q=0.8, application/rss+xml;q=0.2", "application/atom+xml"},
+		{"/feed", "application/atom+xml;q=0, */*", "application/rss+xml"},
+		{"/feed.xml", "application/atom+xml", "application/rss+xml"},
+		{"/rss", "application/feed+json", "application/rss+xml"},
+		{"/feed.json", "application/rss+xml", "application/feed+json"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s with Accept %q: expected 200, got %d", tc.path, tc.accept, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.want) {
+			t.Fatalf("%s with Accept %q: got %q want %q", tc.path, tc.accept, ct, tc.want)
+		}
+		if tc.path == "/feed" && !slices.Contains(rec.Header().Values("Vary"), "Accept") {
+			t.Fatalf("expected Vary: Accept on negotiated feed")
+		}
+	}
+}
+
+func TestFeedPagination(t *testing.T) {
+	var episodes []models.Episode
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("episode-%d.mp3", i)
+		episodes = append(episodes, models.Episode{ID: name, RelativePath: name, Filename: name, Title: name, ModifiedAt: time.Unix(1700000000+int64(i), 0)})
+	}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	meta := testFeedMetadata()
+	meta.MaxItems = 2
+	handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+
+	type page struct {
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"channel>link"`
+		Items []struct {
+			Title     string `xml:"title"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+	}
+	get := func(query string) (int, page) {
+		req := httptest.NewRequest(http.MethodGet, "/feed?token=secret"+query, nil)
+		req.Host = "feed.example"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var doc page
+		if rec.Code == http.StatusOK {
+			if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("unmarshal %s: %v", query, err)
+			}
+		}
+		return rec.Code, doc
+	}
+	links := func(doc page) map[string]string {
+		found := map[string]string{}
+		for _, link := range doc.Links {
+			if link.Rel != "" {
+				found[link.Rel] = link.Href
+			}
+		}
+		return found
+	}
+	titles := func(doc page) []string {
+		var found []string
+		for _, item := range doc.Items {
+			found = append(found, item.Title)
+		}
+		return found
+	}
+
+	code, first := get("")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if got := titles(first); !slices.Equal(got, []string{"episode-4.mp3", "episode-3.mp3"}) {
+		t.Fatalf("unexpected first page %v", got)
+	}
+	rels := links(first)
+	if rels["next"] != "http://feed.example/feed?page=2&token=secret" {
+		t.Fatalf("unexpected next link %q", rels["next"])
+	}
+	if rels["last"] != "http://feed.example/feed?page=3&token=secret" || rels["first"] != "http://feed.example/feed?page=1&token=secret" {
+		t.Fatalf("unexpected first/last links %v", rels)
+	}
+	if rels["archive"] != "http://feed.example/feed?page=all&token=secret" {
+		t.Fatalf("unexpected archive link %q", rels["archive"])
+	}
+	if _, ok := rels["prev"]; ok {
+		t.Fatalf("expected no prev link on the first page")
+	}
+
+	_, second := get("&page=2")
+	if got := titles(second); !slices.Equal(got, []string{"episode-2.mp3", "episode-1.mp3"}) {
+		t.Fatalf("unexpected second page %v", got)
+	}
+	if rels := links(second); rels["prev"] == "" || rels["next"] == "" || rels["self"] != "http://feed.example/feed?token=secret&page=2" {
+		t.Fatalf("unexpected second page links %v", rels)
+	}
+	for _, item := range second.Items {
+		if !strings.HasPrefix(item.Enclosure.URL, "https://feed.example/audio/") || !strings.Contains(item.Enclosure.URL, "token=secret") {
+			t.Fatalf("expected https enclosure with token, got %q", item.Enclosure.URL)
+		}
+	}
+
+	_, last := get("&page=3")
+	if got := titles(last); !slices.Equal(got, []string{"episode-0.mp3"}) {
+		t.Fatalf("unexpected last page %v", got)
+	}
+	if _, ok := links(last)["next"]; ok {
+		t.Fatalf("expected no next link on the last page")
+	}
+
+	_, limited := get("&limit=4")
+	if got := titles(limited); len(got) != 4 || links(limited)["next"] != "http://feed.example/feed?limit=4&page=2&token=secret" {
+		t.Fatalf("unexpected limited page %v %v", got, links(limited))
+	}
+
+	_, archive := get("&limit=1&page=all")
+	if got := titles(archive); len(got) != 5 {
+		t.Fatalf("expected full archive, got %v", got)
+	}
+	if rels := links(archive); len(rels) != 1 {
+		t.Fatalf("expected only a self link on the archive, got %v", rels)
+	}
+
+	for query, want := range map[string]int{
+		"&page=4":     http.StatusNotFound,
+		"&page=0":     http.StatusBadRequest,
+		"&page=first": http.StatusBadRequest,
+		"&limit=0":    http.StatusBadRequest,
+		"&limit=-3":   http.StatusBadRequest,
+	} {
+		if code, _ := get(query); code != want {
+			t.Fatalf("%s: expected %d, got %d", query, want, code)
+		}
+	}
+}
+
+func TestPagedAtomAndJSONFeeds(t *testing.T) {
+	episodes := feedFormatEpisodes()
+	handler := New(&fakeLibrary{episodes: episodes}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.atom?limit=1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var atom struct {
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+		Entries []struct{} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &atom); err != nil {
+		t.Fatalf("unmarshal atom: %v", err)
+	}
+	var rels []string
+	for _, link := range atom.Links {
+		rels = append(rels, link.Rel)
+	}
+	if len(atom.Entries) != 1 || !slices.Equal(rels, []string{"self", "alternate", "first", "next", "last", "archive"}) {
+		t.Fatalf("unexpected atom page: %d entries, links %v", len(atom.Entries), rels)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed.json?limit=1&page=2", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var doc struct {
+		NextURL string `json:"next_url"`
+		Podcast struct {
+			PrevURL    string `json:"prev_url"`
+			ArchiveURL string `json:"archive_url"`
+		} `json:"_podcast"`
+		Items []struct{} `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshal json feed: %v", err)
+	}
+	if len(doc.Items) != 1 || doc.NextURL != "" || !strings.HasSuffix(doc.Podcast.PrevURL, "/feed.json?limit=1&page=1") || !strings.HasSuffix(doc.Podcast.ArchiveURL, "/feed.json?page=all") {
+		t.Fatalf("unexpected json feed page: %+v", doc)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"home-podcast/internal/fsutil"
+	"home-podcast/internal/uuid"
+)
+
+// podcastGUIDNamespace is the UUIDv5 namespace the Podcasting 2.0 spec
+// defines for podcast:guid.
+const podcastGUIDNamespace = "ead4c236-bf58-58c6-a2c6-a6b28d128cb6"
+
+// feedGUID hands out the channel podcast:guid. It is derived from the feed
+// URL the first time it is needed and then kept, in a file when a path is
+// configured, so it never changes even if the feed moves.
+type feedGUID struct {
+	path   string
+	logger *log.Logger
+
+	mu    sync.Mutex
+	value string
+}
+
+func newFeedGUID(path string, logger *log.Logger) *feedGUID {
+	g := &feedGUID{path: path, logger: logger}
+	if path == "" {
+		return g
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Printf("failed to read feed GUID %s: %v", path, err)
+		}
+		return g
+	}
+	g.value = strings.TrimSpace(string(data))
+	return g
+}
+
+// resolve returns the stored GUID, deriving and persisting it from feedURL
+// when there is none yet.
+func (g *feedGUID) resolve(feedURL string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.value != "" {
+		return g.value
+	}
+	value, err := podcastGUID(feedURL)
+	if err != nil {
+		g.logger.Printf("failed to derive feed GUID: %v", err)
+		return ""
+	}
+	g.value = value
+	if g.path != "" {
+		err := os.MkdirAll(filepath.Dir(g.path), 0o755)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(g.path, []byte(value+"\n"), 0o644)
+		}
+		if err != nil {
+			g.logger.Printf("failed to persist feed GUID %s: %v", g.path, err)
+		}
+	}
+	return value
+}
+
+// podcastGUID derives a podcast:guid from a feed URL as the spec describes:
+// a UUIDv5 of the URL without its scheme and trailing slashes.
+func podcastGUID(feedURL string) (string, error) {
+	if _, rest, ok := strings.Cut(feedURL, "://"); ok {
+		feedURL = rest
+	}
+	return uuid.NewV5(podcastGUIDNamespace, strings.TrimRight(feedURL, "/"))
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+// jsonFeedVersion identifies the JSON Feed specification the output follows.
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// renderJSONFeed serialises f as JSON Feed 1.1. Podcast details the format
+// does not define are carried in "_podcast" extension objects on the feed
+// and its items, named after the matching RSS elements.
+func renderJSONFeed(f feed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.SelfURL,
+		Description: f.Description,
+		Icon:        f.Image,
+		Language:    f.Language,
+		NextURL:     f.Pages.Next,
+		Items:       make([]jsonFeedItem, 0, len(f.Items)),
+		Podcast: jsonFeedPodcast{
+			GUID:      f.GUID,
+			Explicit:  f.Explicit,
+			Type:      f.Type,
+			Copyright: f.Copyright,
+			Locked:    f.Locked,
+			Medium:    f.Medium,
+			Persons:   f.Persons,
+			Updated:   f.Updated.Format(time.RFC3339),
+			FirstURL:  f.Pages.First,
+			PrevURL:   f.Pages.Prev,
+			LastURL:   f.Pages.Last,
+			Archive:   f.Pages.Archive,
+		},
+	}
+	if f.Author != "" {
+		doc.Authors = []jsonFeedAuthor{{Name: f.Author}}
+	}
+	for _, category := range f.Categories {
+		doc.Podcast.Categories = append(doc.Podcast.Categories, jsonFeedCategory(category))
+	}
+	if f.OwnerName != "" || f.OwnerEmail != "" {
+		doc.Podcast.Owner = &jsonFeedOwner{Name: f.OwnerName, Email: f.OwnerEmail}
+	}
+
+	for _, item := range f.Items {
+		entry := jsonFeedItem{
+			ID:          item.GUID,
+			URL:         item.Link,
+			Title:       item.Title,
+			ContentText: item.Description,
+			Summary:     item.Summary,
+			Image:       item.Image,
+			Podcast: jsonFeedItemPodcast{
+				Season:      item.Season,
+				Episode:     item.Episode,
+				EpisodeType: item.EpisodeType,
+				Explicit:    item.Explicit,
+				Persons:     item.Persons,
+			},
+		}
+		if !item.Published.IsZero() {
+			entry.DatePublished = item.Published.UTC().Format(time.RFC3339)
+		}
+		if !item.Modified.IsZero() {
+			entry.DateModified = item.Modified.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+
+		// JSON Feed treats attachments sharing a title as renditions of the
+		// same content, so alternates are all titled after the episode.
+		for _, enclosure := range append([]feedEnclosure{item.Enclosure}, item.Alternates...) {
+			attachment := jsonFeedAttachment{
+				URL:             enclosure.URL,
+				MIMEType:        enclosure.Type,
+				SizeInBytes:     enclosure.Length,
+				DurationSeconds: item.DurationSeconds,
+			}
+			if len(item.Alternates) > 0 {
+				attachment.Title = item.Title
+			}
+			entry.Attachments = append(entry.Attachments, attachment)
+		}
+
+		if item.ChaptersURL != "" {
+			entry.Podcast.Chapters = &jsonFeedChapters{URL: item.ChaptersURL, Type: chaptersContentType}
+		}
+		for _, transcript := range item.Transcripts {
+			entry.Podcast.Transcripts = append(entry.Podcast.Transcripts, jsonFeedTranscript(transcript))
+		}
+
+		doc.Items = append(doc.Items, entry)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Podcast     jsonFeedPodcast  `json:"_podcast"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedPodcast struct {
+	GUID       string             `json:"guid,omitempty"`
+	Updated    string             `json:"updated"`
+	Explicit   *bool              `json:"explicit,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Categories []jsonFeedCategory `json:"categories,omitempty"`
+	Owner      *jsonFeedOwner     `json:"owner,omitempty"`
+	Copyright  string             `json:"copyright,omitempty"`
+	Locked     *bool              `json:"locked,omitempty"`
+	Medium     string             `json:"medium,omitempty"`
+	Persons    []models.Person    `json:"persons,omitempty"`
+	// Paging links besides next_url, which JSON Feed defines itself.
+	FirstURL string `json:"first_url,omitempty"`
+	PrevURL  string `json:"prev_url,omitempty"`
+	LastURL  string `json:"last_url,omitempty"`
+	Archive  string `json:"archive_url,omitempty"`
+}
+
+type jsonFeedCategory struct {
+	Name        string `json:"name"`
+	Subcategory string `json:"subcategory,omitempty"`
+}
+
+type jsonFeedOwner struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+	Podcast       jsonFeedItemPodcast  `json:"_podcast"`
+}
+
+type jsonFeedAttachment struct {
+	URL             string   `json:"url"`
+	MIMEType        string   `json:"mime_type"`
+	Title           string   `json:"title,omitempty"`
+	SizeInBytes     int64    `json:"size_in_bytes,omitempty"`
+	DurationSeconds *float64 `json:"duration_in_seconds,omitempty"`
+}
+
+type jsonFeedItemPodcast struct {
+	Season      *int                 `json:"season,omitempty"`
+	Episode     *int                 `json:"episode,omitempty"`
+	EpisodeType string               `json:"episode_type,omitempty"`
+	Explicit    *bool                `json:"explicit,omitempty"`
+	Chapters    *jsonFeedChapters    `json:"chapters,omitempty"`
+	Transcripts []jsonFeedTranscript `json:"transcripts,omitempty"`
+	Persons     []models.Person      `json:"persons,omitempty"`
+}
+
+type jsonFeedChapters struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+type jsonFeedTranscript struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Language string `json:"language,omitempty"`
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestPodcastGUID(t *testing.T) {
+	got, err := podcastGUID("https://podnews.net/rss/")
+	if err != nil {
+		t.Fatalf("podcastGUID: %v", err)
+	}
+	if want := "9b024349-ccf0-5f69-a609-6b82873eab3c"; got != want {
+		t.Fatalf("podcastGUID: got %q want %q", got, want)
+	}
+}
+
+func TestFeedPodcastNamespace(t *testing.T) {
+	season, number, bitrate := 3, 12, 128
+	episodes := []models.Episode{{
+		ID: "show/ep.mp3", RelativePath: "show/ep.mp3", Filename: "ep.mp3", FilesizeBytes: 1000, BitrateKbps: &bitrate,
+		Season: &season, EpisodeNumber: &number, ModifiedAt: time.Unix(1700000000, 0),
+		Persons: []models.Person{{Name: "Guest Star", Role: "guest", URL: "https://example.com/guest"}},
+		AlternateEnclosures: []models.AlternateEnclosure{
+			{Path: "show/ep.opus", Length: 400, BitrateKbps: 48, Title: "Opus"},
+			{URL: "https://cdn.example.com/ep.flac?x=1"},
+		},
+	}}
+
+	locked := true
+	meta := testFeedMetadata()
+	meta.OwnerEmail = "owner@example.com"
+	meta.Locked = &locked
+	meta.Medium = "podcast"
+	meta.Persons = []FeedPerson{{Name: "Jane Host", Role: "host", Image: "https://example.com/jane.jpg"}}
+	meta.GUIDFile = filepath.Join(t.TempDir(), "state", "feed-guid")
+
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	render := func(meta FeedMetadata, host string) string {
+		handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+		req := httptest.NewRequest(http.MethodGet, "/feed?token=secret", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	type person struct {
+		Role string `xml:"role,attr"`
+		Img  string `xml:"img,attr"`
+		Href string `xml:"href,attr"`
+		Name string `xml:",chardata"`
+	}
+	var payload struct {
+		Channel struct {
+			GUID   string `xml:"https://podcastindex.org/namespace/1.0 guid"`
+			Locked struct {
+				Owner string `xml:"owner,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"https://podcastindex.org/namespace/1.0 locked"`
+			Medium  string   `xml:"https://podcastindex.org/namespace/1.0 medium"`
+			Persons []person `xml:"https://podcastindex.org/namespace/1.0 person"`
+			Items   []struct {
+				Season     string   `xml:"https://podcastindex.org/namespace/1.0 season"`
+				Episode    string   `xml:"https://podcastindex.org/namespace/1.0 episode"`
+				Persons    []person `xml:"https://podcastindex.org/namespace/1.0 person"`
+				Alternates []struct {
+					Type    string `xml:"type,attr"`
+					Length  int64  `xml:"length,attr"`
+					Bitrate int    `xml:"bitrate,attr"`
+					Title   string `xml:"title,attr"`
+					Default string `xml:"default,attr"`
+					Source  struct {
+						URI string `xml:"uri,attr"`
+					} `xml:"https://podcastindex.org/namespace/1.0 source"`
+				} `xml:"https://podcastindex.org/namespace/1.0 alternateEnclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(render(meta, "feed.example")), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+
+	ch := payload.Channel
+	wantGUID, _ := podcastGUID("feed.example/feed")
+	if ch.GUID != wantGUID {
+		t.Fatalf("unexpected channel guid %q, want %q", ch.GUID, wantGUID)
+	}
+	if ch.Locked.Value != "yes" || ch.Locked.Owner != "owner@example.com" || ch.Medium != "podcast" {
+		t.Fatalf("unexpected locked/medium %+v", ch)
+	}
+	if len(ch.Persons) != 1 || ch.Persons[0] != (person{Role: "host", Img: "https://example.com/jane.jpg", Name: "Jane Host"}) {
+		t.Fatalf("unexpected channel persons %+v", ch.Persons)
+	}
+
+	item := ch.Items[0]
+	if item.Season != "3" || item.Episode != "12" {
+		t.Fatalf("unexpected season/episode %q/%q", item.Season, item.Episode)
+	}
+	if len(item.Persons) != 1 || item.Persons[0].Name != "Guest Star" || item.Persons[0].Href != "https://example.com/guest" {
+		t.Fatalf("unexpected item persons %+v", item.Persons)
+	}
+	if len(item.Alternates) != 3 {
+		t.Fatalf("expected primary plus two alternate enclosures, got %+v", item.Alternates)
+	}
+	primary, opus, flac := item.Alternates[0], item.Alternates[1], item.Alternates[2]
+	if primary.Default != "true" || primary.Type != "audio/mpeg" || primary.Length != 1000 || primary.Bitrate != 128000 ||
+		primary.Source.URI != "https://feed.example/audio/show/ep.mp3?token=secret" {
+		t.Fatalf("unexpected primary enclosure %+v", primary)
+	}
+	if opus.Type != "audio/ogg" && opus.Type != "audio/opus" {
+		t.Fatalf("unexpected opus type %q", opus.Type)
+	}
+	if opus.Length != 400 || opus.Bitrate != 48000 || opus.Title != "Opus" || opus.Source.URI != "https://feed.example/audio/show/ep.opus?token=secret" {
+		t.Fatalf("unexpected opus enclosure %+v", opus)
+	}
+	if flac.Type != "audio/flac" || flac.Source.URI != "https://cdn.example.com/ep.flac?x=1" {
+		t.Fatalf("unexpected flac enclosure %+v", flac)
+	}
+
+	// The GUID is persisted and survives a change of address.
+	data, err := os.ReadFile(meta.GUIDFile)
+	if err != nil || strings.TrimSpace(string(data)) != wantGUID {
+		t.Fatalf("expected persisted guid, got %q, %v", data, err)
+	}
+	if body := render(meta, "moved.example"); !strings.Contains(body, "<podcast:guid>"+wantGUID+"</podcast:guid>") {
+		t.Fatalf("expected persisted guid after move:\n%s", body)
+	}
+
+	// A configured public URL takes precedence over the request address.
+	meta.GUIDFile = ""
+	meta.PublicURL = "https://podcast.example.com/"
+	wantGUID, _ = podcastGUID("podcast.example.com/feed")
+	if body := render(meta, "feed.example"); !strings.Contains(body, "<podcast:guid>"+wantGUID+"</podcast:guid>") {
+		t.Fatalf("expected guid from public URL:\n%s", body)
+	}
+
+	bare, _, _ := strings.Cut(render(testFeedMetadata(), "feed.example"), "<item>")
+	for _, element := range []string{"<podcast:locked", "<podcast:medium>", "<podcast:person"} {
+		if strings.Contains(bare, element) {
+			t.Fatalf("expected %s to be omitted without configuration:\n%s", element, bare)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"encoding/xml"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+// renderRSS serialises f as RSS 2.0 with the iTunes and Podcasting 2.0
+// extensions.
+func renderRSS(f feed) ([]byte, error) {
+	rss := rssFeed{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		PodcastNS: "https://podcastindex.org/namespace/1.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			Language:      f.Language,
+			Copyright:     f.Copyright,
+			LastBuildDate: f.Updated.Format(time.RFC1123Z),
+			Generator:     "home-podcast",
+			AtomLinks: []rssAtomLink{{
+				Href: f.SelfURL,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			}},
+			ITunesAuthor:     f.Author,
+			ITunesExplicit:   formatExplicit(f.Explicit),
+			ITunesType:       f.Type,
+			ITunesNewFeedURL: f.NewFeedURL,
+			PodcastGUID:      f.GUID,
+			PodcastMedium:    f.Medium,
+		},
+	}
+
+	f.Pages.each(func(rel, href string) {
+		rss.Channel.AtomLinks = append(rss.Channel.AtomLinks, rssAtomLink{Href: href, Rel: rel, Type: "application/rss+xml"})
+	})
+	if f.Image != "" {
+		rss.Channel.ITunesImage = &rssITunesImage{Href: f.Image}
+	}
+	for _, category := range f.Categories {
+		entry := rssITunesCategory{Text: category.Name}
+		if category.Subcategory != "" {
+			entry.Subcategory = &rssITunesCategory{Text: category.Subcategory}
+		}
+		rss.Channel.ITunesCategories = append(rss.Channel.ITunesCategories, entry)
+	}
+	if f.OwnerName != "" || f.OwnerEmail != "" {
+		rss.Channel.ITunesOwner = &rssITunesOwner{Name: f.OwnerName, Email: f.OwnerEmail}
+	}
+	if f.Locked != nil {
+		rss.Channel.PodcastLocked = &rssPodcastLocked{Owner: f.OwnerEmail, Value: "no"}
+		if *f.Locked {
+			rss.Channel.PodcastLocked.Value = "yes"
+		}
+	}
+	for _, person := range f.Persons {
+		rss.Channel.PodcastPersons = append(rss.Channel.PodcastPersons, rssPodcastPerson(person))
+	}
+
+	for _, entry := range f.Items {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{IsPermaLink: "false", Value: entry.GUID},
+			Description: entry.Description,
+			Enclosure: rssEnclosure{
+				URL:    entry.Enclosure.URL,
+				Length: entry.Enclosure.Length,
+				Type:   entry.Enclosure.Type,
+			},
+			ITunesAuthor:      entry.Author,
+			ITunesSummary:     entry.Summary,
+			ITunesEpisode:     entry.Episode,
+			ITunesSeason:      entry.Season,
+			ITunesEpisodeType: entry.EpisodeType,
+			ITunesExplicit:    formatExplicit(entry.Explicit),
+			PodcastSeason:     entry.Season,
+			PodcastEpisode:    entry.Episode,
+		}
+		if !entry.Published.IsZero() {
+			item.PubDate = entry.Published.UTC().Format(time.RFC1123Z)
+		}
+		if entry.DurationSeconds != nil {
+			item.ITunesDuration = formatDuration(*entry.DurationSeconds)
+		}
+		if entry.Image != "" {
+			item.ITunesImage = &rssITunesImage{Href: entry.Image}
+		}
+		if entry.ChaptersURL != "" {
+			item.PodcastChapters = &rssPodcastChapters{URL: entry.ChaptersURL, Type: chaptersContentType}
+		}
+		for _, person := range entry.Persons {
+			item.PodcastPersons = append(item.PodcastPersons, rssPodcastPerson(person))
+		}
+		if len(entry.Alternates) > 0 {
+			primary := rssEnclosureAlternate(entry.Enclosure)
+			primary.Default = "true"
+			item.PodcastAlternateEnclosures = append(item.PodcastAlternateEnclosures, primary)
+			for _, alternate := range entry.Alternates {
+				item.PodcastAlternateEnclosures = append(item.PodcastAlternateEnclosures, rssEnclosureAlternate(alternate))
+			}
+		}
+		for _, transcript := range entry.Transcripts {
+			item.PodcastTranscripts = append(item.PodcastTranscripts, rssPodcastTranscript(transcript))
+		}
+
+		rss.Channel.Items = append(rss.Channel.Items, item)
+	}
+
+	output, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), output...), nil
+}
+
+func rssPodcastPerson(person models.Person) rssPersonElement {
+	return rssPersonElement{Role: person.Role, Group: person.Group, Img: person.Image, Href: person.URL, Name: person.Name}
+}
+
+func rssEnclosureAlternate(enclosure feedEnclosure) rssAlternateEnclosure {
+	return rssAlternateEnclosure{
+		Type:    enclosure.Type,
+		Length:  enclosure.Length,
+		Bitrate: enclosure.BitrateKbps * 1000,
+		Title:   enclosure.Title,
+		Sources: []rssPodcastSource{{URI: enclosure.URL}},
+	}
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ITunesNS  string     `xml:"xmlns:itunes,attr"`
+	PodcastNS string     `xml:"xmlns:podcast,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title            string              `xml:"title"`
+	Link             string              `xml:"link"`
+	Description      string              `xml:"description"`
+	Language         string              `xml:"language,omitempty"`
+	Copyright        string              `xml:"copyright,omitempty"`
+	LastBuildDate    string              `xml:"lastBuildDate"`
+	Generator        string              `xml:"generator"`
+	AtomLinks        []rssAtomLink       `xml:"atom:link"`
+	ITunesAuthor     string              `xml:"itunes:author,omitempty"`
+	ITunesImage      *rssITunesImage     `xml:"itunes:image"`
+	ITunesCategories []rssITunesCategory `xml:"itunes:category"`
+	ITunesExplicit   string              `xml:"itunes:explicit,omitempty"`
+	ITunesOwner      *rssITunesOwner     `xml:"itunes:owner"`
+	ITunesType       string              `xml:"itunes:type,omitempty"`
+	ITunesNewFeedURL string              `xml:"itunes:new-feed-url,omitempty"`
+	PodcastGUID      string              `xml:"podcast:guid,omitempty"`
+	PodcastLocked    *rssPodcastLocked   `xml:"podcast:locked"`
+	PodcastMedium    string              `xml:"podcast:medium,omitempty"`
+	PodcastPersons   []rssPersonElement  `xml:"podcast:person"`
+	Items            []rssItem           `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title                      string                  `xml:"title"`
+	Link                       string                  `xml:"link"`
+	GUID                       rssGUID                 `xml:"guid"`
+	PubDate                    string                  `xml:"pubDate,omitempty"`
+	Description                string                  `xml:"description"`
+	Enclosure                  rssEnclosure            `xml:"enclosure"`
+	ITunesDuration             string                  `xml:"itunes:duration,omitempty"`
+	ITunesAuthor               string                  `xml:"itunes:author,omitempty"`
+	ITunesImage                *rssITunesImage         `xml:"itunes:image"`
+	ITunesSummary              string                  `xml:"itunes:summary,omitempty"`
+	ITunesEpisode              *int                    `xml:"itunes:episode,omitempty"`
+	ITunesSeason               *int                    `xml:"itunes:season,omitempty"`
+	ITunesEpisodeType          string                  `xml:"itunes:episodeType,omitempty"`
+	ITunesExplicit             string                  `xml:"itunes:explicit,omitempty"`
+	PodcastChapters            *rssPodcastChapters     `xml:"podcast:chapters"`
+	PodcastTranscripts         []rssPodcastTranscript  `xml:"podcast:transcript"`
+	PodcastSeason              *int                    `xml:"podcast:season,omitempty"`
+	PodcastEpisode             *int                    `xml:"podcast:episode,omitempty"`
+	PodcastPersons             []rssPersonElement      `xml:"podcast:person"`
+	PodcastAlternateEnclosures []rssAlternateEnclosure `xml:"podcast:alternateEnclosure"`
+}
+
+type rssITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssITunesCategory struct {
+	Text        string             `xml:"text,attr"`
+	Subcategory *rssITunesCategory `xml:"itunes:category"`
+}
+
+type rssITunesOwner struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email,omitempty"`
+}
+
+type rssPodcastLocked struct {
+	Owner string `xml:"owner,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type rssPersonElement struct {
+	Role  string `xml:"role,attr,omitempty"`
+	Group string `xml:"group,attr,omitempty"`
+	Img   string `xml:"img,attr,omitempty"`
+	Href  string `xml:"href,attr,omitempty"`
+	Name  string `xml:",chardata"`
+}
+
+type rssAlternateEnclosure struct {
+	Type    string             `xml:"type,attr"`
+	Length  int64              `xml:"length,attr,omitempty"`
+	Bitrate int                `xml:"bitrate,attr,omitempty"`
+	Title   string             `xml:"title,attr,omitempty"`
+	Default string             `xml:"default,attr,omitempty"`
+	Sources []rssPodcastSource `xml:"podcast:source"`
+}
+
+type rssPodcastSource struct {
+	URI string `xml:"uri,attr"`
+}
+
+type rssPodcastTranscript struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr,omitempty"`
+}
+
+type rssPodcastChapters struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
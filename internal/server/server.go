@@ -2,7 +2,6 @@ package server
 
 import (
 	"encoding/json"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
@@ -13,10 +12,12 @@ import (
 	"os"
 	pathpkg "path"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"home-podcast/internal/auth"
 	"home-podcast/internal/models"
 )
 
@@ -30,12 +31,85 @@ type TokenValidator interface {
 	IsValidToken(token string) bool
 }
 
+// IdentityValidator is implemented by validators that know who holds a token
+// and which scopes it carries. Tokens accepted by a plain TokenValidator hold
+// every scope.
+type IdentityValidator interface {
+	TokenValidator
+	Identify(token string) (auth.Identity, bool)
+}
+
+// SignedURLValidator is implemented by validators that can also look a token
+// up by its Identity.ID. Signed enclosure URLs name the token by ID, and the
+// lookup lets revoking the token invalidate them.
+type SignedURLValidator interface {
+	IdentityValidator
+	IdentifyID(id string) (auth.Identity, bool)
+}
+
+// SuccessorValidator is implemented by validators that resolve token
+// replacements. Successor returns the token that replaces the one with the
+// given Identity.ID, and its identity, when the successor is valid. The
+// token is empty when only the successor's ID is known.
+type SuccessorValidator interface {
+	IdentityValidator
+	Successor(id string) (string, auth.Identity, bool)
+}
+
 // FeedMetadata describes the static information necessary to render the RSS feed.
+// Empty optional fields are omitted from the feed.
 type FeedMetadata struct {
 	Title       string
 	Description string
 	Language    string
 	Author      string
+	Image       string
+	Categories  []FeedCategory
+	Explicit    *bool
+	OwnerName   string
+	OwnerEmail  string
+	Type        string
+	Copyright   string
+	Link        string
+	Locked      *bool
+	Medium      string
+	Persons     []FeedPerson
+	// PublicURL is the externally visible base URL of the service. The
+	// channel podcast:guid is derived from it, or from the first request's
+	// address when it is empty.
+	PublicURL string
+	// GUIDFile persists the channel podcast:guid so it survives restarts and
+	// address changes. When empty the GUID is kept in memory.
+	GUIDFile string
+	// MaxItems is the default number of episodes per feed page. Zero puts
+	// every episode on one page.
+	MaxItems int
+	// SigningKey enables signed, expiring URLs for the audio, artwork,
+	// chapters and transcripts in feeds, in place of the subscriber's token.
+	// When empty, those URLs carry the token.
+	SigningKey []byte
+	// SignedURLLifetime is how long signed URLs stay valid. Zero selects
+	// defaultSignedURLLifetime.
+	SignedURLLifetime time.Duration
+	// RejectMediaQueryTokens refuses ?token= on the audio, artwork, chapters
+	// and transcript URLs that feeds link to, leaving signed URLs and tokens
+	// sent in headers or the UI cookie. Feed URLs keep accepting ?token=.
+	RejectMediaQueryTokens bool
+}
+
+// FeedPerson credits someone involved in the whole show (podcast:person).
+type FeedPerson struct {
+	Name  string
+	Role  string
+	Group string
+	Image string
+	URL   string
+}
+
+// FeedCategory is an iTunes category with an optional subcategory.
+type FeedCategory struct {
+	Name        string
+	Subcategory string
 }
 
 type serverHandler struct {
@@ -45,10 +119,34 @@ type serverHandler struct {
 	feed      FeedMetadata
 	logger    *log.Logger
 	allowed   map[string]struct{}
+	heartbeat time.Duration
+	instance  string
+	guid      *feedGUID
+	signer    *urlSigner
+	documents documentCache
+	index     episodeIndexCache
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Handler is the HTTP handler returned by New. Close ends long-lived
+// responses such as the /events stream; register it with
+// http.Server.RegisterOnShutdown so graceful shutdown does not wait on them.
+type Handler struct {
+	http.Handler
+	h *serverHandler
+}
+
+// Close terminates open event streams. It is safe to call more than once.
+func (h *Handler) Close() {
+	h.h.closeOnce.Do(func() {
+		close(h.h.done)
+	})
 }
 
 // New creates the HTTP handler that exposes the library API and RSS feed.
-func New(lib EpisodeProvider, validator TokenValidator, audioRoot string, allowedExtensions []string, feed FeedMetadata, logger *log.Logger) http.Handler {
+func New(lib EpisodeProvider, validator TokenValidator, audioRoot string, allowedExtensions []string, feed FeedMetadata, logger *log.Logger) *Handler {
 	if logger == nil {
 		logger = log.Default()
 	}
@@ -75,6 +173,11 @@ func New(lib EpisodeProvider, validator TokenValidator, audioRoot string, allowe
 		feed:      feed,
 		logger:    logger,
 		allowed:   make(map[string]struct{}, len(allowedExtensions)),
+		heartbeat: defaultHeartbeatInterval,
+		instance:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		done:      make(chan struct{}),
+		guid:      newFeedGUID(feed.GUIDFile, logger),
+		signer:    newURLSigner(feed.SigningKey, feed.SignedURLLifetime),
 	}
 	for _, ext := range allowedExtensions {
 		h.allowed[strings.ToLower(ext)] = struct{}{}
@@ -83,14 +186,21 @@ func New(lib EpisodeProvider, validator TokenValidator, audioRoot string, allowe
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", h.handleHealth)
 	mux.HandleFunc("/episodes", h.handleEpisodes)
+	mux.HandleFunc("/episodes/", h.handleEpisode)
+	mux.HandleFunc("/events", h.handleEvents)
 	mux.HandleFunc("/feed", h.handleFeed)
-	mux.HandleFunc("/feed.xml", h.handleFeed)
-	mux.HandleFunc("/rss", h.handleFeed)
+	mux.HandleFunc("/feed.xml", h.serveFeed(rssFormat))
+	mux.HandleFunc("/rss", h.serveFeed(rssFormat))
+	mux.HandleFunc("/feed.atom", h.serveFeed(atomFormat))
+	mux.HandleFunc("/feed.json", h.serveFeed(jsonFeedFormat))
 	mux.HandleFunc("/ui", h.handleUI)
 	mux.HandleFunc("/ui/upload", h.handleUpload)
 	mux.HandleFunc("/audio/", h.handleAudio)
+	mux.HandleFunc("/artwork/", h.handleArtwork)
+	mux.HandleFunc("/chapters/", h.handleChapters)
+	mux.HandleFunc("/transcripts/", h.handleTranscripts)
 
-	return logRequests(mux, logger)
+	return &Handler{Handler: logRequests(compressResponses(mux), logger), h: h}
 }
 
 func (h *serverHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -103,50 +213,168 @@ func (h *serverHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *serverHandler) handleEpisodes(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	if _, ok := h.requireToken(w, r); !ok {
+	if _, ok := h.requireToken(w, r, auth.ScopeRead); !ok {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	episodes := h.lib.ListEpisodes()
-	if err := json.NewEncoder(w).Encode(episodes); err != nil {
+	query, err := parseEpisodeQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idx := h.episodeIndex()
+	result := idx.query(query)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(result.total))
+	if result.next != "" {
+		params := r.URL.Query()
+		params.Set("cursor", result.next)
+		next := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+		w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+		w.Header().Set("X-Next-Cursor", result.next)
+	}
+
+	// The token does not change the list, so it is left out of the key. The
+	// index generation is part of it in case the library changed after the
+	// index was taken.
+	params := r.URL.Query()
+	params.Del("token")
+	key := strings.Join([]string{"episodes", strconv.FormatUint(idx.generation, 10), params.Encode()}, "\x00")
+	doc, err := h.renderDocument(key, func() ([]byte, error) {
+		data, err := json.Marshal(result.episodes)
+		return append(data, '\n'), err
+	})
+	if err != nil {
 		h.logger.Printf("failed to encode episodes: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	serveDocument(w, r, "application/json", doc)
 }
 
-func (h *serverHandler) handleFeed(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleEpisode serves a single episode at /episodes/<id>, where id comes
+// from episodeResourceID.
+func (h *serverHandler) handleEpisode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	token, ok := h.requireToken(w, r)
-	if !ok {
+	if _, ok := h.requireToken(w, r, auth.ScopeRead); !ok {
 		return
 	}
 
-	base := h.requestBaseURL(r)
-	if base == nil {
-		h.logger.Printf("unable to determine request base URL")
-		w.WriteHeader(http.StatusInternalServerError)
+	idx := h.episodeIndex()
+	id := strings.TrimPrefix(r.URL.Path, "/episodes/")
+	episode, ok := idx.lookupID(id)
+	if !ok {
+		http.NotFound(w, r)
 		return
 	}
 
-	data, err := h.buildRSSFeed(base, r.URL.Path, r.URL.RawQuery, h.lib.ListEpisodes(), token)
+	key := strings.Join([]string{"episode", strconv.FormatUint(idx.generation, 10), id}, "\x00")
+	doc, err := h.renderDocument(key, func() ([]byte, error) {
+		data, err := json.Marshal(newEpisodeResource(episode))
+		return append(data, '\n'), err
+	})
 	if err != nil {
-		h.logger.Printf("failed to build RSS feed: %v", err)
+		h.logger.Printf("failed to encode episode %s: %v", episode.RelativePath, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
-	if _, err := w.Write(data); err != nil {
-		h.logger.Printf("failed to write RSS feed: %v", err)
+	serveDocument(w, r, "application/json", doc)
+}
+
+// handleFeed serves /feed in the format the client's Accept header prefers,
+// defaulting to RSS.
+func (h *serverHandler) handleFeed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	h.serveFeed(negotiateFeedFormat(r.Header.Get("Accept")))(w, r)
+}
+
+// serveFeed returns a handler rendering the feed in format.
+func (h *serverHandler) serveFeed(format feedFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		reader, ok := h.requireSubscriber(w, r)
+		if !ok {
+			return
+		}
+
+		base := h.requestBaseURL(r)
+		if base == nil {
+			h.logger.Printf("unable to determine request base URL")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		page, err := parseFeedPage(r.URL.Query(), h.feed.MaxItems)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		self := *base
+		self.Path = r.URL.Path
+		self.RawQuery = r.URL.RawQuery
+
+		// A replaced token keeps working during its grace period, but the
+		// feed hands out its successor so the subscriber moves over.
+		subscriber := h.successor(reader)
+		moved := false
+		if h.signs(subscriber) {
+			// Signed feeds carry no token at all, not even in their own
+			// address.
+			query := self.Query()
+			query.Del("token")
+			for key, values := range h.signer.values(self.Path, subscriber.id, time.Time{}) {
+				query[key] = values
+			}
+			self.RawQuery = query.Encode()
+			moved = subscriber != reader
+		} else if subscriber != reader {
+			if query := self.Query(); query.Has("token") {
+				query.Set("token", subscriber.token)
+				self.RawQuery = query.Encode()
+				moved = true
+			}
+		}
+
+		// The self link depends on the address and query, and the other
+		// URLs on the subscriber, so each combination is cached separately.
+		key := strings.Join([]string{"feed", format.name, subscriber.token, subscriber.id, self.String(), strconv.FormatBool(moved)}, "\x00")
+		doc, err := h.renderDocument(key, func() ([]byte, error) {
+			f, err := h.buildFeed(base, &self, h.lib.ListEpisodes(), subscriber, page)
+			if err != nil {
+				return nil, err
+			}
+			if moved {
+				f.NewFeedURL = f.SelfURL
+			}
+			return format.render(f)
+		})
+		if errors.Is(err, errFeedPageNotFound) {
+			http.Error(w, "feed page not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			h.logger.Printf("failed to build %s feed: %v", format.name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		serveDocument(w, r, format.contentType, doc)
 	}
 }
 
@@ -156,7 +384,7 @@ func (h *serverHandler) handleUI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, ok := h.requireToken(w, r)
+	token, ok := h.requireToken(w, r, auth.ScopeRead)
 	if !ok {
 		return
 	}
@@ -176,7 +404,7 @@ func (h *serverHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := h.requireToken(w, r); !ok {
+	if _, ok := h.requireToken(w, r, auth.ScopeUpload); !ok {
 		return
 	}
 
@@ -237,14 +465,12 @@ func (h *serverHandler) handleAudio(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope := auth.ScopeRead
 	if r.Method == http.MethodDelete {
-		if _, ok := h.requireToken(w, r); !ok {
-			return
-		}
-	} else {
-		if _, ok := h.requireToken(w, r); !ok {
-			return
-		}
+		scope = auth.ScopeDelete
+	}
+	if !h.requireLinkedAccess(w, r, scope) {
+		return
 	}
 
 	rel := strings.TrimPrefix(r.URL.Path, "/audio/")
@@ -301,19 +527,146 @@ func (h *serverHandler) handleAudio(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, resolved)
 }
 
-func (h *serverHandler) requireToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+// requireToken checks that the request carries a valid token holding scope.
+// Missing or unknown tokens get 401 Unauthorized and tokens without the scope
+// 403 Forbidden.
+func (h *serverHandler) requireToken(w http.ResponseWriter, r *http.Request, scope auth.Scope) (string, bool) {
 	if h.validator == nil {
 		return "", true
 	}
 
 	token := extractToken(r)
-	if token == "" || !h.validator.IsValidToken(token) {
+	if token == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	identities, ok := h.validator.(IdentityValidator)
+	if !ok {
+		if !h.validator.IsValidToken(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return "", false
+		}
+		return token, true
+	}
+
+	identity, ok := identities.Identify(token)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return "", false
 	}
+	if !identity.Has(scope) {
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
 	return token, true
 }
 
+// requireLinkedAccess authorises a request for a resource feeds link to:
+// audio, artwork, chapters or transcripts. Reads may present a signed URL;
+// otherwise the request needs a token holding scope, which must not come
+// from the query string when RejectMediaQueryTokens is set.
+func (h *serverHandler) requireLinkedAccess(w http.ResponseWriter, r *http.Request, scope auth.Scope) bool {
+	query := r.URL.Query()
+	switch {
+	case scope == auth.ScopeRead && query.Has(signatureParam):
+		_, ok := h.requireSignature(w, r, false)
+		return ok
+	case h.feed.RejectMediaQueryTokens && query.Has("token"):
+		http.Error(w, "token query parameter not accepted; use a signed URL", http.StatusUnauthorized)
+		return false
+	}
+	_, ok := h.requireToken(w, r, scope)
+	return ok
+}
+
+// requireSubscriber authorises a feed request, made either with a token or
+// through a signed feed address, and returns whom to render the feed for.
+func (h *serverHandler) requireSubscriber(w http.ResponseWriter, r *http.Request) (subscriber, bool) {
+	if r.URL.Query().Has(signatureParam) {
+		id, ok := h.requireSignature(w, r, true)
+		return subscriber{id: id}, ok
+	}
+	token, ok := h.requireToken(w, r, auth.ScopeRead)
+	if !ok {
+		return subscriber{}, false
+	}
+	return h.subscriberFor(token), true
+}
+
+// successor returns whom to render the feed for when reader's token has
+// been replaced: the successor, provided it may read and can be handed out,
+// either as its token or, with signing, by its ID. Otherwise, or when the
+// validator does not know about replacements, reader is returned unchanged.
+func (h *serverHandler) successor(reader subscriber) subscriber {
+	successors, ok := h.validator.(SuccessorValidator)
+	if !ok {
+		return reader
+	}
+	var identity auth.Identity
+	found := false
+	switch {
+	case reader.token != "":
+		identity, found = successors.Identify(reader.token)
+	case reader.id != "":
+		if validator, ok := h.validator.(SignedURLValidator); ok {
+			identity, found = validator.IdentifyID(reader.id)
+		}
+	}
+	if !found || identity.ReplacedBy == "" {
+		return reader
+	}
+
+	token, next, ok := successors.Successor(identity.ID)
+	if !ok || !next.Has(auth.ScopeRead) {
+		return reader
+	}
+	candidate := subscriber{token: token}
+	if _, ok := h.validator.(SignedURLValidator); ok {
+		candidate.id = next.ID
+	}
+	if token == "" && !h.signs(candidate) {
+		return reader
+	}
+	return candidate
+}
+
+// requireSignature checks a signed URL and returns the ID of the token it
+// was issued for. The signature and expiry are verified with the signing key
+// alone; the validator is only asked whether the token the URL names by ID
+// is still listed and may read, so a revoked token's URLs stop working with
+// it. URLs without an expiry are accepted only when permanent is set.
+func (h *serverHandler) requireSignature(w http.ResponseWriter, r *http.Request, permanent bool) (string, bool) {
+	if h.signer == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	tokenID, err := h.signer.verify(r.URL.Path, r.URL.Query(), time.Now(), permanent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	if h.validator == nil {
+		return tokenID, true
+	}
+
+	validator, ok := h.validator.(SignedURLValidator)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	identity, ok := validator.IdentifyID(tokenID)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	if !identity.Has(auth.ScopeRead) {
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+	return tokenID, true
+}
+
 func (h *serverHandler) requestBaseURL(r *http.Request) *url.URL {
 	scheme := "http"
 	if forwarded := strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")); forwarded != "" {
@@ -336,112 +689,6 @@ func (h *serverHandler) requestBaseURL(r *http.Request) *url.URL {
 	return &url.URL{Scheme: scheme, Host: host}
 }
 
-func (h *serverHandler) buildRSSFeed(base *url.URL, requestPath, rawQuery string, episodes []models.Episode, token string) ([]byte, error) {
-	feedURL := *base
-	feedURL.Path = requestPath
-	feedURL.RawQuery = rawQuery
-
-	channelLink := *base
-	channelLink.Path = ""
-	channelLink.RawQuery = ""
-
-	sorted := make([]models.Episode, len(episodes))
-	copy(sorted, episodes)
-	sort.SliceStable(sorted, func(i, j int) bool {
-		iTime := sorted[i].ModifiedAt
-		jTime := sorted[j].ModifiedAt
-		if iTime.Equal(jTime) {
-			return sorted[i].ID > sorted[j].ID
-		}
-		return iTime.After(jTime)
-	})
-
-	lastBuild := time.Time{}
-	for _, ep := range sorted {
-		if !ep.ModifiedAt.IsZero() && (lastBuild.IsZero() || ep.ModifiedAt.After(lastBuild)) {
-			lastBuild = ep.ModifiedAt.UTC()
-		}
-	}
-	if lastBuild.IsZero() {
-		lastBuild = time.Now().UTC()
-	}
-
-	rss := rssFeed{
-		Version:  "2.0",
-		AtomNS:   "http://www.w3.org/2005/Atom",
-		ITunesNS: "http://www.itunes.com/dtds/podcast-1.0.dtd",
-		Channel: rssChannel{
-			Title:         h.feed.Title,
-			Link:          channelLink.String(),
-			Description:   h.feed.Description,
-			Language:      h.feed.Language,
-			LastBuildDate: lastBuild.Format(time.RFC1123Z),
-			Generator:     "home-podcast",
-			AtomLink: rssAtomLink{
-				Href: feedURL.String(),
-				Rel:  "self",
-				Type: "application/rss+xml",
-			},
-		},
-	}
-
-	if h.feed.Author != "" {
-		rss.Channel.ITunesAuthor = h.feed.Author
-	}
-
-	for _, ep := range sorted {
-		enclosureURL := *base
-		enclosureURL.Path = "/" + strings.TrimLeft(pathpkg.Join("audio", ep.RelativePath), "/")
-		enclosureURL.RawQuery = ""
-		if token != "" {
-			values := enclosureURL.Query()
-			values.Set("token", token)
-			enclosureURL.RawQuery = values.Encode()
-		}
-
-		enclosureURL.Scheme = "https"
-
-		item := rssItem{
-			Title: ep.Title,
-			Link:  enclosureURL.String(),
-			GUID:  rssGUID{IsPermaLink: "false", Value: ep.ID},
-			PubDate: func() string {
-				if ep.ModifiedAt.IsZero() {
-					return ""
-				}
-				return ep.ModifiedAt.UTC().Format(time.RFC1123Z)
-			}(),
-			Description: episodeDescription(ep),
-			Enclosure: rssEnclosure{
-				URL:    enclosureURL.String(),
-				Length: ep.FilesizeBytes,
-				Type:   mimeTypeForFilename(ep.Filename),
-			},
-		}
-
-		if ep.DurationSeconds != nil {
-			if formatted := formatDuration(*ep.DurationSeconds); formatted != "" {
-				item.ITunesDuration = formatted
-			}
-		}
-
-		if ep.Artist != nil {
-			item.ITunesAuthor = *ep.Artist
-		} else if h.feed.Author != "" {
-			item.ITunesAuthor = h.feed.Author
-		}
-
-		rss.Channel.Items = append(rss.Channel.Items, item)
-	}
-
-	output, err := xml.MarshalIndent(rss, "", "  ")
-	if err != nil {
-		return nil, err
-	}
-
-	return append([]byte(xml.Header), output...), nil
-}
-
 type statusWriter struct {
 	http.ResponseWriter
 	status int
@@ -459,6 +706,12 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController so
+// streaming handlers can flush and adjust deadlines through the wrapper.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func logRequests(next http.Handler, logger *log.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
@@ -479,10 +732,6 @@ func extractToken(r *http.Request) string {
 	}
 
 	authz := strings.TrimSpace(r.Header.Get("Authorization"))
-	if authz == "" {
-		return ""
-	}
-
 	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
 		return strings.TrimSpace(authz[7:])
 	}
@@ -543,7 +792,41 @@ func pathWithinRoot(root, target string) bool {
 	return rel != ".." && !strings.HasPrefix(rel, "../")
 }
 
+// publicURL builds an absolute https URL for path on the feed host, echoing
+// token as a query parameter so podcast clients can fetch it unattended.
+func publicURL(base *url.URL, path, token string) string {
+	u := *base
+	u.Scheme = "https"
+	u.Path = "/" + strings.TrimLeft(path, "/")
+	u.RawQuery = ""
+	if token != "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String()
+}
+
+// episodeGUID returns the stable identifier published as the RSS guid,
+// falling back to the episode ID for providers that do not assign GUIDs.
+func episodeGUID(ep models.Episode) string {
+	if ep.GUID != "" {
+		return ep.GUID
+	}
+	return ep.ID
+}
+
+// episodePublished returns the publish date from the episode's sidecar,
+// falling back to the file modification time.
+func episodePublished(ep models.Episode) time.Time {
+	if ep.PublishedAt != nil {
+		return *ep.PublishedAt
+	}
+	return ep.ModifiedAt
+}
+
 func episodeDescription(ep models.Episode) string {
+	if ep.Description != "" {
+		return ep.Description
+	}
 	parts := make([]string, 0, 3)
 	if ep.Artist != nil && *ep.Artist != "" {
 		parts = append(parts, *ep.Artist)
@@ -555,6 +838,15 @@ func episodeDescription(ep models.Episode) string {
 	return strings.Join(parts, " – ")
 }
 
+// formatExplicit renders an explicit flag as itunes:explicit expects it,
+// or an empty string when unset.
+func formatExplicit(explicit *bool) string {
+	if explicit == nil {
+		return ""
+	}
+	return strconv.FormatBool(*explicit)
+}
+
 func mimeTypeForFilename(name string) string {
 	ext := strings.ToLower(filepath.Ext(name))
 	if ext != "" {
@@ -586,54 +878,6 @@ func formatDuration(seconds float64) string {
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs)
 }
 
-type rssFeed struct {
-	XMLName  xml.Name   `xml:"rss"`
-	Version  string     `xml:"version,attr"`
-	AtomNS   string     `xml:"xmlns:atom,attr"`
-	ITunesNS string     `xml:"xmlns:itunes,attr"`
-	Channel  rssChannel `xml:"channel"`
-}
-
-type rssChannel struct {
-	Title         string      `xml:"title"`
-	Link          string      `xml:"link"`
-	Description   string      `xml:"description"`
-	Language      string      `xml:"language,omitempty"`
-	LastBuildDate string      `xml:"lastBuildDate"`
-	Generator     string      `xml:"generator"`
-	AtomLink      rssAtomLink `xml:"atom:link"`
-	ITunesAuthor  string      `xml:"itunes:author,omitempty"`
-	Items         []rssItem   `xml:"item"`
-}
-
-type rssAtomLink struct {
-	Href string `xml:"href,attr"`
-	Rel  string `xml:"rel,attr"`
-	Type string `xml:"type,attr"`
-}
-
-type rssItem struct {
-	Title          string       `xml:"title"`
-	Link           string       `xml:"link"`
-	GUID           rssGUID      `xml:"guid"`
-	PubDate        string       `xml:"pubDate,omitempty"`
-	Description    string       `xml:"description"`
-	Enclosure      rssEnclosure `xml:"enclosure"`
-	ITunesDuration string       `xml:"itunes:duration,omitempty"`
-	ITunesAuthor   string       `xml:"itunes:author,omitempty"`
-}
-
-type rssGUID struct {
-	IsPermaLink string `xml:"isPermaLink,attr"`
-	Value       string `xml:",chardata"`
-}
-
-type rssEnclosure struct {
-	URL    string `xml:"url,attr"`
-	Length int64  `xml:"length,attr"`
-	Type   string `xml:"type,attr"`
-}
-
 const uiPage = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -722,6 +966,8 @@ const uiPage = `<!DOCTYPE html>
 			return relPath.split('/').map(encodeURIComponent).join('/');
 		}
 
+		let episodes = [];
+
 		async function loadEpisodes() {
 			statusEl.textContent = '';
 			try {
@@ -729,7 +975,8 @@ const uiPage = `<!DOCTYPE html>
 				if (!res.ok) throw new Error('Request failed with ' + res.status);
 				const data = await res.json();
 				if (!Array.isArray(data)) throw new Error('Unexpected response');
-				renderEpisodes(data);
+				episodes = data;
+				renderEpisodes(episodes);
 			} catch (err) {
 				tableBody.innerHTML = '<tr><td colspan="5">Failed to load episodes.</td></tr>';
 				statusEl.textContent = err.message;
@@ -827,9 +1074,33 @@ const uiPage = `<!DOCTYPE html>
 			}
 		});
 
+		function applyChange(change) {
+			const previous = change.old || change.new;
+			if (!previous) return;
+			episodes = episodes.filter((item) => item.relative_path !== previous.relative_path);
+			if (change.new) episodes.push(change.new);
+			episodes.sort((a, b) => (a.relative_path < b.relative_path ? -1 : a.relative_path > b.relative_path ? 1 : 0));
+			renderEpisodes(episodes);
+		}
+
+		function connectEvents() {
+			const source = new EventSource('/events');
+			for (const type of ['added', 'removed', 'modified']) {
+				source.addEventListener(type, (event) => applyChange(JSON.parse(event.data)));
+			}
+			// "ready" arrives on every fresh connection and "reset" when the
+			// server cannot replay missed changes; both call for a full reload.
+			source.addEventListener('ready', loadEpisodes);
+			source.addEventListener('reset', loadEpisodes);
+		}
+
 		document.getElementById('refreshBtn').addEventListener('click', loadEpisodes);
 
-		loadEpisodes();
+		if (window.EventSource) {
+			connectEvents();
+		} else {
+			loadEpisodes();
+		}
 	</script>
 </body>
 </html>`
@@ -5,17 +5,21 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
+	"html"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"home-podcast/internal/auth"
 	"home-podcast/internal/models"
 )
 
@@ -100,7 +104,7 @@ func TestEpisodesEndpoint(t *testing.T) {
 		t.Fatalf("unmarshal: %v", err)
 	}
 
-	if len(payload) != 1 || payload[0].ID != "ep1" {
+	if len(payload) != 1 || payload[0].ID != episodeResourceID(episodes[0]) {
 		t.Fatalf("unexpected payload: %+v", payload)
 	}
 }
@@ -157,6 +161,7 @@ func TestFeedEndpointProducesRSS(t *testing.T) {
 	episodes := []models.Episode{
 		{
 			ID:            "episode-1",
+			GUID:          "5f0c6a34-7d1e-4d8a-9b0e-2f4f1c9d8e71",
 			Filename:      "episode-1.mp3",
 			RelativePath:  "episode-1.mp3",
 			Title:         "Episode 1",
@@ -194,6 +199,7 @@ func TestFeedEndpointProducesRSS(t *testing.T) {
 			Title string `xml:"title"`
 			Items []struct {
 				Title     string `xml:"title"`
+				GUID      string `xml:"guid"`
 				Enclosure struct {
 					URL string `xml:"url,attr"`
 				} `xml:"enclosure"`
@@ -221,6 +227,61 @@ func TestFeedEndpointProducesRSS(t *testing.T) {
 	if item.ITunesDuration == "" {
 		t.Fatalf("expected itunes duration field")
 	}
+	if item.GUID != "5f0c6a34-7d1e-4d8a-9b0e-2f4f1c9d8e71" {
+		t.Fatalf("expected stable episode GUID, got %q", item.GUID)
+	}
+}
+
+func TestFeedUsesSidecarMetadata(t *testing.T) {
+	published := time.Date(2020, 5, 17, 8, 0, 0, 0, time.UTC)
+	episodes := []models.Episode{
+		{
+			ID:           "old.mp3",
+			Filename:     "old.mp3",
+			RelativePath: "old.mp3",
+			Title:        "Old",
+			Description:  "Recorded long ago.",
+			PublishedAt:  &published,
+			ModifiedAt:   time.Unix(1700000000, 0).UTC(),
+			Links:        []models.Link{{Title: "Notes", URL: "https://example.com/old"}},
+		},
+		{
+			ID:           "new.mp3",
+			Filename:     "new.mp3",
+			RelativePath: "new.mp3",
+			Title:        "New",
+			ModifiedAt:   time.Unix(1600000000, 0).UTC(),
+		},
+	}
+	handler := New(&fakeLibrary{episodes: episodes}, nil, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var payload struct {
+		Channel struct {
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				PubDate     string `xml:"pubDate"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+	if len(payload.Channel.Items) != 2 || payload.Channel.Items[0].Title != "New" {
+		t.Fatalf("expected items ordered by publish date, got %+v", payload.Channel.Items)
+	}
+	old := payload.Channel.Items[1]
+	if old.PubDate != published.Format(time.RFC1123Z) {
+		t.Fatalf("expected sidecar publish date, got %q", old.PubDate)
+	}
+	if old.Description != "Recorded long ago." || old.Link != "https://example.com/old" {
+		t.Fatalf("expected sidecar description and link, got %+v", old)
+	}
 }
 
 func TestFeedEndpointRequiresToken(t *testing.T) {
@@ -390,6 +451,13 @@ func TestExtractToken(t *testing.T) {
 			},
 			want: "ctoken",
 		},
+		{
+			name: "cookie without auth header",
+			setup: func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: authCookieName, Value: "ctoken"})
+			},
+			want: "ctoken",
+		},
 		{
 			name:  "no token",
 			setup: func(r *http.Request) {},
@@ -780,6 +848,370 @@ func TestAudioEndpointDeleteRequiresToken(t *testing.T) {
 	}
 }
 
+// The token store must keep satisfying the scope-aware interface.
+var _ IdentityValidator = (*auth.TokenStore)(nil)
+
+type fakeIdentityValidator map[string]auth.Identity
+
+func (f fakeIdentityValidator) IsValidToken(token string) bool {
+	_, ok := f[token]
+	return ok
+}
+
+func (f fakeIdentityValidator) Identify(token string) (auth.Identity, bool) {
+	identity, ok := f[token]
+	return identity, ok
+}
+
+func TestTokenScopes(t *testing.T) {
+	audioDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(audioDir, "clip.mp3"), []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio file: %v", err)
+	}
+	validator := fakeIdentityValidator{
+		"listener": {Name: "listener", Scopes: []auth.Scope{auth.ScopeRead}},
+		"uploader": {Scopes: []auth.Scope{auth.ScopeUpload}},
+		"admin":    {Scopes: auth.AllScopes},
+	}
+	handler := New(&fakeLibrary{}, validator, audioDir, []string{".mp3"}, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	upload := func(token, name string) int {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte("fake audio data"))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/ui/upload?token="+token, &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, path := range []string{"/episodes", "/feed", "/audio/clip.mp3", "/ui"} {
+		if code := request(http.MethodGet, path, "listener"); code != http.StatusOK {
+			t.Fatalf("GET %s with read scope: expected 200, got %d", path, code)
+		}
+		if code := request(http.MethodGet, path, "uploader"); code != http.StatusForbidden {
+			t.Fatalf("GET %s without read scope: expected 403, got %d", path, code)
+		}
+	}
+	if code := request(http.MethodGet, "/episodes", "stranger"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown token, got %d", code)
+	}
+
+	if code := upload("listener", "one.mp3"); code != http.StatusForbidden {
+		t.Fatalf("expected upload without upload scope to be forbidden, got %d", code)
+	}
+	if code := upload("uploader", "one.mp3"); code != http.StatusOK {
+		t.Fatalf("expected upload with upload scope to succeed, got %d", code)
+	}
+
+	for _, token := range []string{"listener", "uploader"} {
+		if code := request(http.MethodDelete, "/audio/clip.mp3", token); code != http.StatusForbidden {
+			t.Fatalf("expected delete by %s to be forbidden, got %d", token, code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(audioDir, "clip.mp3")); err != nil {
+		t.Fatalf("expected forbidden delete to keep the file: %v", err)
+	}
+	if code := request(http.MethodDelete, "/audio/clip.mp3", "admin"); code != http.StatusNoContent {
+		t.Fatalf("expected delete with delete scope to succeed, got %d", code)
+	}
+}
+
+// fakeSuccessorValidator resolves ReplacedBy against the names and IDs of
+// the identities it holds.
+type fakeSuccessorValidator struct {
+	fakeIdentityValidator
+}
+
+func (f fakeSuccessorValidator) Successor(id string) (string, auth.Identity, bool) {
+	for _, identity := range f.fakeIdentityValidator {
+		if identity.ID != id || identity.ReplacedBy == "" {
+			continue
+		}
+		for token, successor := range f.fakeIdentityValidator {
+			if successor.Name == identity.ReplacedBy || successor.ID == identity.ReplacedBy {
+				return token, successor, true
+			}
+		}
+	}
+	return "", auth.Identity{}, false
+}
+
+func TestFeedHandsOutReplacementToken(t *testing.T) {
+	validator := fakeSuccessorValidator{fakeIdentityValidator{
+		"old":     {ID: "old-id", Scopes: []auth.Scope{auth.ScopeRead}, ReplacedBy: "grandma"},
+		"new":     {ID: "new-id", Name: "grandma", Scopes: []auth.Scope{auth.ScopeRead}},
+		"retired": {ID: "retired-id", Scopes: []auth.Scope{auth.ScopeRead}, ReplacedBy: "missing"},
+	}}
+	episodes := []models.Episode{{ID: "one.mp3", RelativePath: "one.mp3", Title: "One"}}
+	handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	fetch := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	body := fetch("/feed?token=old")
+	for _, want := range []string{
+		"/audio/one.mp3?token=new",
+		`<atom:link href="http://example.com/feed?token=new" rel="self"`,
+		"<itunes:new-feed-url>http://example.com/feed?token=new</itunes:new-feed-url>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected feed for replaced token to contain %q, got %s", want, body)
+		}
+	}
+	if strings.Contains(body, "token=old") {
+		t.Fatalf("expected replaced token to be absent from the feed, got %s", body)
+	}
+
+	body = fetch("/feed?token=new")
+	if !strings.Contains(body, "/audio/one.mp3?token=new") || strings.Contains(body, "new-feed-url") {
+		t.Fatalf("expected plain feed for the new token, got %s", body)
+	}
+
+	body = fetch("/feed?token=retired")
+	if !strings.Contains(body, "/audio/one.mp3?token=retired") || strings.Contains(body, "new-feed-url") {
+		t.Fatalf("expected unknown replacement to be ignored, got %s", body)
+	}
+}
+
+// fakeSignedValidator looks tokens up by ID as well, using the ID field of
+// the identities it holds.
+type fakeSignedValidator struct {
+	fakeIdentityValidator
+}
+
+func (f fakeSignedValidator) IdentifyID(id string) (auth.Identity, bool) {
+	for _, identity := range f.fakeIdentityValidator {
+		if identity.ID == id {
+			return identity, true
+		}
+	}
+	return auth.Identity{}, false
+}
+
+func TestSignedEnclosureURLs(t *testing.T) {
+	audioDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(audioDir, "one.mp3"), []byte("audio"), 0o644); err != nil {
+		t.Fatalf("write audio file: %v", err)
+	}
+	validator := fakeSignedValidator{fakeIdentityValidator{
+		"listener": {Scopes: []auth.Scope{auth.ScopeRead}, ID: "listener-id"},
+		"uploader": {Scopes: []auth.Scope{auth.ScopeUpload}, ID: "uploader-id"},
+	}}
+	episodes := []models.Episode{{ID: "one.mp3", RelativePath: "one.mp3", Title: "One"}}
+	meta := testFeedMetadata()
+	meta.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	meta.RejectMediaQueryTokens = true
+	handler := New(&fakeLibrary{episodes: episodes}, validator, audioDir, []string{".mp3"}, meta, log.New(io.Discard, "", 0))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/feed?token=listener")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected feed, got %d", rec.Code)
+	}
+	var doc struct {
+		Items []struct {
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil || len(doc.Items) != 1 {
+		t.Fatalf("parse feed: %v", err)
+	}
+	enclosure, err := url.Parse(doc.Items[0].Enclosure.URL)
+	if err != nil {
+		t.Fatalf("parse enclosure URL: %v", err)
+	}
+	query := enclosure.Query()
+	if query.Has("token") || query.Get("kid") != "listener-id" || query.Get("sig") == "" || query.Get("exp") == "" {
+		t.Fatalf("expected signed enclosure without the token, got %s", enclosure)
+	}
+	if strings.Contains(rec.Body.String(), "audio/one.mp3?token=") {
+		t.Fatalf("expected no tokenized audio URLs in the feed")
+	}
+
+	signed := enclosure.RequestURI()
+	if rec := get(signed); rec.Code != http.StatusOK || rec.Body.String() != "audio" {
+		t.Fatalf("expected signed URL to serve audio, got %d", rec.Code)
+	}
+	if rec := get(strings.Replace(signed, "one.mp3", "two.mp3", 1)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected signature for another path to be rejected, got %d", rec.Code)
+	}
+	if rec := get("/audio/one.mp3?token=listener"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected query token to be refused, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/audio/one.mp3", nil)
+	req.Header.Set("Authorization", "Bearer listener")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected header token to keep working, got %d", rec.Code)
+	}
+
+	forged := handler.h.signer.sign("/audio/one.mp3", "uploader-id", time.Now().Add(time.Hour))
+	if rec := get("/audio/one.mp3?" + forged); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected signed URL for a token without read scope to be forbidden, got %d", rec.Code)
+	}
+
+	delete(validator.fakeIdentityValidator, "listener")
+	if rec := get(signed); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoking the token to invalidate its signed URLs, got %d", rec.Code)
+	}
+}
+
+func TestSignedFeedsCarryNoToken(t *testing.T) {
+	audioDir := t.TempDir()
+	for name, content := range map[string]string{"one.mp3": "audio", "one.vtt": "WEBVTT\n"} {
+		if err := os.WriteFile(filepath.Join(audioDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	validator := fakeSignedValidator{fakeIdentityValidator{
+		"listener": {Scopes: []auth.Scope{auth.ScopeRead}, ID: "listener-id"},
+	}}
+	lib := &fakeArtworkLibrary{
+		fakeLibrary: fakeLibrary{episodes: []models.Episode{{
+			ID: "one.mp3", RelativePath: "one.mp3", Filename: "one.mp3", Title: "One",
+			ArtworkID:           testArtworkID,
+			Chapters:            []models.Chapter{{Title: "Intro"}},
+			Transcripts:         []models.Transcript{{Path: "one.vtt", Type: "text/vtt"}},
+			AlternateEnclosures: []models.AlternateEnclosure{{Path: "one.mp3", Type: "audio/mpeg"}},
+		}}},
+		images: map[string][]byte{testArtworkID: pngHeader},
+	}
+	meta := testFeedMetadata()
+	meta.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	meta.RejectMediaQueryTokens = true
+	handler := New(lib, validator, audioDir, []string{".mp3"}, meta, log.New(io.Discard, "", 0))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	links := regexp.MustCompile(`https?://example\.com/[^"<\s]*`)
+	for _, path := range []string{"/feed", "/feed.atom", "/feed.json"} {
+		rec := get(path + "?token=listener")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		body := rec.Body.String()
+		if strings.Contains(body, "token=") {
+			t.Fatalf("%s: expected no token in a signed feed, got %s", path, body)
+		}
+
+		found := map[string]bool{}
+		for _, link := range links.FindAllString(body, -1) {
+			link = html.UnescapeString(strings.ReplaceAll(link, `\u0026`, "&"))
+			u, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parse %s: %v", link, err)
+			}
+			resource, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+			found[resource] = true
+			if rec := get(u.RequestURI()); rec.Code != http.StatusOK {
+				t.Fatalf("%s: expected signed link %s to work, got %d", path, link, rec.Code)
+			}
+		}
+		for _, resource := range []string{"audio", "artwork", "chapters", "transcripts"} {
+			if !found[resource] {
+				t.Fatalf("%s: expected a signed %s link, got %s", path, resource, body)
+			}
+		}
+	}
+
+	for _, target := range []string{"/artwork/" + testArtworkID, "/chapters/one.mp3.json", "/transcripts/one.vtt"} {
+		if rec := get(target + "?token=listener"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected query token on %s to be refused, got %d", target, rec.Code)
+		}
+	}
+
+	self := "/feed?" + handler.h.signer.values("/feed", "listener-id", time.Time{}).Encode()
+	if rec := get(self); rec.Code != http.StatusOK {
+		t.Fatalf("expected the signed feed address to work, got %d", rec.Code)
+	}
+	audio := "/audio/one.mp3?" + handler.h.signer.values("/audio/one.mp3", "listener-id", time.Time{}).Encode()
+	if rec := get(audio); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a signed audio URL without expiry to be refused, got %d", rec.Code)
+	}
+	delete(validator.fakeIdentityValidator, "listener")
+	if rec := get(self); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoking the token to invalidate its feed address, got %d", rec.Code)
+	}
+}
+
+// fakeHashedSuccessorValidator resolves replacements like
+// fakeSuccessorValidator but, as for successors stored as hashes, never knows
+// the successor's token.
+type fakeHashedSuccessorValidator struct {
+	fakeSignedValidator
+}
+
+func (f fakeHashedSuccessorValidator) Successor(id string) (string, auth.Identity, bool) {
+	_, successor, ok := fakeSuccessorValidator{f.fakeIdentityValidator}.Successor(id)
+	return "", successor, ok
+}
+
+func TestSignedFeedHandsOutHashedSuccessor(t *testing.T) {
+	validator := fakeHashedSuccessorValidator{fakeSignedValidator{fakeIdentityValidator{
+		"old": {ID: "old-id", Scopes: []auth.Scope{auth.ScopeRead}, ReplacedBy: "laptop"},
+		"new": {ID: "new-id", Name: "laptop", Scopes: []auth.Scope{auth.ScopeRead}},
+	}}}
+	episodes := []models.Episode{{ID: "one.mp3", RelativePath: "one.mp3", Title: "One"}}
+	fetch := func(meta FeedMetadata, target string) string {
+		handler := New(&fakeLibrary{episodes: episodes}, validator, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", target, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	body := fetch(testFeedMetadata(), "/feed?token=old")
+	if !strings.Contains(body, "/audio/one.mp3?token=old") || strings.Contains(body, "new-feed-url") {
+		t.Fatalf("expected a hashed successor to be ignored without signing, got %s", body)
+	}
+
+	signed := testFeedMetadata()
+	signed.SigningKey = []byte("0123456789abcdef0123456789abcdef")
+	oldAddress := "/feed?" + newURLSigner(signed.SigningKey, 0).values("/feed", "old-id", time.Time{}).Encode()
+	for _, target := range []string{"/feed?token=old", oldAddress} {
+		body := fetch(signed, target)
+		newFeed := regexp.MustCompile(`<itunes:new-feed-url>([^<]*)</itunes:new-feed-url>`).FindStringSubmatch(body)
+		if newFeed == nil || !strings.Contains(newFeed[1], "kid=new-id") || strings.Contains(body, "old-id") || strings.Contains(body, "token=") {
+			t.Fatalf("%s: expected the feed to move to the successor's signed address, got %s", target, body)
+		}
+	}
+}
+
 func TestAudioEndpointNotFound(t *testing.T) {
 	audioDir := t.TempDir()
 	handler := New(&fakeLibrary{}, nil, audioDir, nil, testFeedMetadata(), log.New(io.Discard, "", 0))
@@ -890,3 +1322,91 @@ func TestFeedEndpointEmptyHost(t *testing.T) {
 		t.Fatalf("expected 500 for empty host, got %d", rec.Code)
 	}
 }
+
+func TestFeedITunesMetadata(t *testing.T) {
+	season, number, explicit := 2, 7, true
+	episodes := []models.Episode{
+		{
+			ID: "full.mp3", RelativePath: "full.mp3", Filename: "full.mp3", Title: "Full",
+			Description: "Show notes.", Season: &season, EpisodeNumber: &number, Explicit: &explicit, EpisodeType: "trailer",
+			ModifiedAt: time.Unix(1700000000, 0).UTC(),
+		},
+		{ID: "bare.mp3", RelativePath: "bare.mp3", Filename: "bare.mp3", Title: "Bare", ModifiedAt: time.Unix(1600000000, 0).UTC()},
+	}
+
+	notExplicit := false
+	meta := testFeedMetadata()
+	meta.Image = "https://example.com/show.png"
+	meta.Categories = []FeedCategory{{Name: "Technology"}, {Name: "Society & Culture", Subcategory: "Documentary"}}
+	meta.Explicit = &notExplicit
+	meta.OwnerName = "Owner"
+	meta.OwnerEmail = "owner@example.com"
+	meta.Type = "serial"
+	meta.Copyright = "2026 Owner"
+	meta.Link = "https://example.com"
+
+	render := func(meta FeedMetadata) string {
+		handler := New(&fakeLibrary{episodes: episodes}, nil, t.TempDir(), nil, meta, log.New(io.Discard, "", 0))
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	type category struct {
+		Text string    `xml:"text,attr"`
+		Sub  *category `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+	}
+	var payload struct {
+		Channel struct {
+			Copyright  string     `xml:"copyright"`
+			Categories []category `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+			Image      struct {
+				Href string `xml:"href,attr"`
+			} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+			Explicit string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+			Type     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd type"`
+			Owner    struct {
+				Name  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd name"`
+				Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email"`
+			} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner"`
+			Items []struct {
+				Summary     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+				Episode     string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+				Season      string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+				EpisodeType string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episodeType"`
+				Explicit    string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	body := render(meta)
+	if err := xml.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+	ch := payload.Channel
+	if !strings.Contains(body, "<link>https://example.com</link>") || ch.Copyright != "2026 Owner" || ch.Image.Href != "https://example.com/show.png" ||
+		ch.Explicit != "false" || ch.Type != "serial" || ch.Owner.Name != "Owner" || ch.Owner.Email != "owner@example.com" {
+		t.Fatalf("unexpected channel metadata %+v", ch)
+	}
+	if len(ch.Categories) != 2 || ch.Categories[0].Text != "Technology" || ch.Categories[0].Sub != nil ||
+		ch.Categories[1].Sub == nil || ch.Categories[1].Sub.Text != "Documentary" {
+		t.Fatalf("unexpected categories %+v", ch.Categories)
+	}
+	full := ch.Items[0]
+	if full.Summary != "Show notes." || full.Episode != "7" || full.Season != "2" || full.EpisodeType != "trailer" || full.Explicit != "true" {
+		t.Fatalf("unexpected item metadata %+v", full)
+	}
+
+	for _, element := range []string{"<itunes:summary>", "<itunes:episode>", "<itunes:season>", "<itunes:episodeType>"} {
+		if strings.Count(body, element) != 1 {
+			t.Fatalf("expected %s only on the tagged item:\n%s", element, body)
+		}
+	}
+
+	bare, _, _ := strings.Cut(render(testFeedMetadata()), "<item>")
+	for _, element := range []string{"<copyright>", "<itunes:category", "<itunes:explicit>", "<itunes:owner>", "<itunes:type>", "<itunes:image"} {
+		if strings.Contains(bare, element) {
+			t.Fatalf("expected %s to be omitted without configuration:\n%s", element, bare)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed URLs carry these query parameters in place of the token.
+const (
+	signatureParam = "sig"
+	expiresParam   = "exp"
+	tokenIDParam   = "kid"
+)
+
+// defaultSignedURLLifetime applies when signing is enabled without a
+// lifetime.
+const defaultSignedURLLifetime = 72 * time.Hour
+
+var (
+	errSignatureInvalid  = errors.New("invalid URL signature")
+	errSignatureExpired  = errors.New("signed URL expired")
+	errSignatureNoExpiry = errors.New("signed URL lacks an expiry")
+)
+
+// urlSigner signs paths with HMAC-SHA256, so feeds can hand out URLs that
+// identify the subscriber's token by its ID rather than carrying the token
+// itself. URLs of feed resources expire; feed addresses do not, since
+// podcast apps keep them, and are bounded by the token's own validity.
+type urlSigner struct {
+	key      []byte
+	lifetime time.Duration
+}
+
+// newURLSigner returns nil when key is empty, which leaves signing off.
+func newURLSigner(key []byte, lifetime time.Duration) *urlSigner {
+	if len(key) == 0 {
+		return nil
+	}
+	if lifetime <= 0 {
+		lifetime = defaultSignedURLLifetime
+	}
+	return &urlSigner{key: key, lifetime: lifetime}
+}
+
+// expiry returns when URLs signed at now expire. The signing time is rounded
+// down to a quarter of the lifetime, so feeds rendered in the meantime carry
+// identical URLs and keep their ETag, while every URL stays valid for at
+// least three quarters of the lifetime.
+func (s *urlSigner) expiry(now time.Time) time.Time {
+	step := max(s.lifetime/4, time.Second)
+	return now.Truncate(step).Add(s.lifetime)
+}
+
+// sign returns the query string authorising path for the token with the
+// given ID until expires.
+func (s *urlSigner) sign(path, tokenID string, expires time.Time) string {
+	return s.values(path, tokenID, expires).Encode()
+}
+
+// values returns the query parameters authorising path for the token with
+// the given ID until expires, or indefinitely when expires is zero.
+func (s *urlSigner) values(path, tokenID string, expires time.Time) url.Values {
+	var exp int64
+	values := url.Values{tokenIDParam: {tokenID}}
+	if !expires.IsZero() {
+		exp = expires.Unix()
+		values.Set(expiresParam, strconv.FormatInt(exp, 10))
+	}
+	values.Set(signatureParam, base64.RawURLEncoding.EncodeToString(s.mac(path, tokenID, exp)))
+	return values
+}
+
+// verify checks the signature in query against path and returns the ID of
+// the token the URL was issued for. It needs nothing but the key. URLs
+// without an expiry are accepted only when permanent is set.
+func (s *urlSigner) verify(path string, query url.Values, now time.Time, permanent bool) (string, error) {
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(signatureParam))
+	if err != nil {
+		return "", errSignatureInvalid
+	}
+	var exp int64
+	if query.Has(expiresParam) {
+		if exp, err = strconv.ParseInt(query.Get(expiresParam), 10, 64); err != nil || exp == 0 {
+			return "", errSignatureInvalid
+		}
+	}
+	tokenID := query.Get(tokenIDParam)
+	if !hmac.Equal(signature, s.mac(path, tokenID, exp)) {
+		return "", errSignatureInvalid
+	}
+	switch {
+	case exp == 0 && !permanent:
+		return "", errSignatureNoExpiry
+	case exp != 0 && !now.Before(time.Unix(exp, 0)):
+		return "", errSignatureExpired
+	}
+	return tokenID, nil
+}
+
+// mac covers the path, the expiry, zero for none, and the token ID, each
+// terminated so no two combinations produce the same input.
+func (s *urlSigner) mac(path, tokenID string, exp int64) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(path))
+	m.Write([]byte{0})
+	m.Write([]byte(strconv.FormatInt(exp, 10)))
+	m.Write([]byte{0})
+	m.Write([]byte(tokenID))
+	return m.Sum(nil)
+}
+
+// SignedFeedURL returns the address of the feed under base for the token
+// with the given ID, signed with key the way feeds sign links to themselves.
+// It needs no token, so it also serves tokens stored as hashes, and it works
+// for as long as the token is listed and valid.
+func SignedFeedURL(base *url.URL, key []byte, tokenID string) string {
+	u := *base
+	u.Path = strings.TrimRight(u.Path, "/") + "/feed"
+	// The server sees /feed whatever prefix a reverse proxy strips.
+	u.RawQuery = newURLSigner(key, 0).sign("/feed", tokenID, time.Time{})
+	return u.String()
+}
+
+// signingEpoch names the period whose feeds share signed URLs, for use in
+// cache versions. It is empty when signing is off.
+func (h *serverHandler) signingEpoch() string {
+	if h.signer == nil {
+		return ""
+	}
+	return strconv.FormatInt(h.signer.expiry(time.Now()).Unix(), 10)
+}
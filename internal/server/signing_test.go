@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestURLSignerSignsAndVerifies(t *testing.T) {
+	signer := newURLSigner([]byte("0123456789abcdef0123456789abcdef"), 4*time.Hour)
+	now := time.Date(2026, 10, 16, 13, 30, 0, 0, time.UTC)
+
+	expires := signer.expiry(now)
+	if want := time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC); !expires.Equal(want) {
+		t.Fatalf("expected expiry four hours after the full hour (%v), got %v", want, expires)
+	}
+	if later := signer.expiry(now.Add(25 * time.Minute)); !later.Equal(expires) {
+		t.Fatalf("expected URLs signed within one step to share an expiry, got %v and %v", expires, later)
+	}
+
+	query, err := url.ParseQuery(signer.sign("/audio/show/one.mp3", "kid-1", expires))
+	if err != nil {
+		t.Fatalf("parse signed query: %v", err)
+	}
+	if id, err := signer.verify("/audio/show/one.mp3", query, now, false); err != nil || id != "kid-1" {
+		t.Fatalf("expected valid signature, got %q, %v", id, err)
+	}
+
+	if _, err := signer.verify("/audio/show/two.mp3", query, now, false); !errors.Is(err, errSignatureInvalid) {
+		t.Fatalf("expected signature to be bound to the path, got %v", err)
+	}
+	for param, value := range map[string]string{
+		tokenIDParam:   "kid-2",
+		expiresParam:   "99999999999",
+		signatureParam: "not-base64!",
+	} {
+		tampered := url.Values{}
+		for key, values := range query {
+			tampered[key] = values
+		}
+		tampered.Set(param, value)
+		if _, err := signer.verify("/audio/show/one.mp3", tampered, now, false); !errors.Is(err, errSignatureInvalid) {
+			t.Fatalf("expected tampered %s to be rejected, got %v", param, err)
+		}
+	}
+	if _, err := signer.verify("/audio/show/one.mp3", query, expires, false); !errors.Is(err, errSignatureExpired) {
+		t.Fatalf("expected expired signature to be rejected, got %v", err)
+	}
+
+	other := newURLSigner([]byte("another key of thirty-two bytes!"), 4*time.Hour)
+	if _, err := other.verify("/audio/show/one.mp3", query, now, false); !errors.Is(err, errSignatureInvalid) {
+		t.Fatalf("expected signature from another key to be rejected, got %v", err)
+	}
+}
+
+func TestURLSignerPermanentURLs(t *testing.T) {
+	signer := newURLSigner([]byte("0123456789abcdef0123456789abcdef"), 4*time.Hour)
+	now := time.Date(2026, 10, 16, 13, 30, 0, 0, time.UTC)
+
+	query := signer.values("/feed", "kid-1", time.Time{})
+	if query.Has(expiresParam) {
+		t.Fatalf("expected no expiry on a permanent URL, got %v", query)
+	}
+	if id, err := signer.verify("/feed", query, now.AddDate(10, 0, 0), true); err != nil || id != "kid-1" {
+		t.Fatalf("expected the permanent URL to stay valid, got %q, %v", id, err)
+	}
+	if _, err := signer.verify("/feed", query, now, false); !errors.Is(err, errSignatureNoExpiry) {
+		t.Fatalf("expected a permanent URL to be refused where an expiry is required, got %v", err)
+	}
+
+	u, err := url.Parse(SignedFeedURL(&url.URL{Scheme: "https", Host: "podcast.example", Path: "/base/"}, signer.key, "kid-1"))
+	if err != nil || u.Path != "/base/feed" {
+		t.Fatalf("expected a feed address under the base path, got %v, %v", u, err)
+	}
+	if id, err := signer.verify("/feed", u.Query(), now, true); err != nil || id != "kid-1" {
+		t.Fatalf("expected SignedFeedURL to verify as a permanent feed URL, got %q, %v", id, err)
+	}
+
+	timed := signer.values("/feed", "kid-1", signer.expiry(now))
+	timed.Del(expiresParam)
+	if _, err := signer.verify("/feed", timed, now, true); !errors.Is(err, errSignatureInvalid) {
+		t.Fatalf("expected stripping the expiry to invalidate the signature, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"home-podcast/internal/auth"
+	"home-podcast/internal/models"
+)
+
+const (
+	vttContentType = "text/vtt; charset=utf-8"
+	srtContentType = "application/x-subrip"
+)
+
+// handleTranscripts serves the transcript files listed on episodes at
+// /transcripts/<relative path>. SubRip files are converted to WebVTT when
+// the request asks for ?format=vtt.
+func (h *serverHandler) handleTranscripts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireLinkedAccess(w, r, auth.ScopeRead) {
+		return
+	}
+
+	rel := strings.TrimPrefix(pathpkg.Clean("/"+strings.TrimPrefix(r.URL.Path, "/transcripts/")), "/")
+	transcript, ok := h.episodeIndex().lookupTranscript(rel)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	target := filepath.Join(h.audioRoot, filepath.FromSlash(rel))
+	if !pathWithinRoot(h.audioRoot, target) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "vtt" {
+		h.httpError(w, "unsupported transcript format", http.StatusBadRequest, nil)
+		return
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.logger.Printf("failed to open transcript %s: %v", target, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		h.logger.Printf("failed to stat transcript %s: %v", target, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	contentType := transcriptContentType(transcript.Type)
+	if format == "vtt" && transcript.Type == srtContentType {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			h.logger.Printf("failed to read transcript %s: %v", target, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", vttContentType)
+		http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(srtToVTT(data)))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+func transcriptContentType(mimeType string) string {
+	if mimeType == "text/vtt" {
+		return vttContentType
+	}
+	return mimeType
+}
+
+// transcriptURL returns the public URL of a transcript file.
+func transcriptURL(transcript models.Transcript, resourceURL func(path string) string) string {
+	return resourceURL(pathpkg.Join("/transcripts", transcript.Path))
+}
+
+// srtTimingPattern matches SubRip cue timings, whose millisecond separator
+// is a comma where WebVTT uses a full stop.
+var srtTimingPattern = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})\s*-->\s*(\d{2}:\d{2}:\d{2}),(\d{3})`)
+
+// srtToVTT converts a SubRip document to WebVTT. Cue numbers are kept as
+// cue identifiers, which WebVTT allows.
+func srtToVTT(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	data = srtTimingPattern.ReplaceAll(data, []byte("$1.$2 --> $3.$4"))
+
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n\n")
+	out.Write(bytes.TrimLeft(data, "\n"))
+	return out.Bytes()
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"home-podcast/internal/models"
+)
+
+func TestSRTToVTT(t *testing.T) {
+	srt := "\xef\xbb\xbf1\r\n00:00:01,500 --> 00:00:04,000\r\nHello\r\n\r\n2\r\n00:00:05,000 --> 00:01:00,250\r\nWorld\r\n"
+	want := "WEBVTT\n\n1\n00:00:01.500 --> 00:00:04.000\nHello\n\n2\n00:00:05.000 --> 00:01:00.250\nWorld\n"
+	if got := string(srtToVTT([]byte(srt))); got != want {
+		t.Fatalf("unexpected conversion:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestTranscriptsEndpointAndFeed(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "shows"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	files := map[string]string{
+		"shows/talk.vtt":    "WEBVTT\n\n00:00.000 --> 00:01.000\nHi\n",
+		"shows/talk.de.srt": "1\n00:00:00,000 --> 00:00:01,000\nHallo\n",
+		"shows/notes.srt":   "not linked to any episode",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	episodes := []models.Episode{{
+		ID: "shows/talk.mp3", RelativePath: "shows/talk.mp3", Filename: "talk.mp3", ModifiedAt: time.Unix(1700000000, 0),
+		Transcripts: []models.Transcript{
+			{Path: "shows/talk.de.srt", Type: "application/x-subrip", Language: "de"},
+			{Path: "shows/talk.vtt", Type: "text/vtt"},
+		},
+	}}
+	validator := &fakeValidator{allowed: map[string]struct{}{"secret": {}}}
+	handler := New(&fakeLibrary{episodes: episodes}, validator, root, nil, testFeedMetadata(), log.New(io.Discard, "", 0))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "feed.example"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/transcripts/shows/talk.vtt"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	rec := get("/transcripts/shows/talk.vtt?token=secret")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != vttContentType || rec.Body.String() != files["shows/talk.vtt"] {
+		t.Fatalf("unexpected vtt response %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	rec = get("/transcripts/shows/talk.de.srt?token=secret")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != srtContentType || rec.Body.String() != files["shows/talk.de.srt"] {
+		t.Fatalf("unexpected srt response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = get("/transcripts/shows/talk.de.srt?token=secret&format=vtt")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != vttContentType {
+		t.Fatalf("unexpected converted response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if want := "WEBVTT\n\n1\n00:00:00.000 --> 00:00:01.000\nHallo\n"; rec.Body.String() != want {
+		t.Fatalf("unexpected converted body %q", rec.Body.String())
+	}
+
+	if rec := get("/transcripts/shows/talk.vtt?token=secret&format=ttml"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", rec.Code)
+	}
+	for _, path := range []string{"/transcripts/shows/notes.srt", "/transcripts/shows/talk.mp3", "/transcripts/shows/missing.vtt"} {
+		if rec := get(path + "?token=secret"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, rec.Code)
+		}
+	}
+
+	rec = get("/feed?token=secret")
+	var payload struct {
+		Channel struct {
+			Items []struct {
+				Transcripts []struct {
+					URL      string `xml:"url,attr"`
+					Type     string `xml:"type,attr"`
+					Language string `xml:"language,attr"`
+				} `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal rss: %v", err)
+	}
+	if len(payload.Channel.Items) != 1 || len(payload.Channel.Items[0].Transcripts) != 2 {
+		t.Fatalf("unexpected transcripts %+v", payload.Channel.Items)
+	}
+	first := payload.Channel.Items[0].Transcripts[0]
+	if first.URL != "https://feed.example/transcripts/shows/talk.de.srt?token=secret" || first.Type != "application/x-subrip" || first.Language != "de" {
+		t.Fatalf("unexpected transcript element %+v", first)
+	}
+}
@@ -0,0 +1,71 @@
+// Package uuid generates RFC 9562 identifiers without external dependencies.
+package uuid
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// NewV4 returns a random (version 4) UUID in its canonical string form.
+func NewV4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return format(b), nil
+}
+
+// NewV5 returns the name-based (version 5, SHA-1) UUID of name within the
+// namespace UUID given in canonical form.
+func NewV5(namespace, name string) (string, error) {
+	ns, err := parse(namespace)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return format(b), nil
+}
+
+// Valid reports whether s is a UUID in canonical form.
+func Valid(s string) bool {
+	_, err := parse(s)
+	return err == nil
+}
+
+func parse(s string) ([16]byte, error) {
+	var b [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return b, fmt.Errorf("invalid UUID %q", s)
+	}
+	raw, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return b, fmt.Errorf("invalid UUID %q: %w", s, err)
+	}
+	copy(b[:], raw)
+	return b, nil
+}
+
+func format(b [16]byte) string {
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
@@ -0,0 +1,57 @@
+package uuid
+
+import (
+	"regexp"
+	"testing"
+)
+
+var v4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewV4(t *testing.T) {
+	first, err := NewV4()
+	if err != nil {
+		t.Fatalf("NewV4: %v", err)
+	}
+	second, err := NewV4()
+	if err != nil {
+		t.Fatalf("NewV4: %v", err)
+	}
+
+	for _, id := range []string{first, second} {
+		if !v4Pattern.MatchString(id) {
+			t.Fatalf("unexpected UUID format %q", id)
+		}
+	}
+	if first == second {
+		t.Fatalf("expected distinct UUIDs, got %q twice", first)
+	}
+}
+
+func TestNewV5(t *testing.T) {
+	// Podcasting 2.0 feed GUID example.
+	got, err := NewV5("ead4c236-bf58-58c6-a2c6-a6b28d128cb6", "podnews.net/rss")
+	if err != nil {
+		t.Fatalf("NewV5: %v", err)
+	}
+	if want := "9b024349-ccf0-5f69-a609-6b82873eab3c"; got != want {
+		t.Fatalf("NewV5: got %q want %q", got, want)
+	}
+
+	if _, err := NewV5("not-a-uuid", "name"); err == nil {
+		t.Fatalf("expected invalid namespace to fail")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for value, want := range map[string]bool{
+		"9b024349-ccf0-5f69-a609-6b82873eab3c": true,
+		"9B024349-CCF0-5F69-A609-6B82873EAB3C": true,
+		"9b024349ccf05f69a6096b82873eab3c":     false,
+		"shows/pilot.mp3":                      false,
+		"9b024349-ccf0-5f69-a609-6b82873eabzz": false,
+	} {
+		if got := Valid(value); got != want {
+			t.Fatalf("Valid(%q) = %v, want %v", value, got, want)
+		}
+	}
+}